@@ -0,0 +1,217 @@
+// Package cache holds the in-memory response cache of the controllers.
+//
+// The responses are kept with their ETag, until they expire or are evicted
+// by the least recently used policy, when the cache is full. An expired
+// response can be kept a while longer, so it can still be served as stale.
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const (
+	// The default maximum count of cached entries
+	DefaultMaxEntries = 1024
+
+	// The default maximum size of the cached bodies, in bytes
+	DefaultMaxBytes = 16 << 20
+)
+
+// Entry is a cached response body.
+type Entry struct {
+	// The response body
+	Body []byte
+
+	// The strong ETag of the body, quoted
+	ETag string
+
+	// The time the entry expires
+	Expires time.Time
+
+	// The time the expired entry is dropped. It can be served as stale
+	// until then. The entry is dropped as it expires if this time is
+	// earlier.
+	StaleUntil time.Time
+}
+
+// NewEntry builds an entry expiring after the ttl, and computes its ETag.
+func NewEntry(body []byte, ttl time.Duration) Entry {
+	return Entry{
+		Body:    body,
+		ETag:    ETag(body),
+		Expires: time.Now().Add(ttl),
+	}
+}
+
+// ETag provides the strong ETag of a body, derived from its content.
+func ETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// retainedUntil provides the time the entry is dropped.
+func (e Entry) retainedUntil() time.Time {
+	if e.StaleUntil.After(e.Expires) {
+		return e.StaleUntil
+	}
+
+	return e.Expires
+}
+
+// MaxAge provides the time left before the entry expires, in whole seconds.
+func (e Entry) MaxAge() int {
+	left := time.Until(e.Expires)
+	if left <= 0 {
+		return 0
+	}
+
+	return int(left / time.Second)
+}
+
+// Cache holds the entries by key. It is safe for concurrent use.
+type Cache interface {
+	// Get provides the entry of the key, if it is cached and has not
+	// expired yet.
+	Get(key string) (Entry, bool)
+
+	// GetStale provides the entry of the key, if it is cached, fresh or
+	// stale.
+	GetStale(key string) (Entry, bool)
+
+	// Set caches the entry, replacing the previous one of the key.
+	Set(key string, e Entry)
+
+	// Len provides the count of cached entries
+	Len() int
+}
+
+// LRUOptions holds the parameters of the LRU cache builder
+type LRUOptions struct {
+	// The maximum count of entries, DefaultMaxEntries if zero
+	MaxEntries int
+
+	// The maximum size of the keys and bodies, in bytes. DefaultMaxBytes if
+	// zero.
+	MaxBytes int
+
+	// The clock telling the entries expiry, time.Now if nil
+	Now func() time.Time
+}
+
+func (opt LRUOptions) withDefaults() LRUOptions {
+	if opt.MaxEntries <= 0 {
+		opt.MaxEntries = DefaultMaxEntries
+	}
+	if opt.MaxBytes <= 0 {
+		opt.MaxBytes = DefaultMaxBytes
+	}
+	if opt.Now == nil {
+		opt.Now = time.Now
+	}
+	return opt
+}
+
+// item is an element of the recency list
+type item struct {
+	key   string
+	entry Entry
+}
+
+func (i *item) size() int {
+	return len(i.key) + len(i.entry.Body)
+}
+
+// lruImpl is a Cache bounded by its count of entries and its size. The least
+// recently used entries are evicted first.
+type lruImpl struct {
+	opt LRUOptions
+
+	mu    sync.Mutex
+	bytes int
+
+	// the most recently used item is at the front
+	items *list.List
+	keys  map[string]*list.Element
+}
+
+// NewLRU builds a new LRU cache.
+func NewLRU(opt LRUOptions) Cache {
+	return &lruImpl{
+		opt:   opt.withDefaults(),
+		items: list.New(),
+		keys:  make(map[string]*list.Element),
+	}
+}
+
+func (c *lruImpl) Get(key string) (Entry, bool) {
+	return c.get(key, false)
+}
+
+func (c *lruImpl) GetStale(key string) (Entry, bool) {
+	return c.get(key, true)
+}
+
+// get provides the entry of the key, the stale one only if allowed. The
+// entries past their retention are dropped.
+func (c *lruImpl) get(key string, stale bool) (Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.keys[key]
+	if !ok {
+		return Entry{}, false
+	}
+
+	it := elem.Value.(*item)
+	now := c.opt.Now()
+	if !now.Before(it.entry.retainedUntil()) {
+		c.remove(elem)
+		return Entry{}, false
+	}
+
+	if !stale && !now.Before(it.entry.Expires) {
+		return Entry{}, false
+	}
+
+	c.items.MoveToFront(elem)
+	return it.entry, true
+}
+
+func (c *lruImpl) Set(key string, e Entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.keys[key]; ok {
+		c.remove(elem)
+	}
+
+	it := &item{key: key, entry: e}
+	if it.size() > c.opt.MaxBytes {
+		return
+	}
+
+	c.keys[key] = c.items.PushFront(it)
+	c.bytes += it.size()
+
+	for c.items.Len() > c.opt.MaxEntries || c.bytes > c.opt.MaxBytes {
+		c.remove(c.items.Back())
+	}
+}
+
+func (c *lruImpl) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.items.Len()
+}
+
+// remove drops the element. The lock must be held.
+func (c *lruImpl) remove(elem *list.Element) {
+	it := c.items.Remove(elem).(*item)
+	delete(c.keys, it.key)
+	c.bytes -= it.size()
+}
@@ -0,0 +1,147 @@
+package cache_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/planetfall/gateway/internal/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+// clockFake is a clock moved by the tests
+type clockFake struct {
+	now time.Time
+}
+
+func (c *clockFake) Now() time.Time {
+	return c.now
+}
+
+func entryOf(body string) cache.Entry {
+	return cache.NewEntry([]byte(body), time.Minute)
+}
+
+func TestNewEntry(t *testing.T) {
+	// when
+	entryActual := cache.NewEntry([]byte("body"), time.Minute)
+	otherActual := cache.NewEntry([]byte("other"), time.Minute)
+
+	// then
+	assert.Equal(t, []byte("body"), entryActual.Body)
+	assert.Equal(t, cache.ETag([]byte("body")), entryActual.ETag)
+	assert.NotEqual(t, entryActual.ETag, otherActual.ETag)
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, entryActual.ETag)
+	assert.InDelta(t, 59, entryActual.MaxAge(), 1)
+}
+
+func TestLRU(t *testing.T) {
+	// given
+	c := cache.NewLRU(cache.LRUOptions{})
+
+	// when
+	c.Set("key", entryOf("body"))
+	entryActual, ok := c.Get("key")
+	_, okMissing := c.Get("missing")
+
+	// then
+	assert.True(t, ok)
+	assert.Equal(t, []byte("body"), entryActual.Body)
+	assert.False(t, okMissing)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestLRU_withExpiredEntry(t *testing.T) {
+	// given
+	clock := &clockFake{now: time.Now()}
+	c := cache.NewLRU(cache.LRUOptions{Now: clock.Now})
+	c.Set("key", entryOf("body"))
+
+	// when
+	clock.now = clock.now.Add(time.Minute + time.Second)
+	_, ok := c.Get("key")
+
+	// then
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestLRU_withMaxEntries(t *testing.T) {
+	// given
+	c := cache.NewLRU(cache.LRUOptions{MaxEntries: 2})
+	c.Set("a", entryOf("a"))
+	c.Set("b", entryOf("b"))
+
+	// when
+	// the a entry is used, b is then the least recently used one
+	_, _ = c.Get("a")
+	c.Set("c", entryOf("c"))
+
+	// then
+	_, okA := c.Get("a")
+	_, okB := c.Get("b")
+	_, okC := c.Get("c")
+	assert.True(t, okA)
+	assert.False(t, okB)
+	assert.True(t, okC)
+	assert.Equal(t, 2, c.Len())
+}
+
+func TestLRU_withMaxBytes(t *testing.T) {
+	// given
+	c := cache.NewLRU(cache.LRUOptions{MaxBytes: 10})
+	c.Set("a", entryOf("1234"))
+	c.Set("b", entryOf("1234"))
+
+	// when
+	c.Set("c", entryOf("1234"))
+	c.Set("large", entryOf("12345678901"))
+
+	// then
+	_, okA := c.Get("a")
+	_, okB := c.Get("b")
+	_, okC := c.Get("c")
+	_, okLarge := c.Get("large")
+	assert.False(t, okA)
+	assert.True(t, okB)
+	assert.True(t, okC)
+	assert.False(t, okLarge)
+}
+
+func TestLRU_withReplacedEntry(t *testing.T) {
+	// given
+	c := cache.NewLRU(cache.LRUOptions{MaxBytes: 10})
+	c.Set("a", entryOf("1234"))
+
+	// when
+	c.Set("a", entryOf("12345678"))
+
+	// then
+	entryActual, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("12345678"), entryActual.Body)
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestLRU_withStaleEntry(t *testing.T) {
+	// given
+	clock := &clockFake{now: time.Now()}
+	c := cache.NewLRU(cache.LRUOptions{Now: clock.Now})
+	entryGiven := entryOf("body")
+	entryGiven.StaleUntil = entryGiven.Expires.Add(time.Minute)
+	c.Set("key", entryGiven)
+
+	// when
+	clock.now = clock.now.Add(time.Minute + time.Second)
+	_, okFresh := c.Get("key")
+	entryStale, okStale := c.GetStale("key")
+
+	clock.now = clock.now.Add(time.Minute)
+	_, okDropped := c.GetStale("key")
+
+	// then
+	assert.False(t, okFresh)
+	assert.True(t, okStale)
+	assert.Equal(t, []byte("body"), entryStale.Body)
+	assert.False(t, okDropped)
+	assert.Equal(t, 0, c.Len())
+}
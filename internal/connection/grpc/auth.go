@@ -5,7 +5,7 @@ import (
 	"fmt"
 
 	"golang.org/x/oauth2"
-	grpcMetadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/credentials"
 )
 
 // TokenSource is responsible for providing OAuth tokens
@@ -15,29 +15,47 @@ type TokenSource interface {
 	Token() (*oauth2.Token, error)
 }
 
-// AuthenticateContext enrich an input context with an authentication token.
-// It retrieve this token using the connection configured token source.
-// If insecure is explicited provided, the given context is returned unchanged.
+// tokenCredentials attaches a token from the token source to each call.
 // This is reused from the [Cloud Run] documentation
 //
 // [Cloud Run]: https://cloud.google.com/run/docs/triggering/grpc#request-auth
-func (c *connectionImpl) AuthenticateContext(
-	ctx context.Context) (context.Context, error) {
+type tokenCredentials struct {
+	tokenSource TokenSource
+	requireTLS  bool
+}
 
-	// if tokenSource unset, not able to provide a token
-	if c.insecure {
-		return ctx, nil
+// NewTokenCredentials builds per-RPC credentials, which set the token
+// provided by the token source as a bearer authorization header.
+// If requireTLS is set, the token is only sent over a secure transport.
+//
+// As they are installed on the grpc.ClientConn, every attempt of a call is
+// authenticated, retries included.
+func NewTokenCredentials(tokenSource TokenSource,
+	requireTLS bool) credentials.PerRPCCredentials {
+
+	return &tokenCredentials{
+		tokenSource: tokenSource,
+		requireTLS:  requireTLS,
 	}
+}
+
+// GetRequestMetadata provides the authorization header. A token error fails
+// the call with an Unauthenticated status.
+func (c *tokenCredentials) GetRequestMetadata(
+	ctx context.Context, uri ...string) (map[string]string, error) {
 
-	// else, add token to ctx
 	token, err := c.tokenSource.Token()
 	if err != nil {
 		return nil, fmt.Errorf("tokenSource.Token: %v", err)
 	}
 
-	// set the token into a grpc context
-	ctx = grpcMetadata.AppendToOutgoingContext(
-		ctx, "authorization", "Bearer "+token.AccessToken)
+	return map[string]string{
+		"authorization": "Bearer " + token.AccessToken,
+	}, nil
+}
 
-	return ctx, nil
+// RequireTransportSecurity tells if sending the token in clear text is
+// forbidden
+func (c *tokenCredentials) RequireTransportSecurity() bool {
+	return c.requireTLS
 }
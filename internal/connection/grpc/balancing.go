@@ -0,0 +1,244 @@
+package grpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	_ "google.golang.org/grpc/health"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+)
+
+// The balancing policies of a connection
+const (
+	// BalancingPickFirst sends all the calls to the first reachable
+	// address. It is the default policy of a single target.
+	BalancingPickFirst = "pick-first"
+
+	// BalancingRoundRobin spreads the calls evenly over the addresses. It is
+	// the default policy of several endpoints.
+	BalancingRoundRobin = "round-robin"
+
+	// BalancingWeighted spreads the calls over the endpoints according to
+	// their weight
+	BalancingWeighted = "weighted"
+)
+
+// weightedName is the name of the static weighted round robin balancer. It
+// differs from the gRPC weighted_round_robin, which uses the load reported
+// by the backends.
+const weightedName = "gateway_weighted_round_robin"
+
+// endpointsScheme is the scheme of the resolver providing the endpoints
+const endpointsScheme = "endpoints"
+
+// balancerNames are the gRPC balancers of the policies
+var balancerNames = map[string]string{
+	BalancingPickFirst:  "pick_first",
+	BalancingRoundRobin: "round_robin",
+	BalancingWeighted:   weightedName,
+}
+
+func init() {
+	balancer.Register(base.NewBalancerBuilder(
+		weightedName, &weightedPickerBuilder{}, base.Config{HealthCheck: true}))
+}
+
+// Endpoint is an address serving the backend
+type Endpoint struct {
+	// The address, as host:port
+	Address string
+
+	// The weight of the endpoint with the weighted policy, 1 if zero
+	Weight uint32
+}
+
+// BalancingOptions holds the balancing parameters of a connection
+type BalancingOptions struct {
+	// The balancing policy, BalancingPickFirst for a single target and
+	// BalancingRoundRobin for several endpoints if empty
+	Policy string
+
+	// Enables the standard gRPC health checking protocol: the addresses
+	// which are not serving are skipped. The pick first policy does not
+	// support it.
+	HealthCheck bool
+
+	// The service name sent in the health checks, the whole server if empty
+	HealthCheckService string
+}
+
+// KeepaliveOptions holds the keepalive parameters of a connection
+type KeepaliveOptions struct {
+	// The time without activity after which the server is pinged, the
+	// keepalive is disabled if zero
+	Time time.Duration
+
+	// The time waited for the ping answer before closing the connection
+	Timeout time.Duration
+
+	// Sends the pings even without active calls
+	PermitWithoutStream bool
+}
+
+// weightKey is the address attribute holding the endpoint weight
+type weightKey struct{}
+
+// serviceConfig is the JSON gRPC service config of the connection
+type serviceConfig struct {
+	LoadBalancingConfig []map[string]struct{} `json:"loadBalancingConfig,omitempty"`
+	HealthCheckConfig   *healthCheckConfig    `json:"healthCheckConfig,omitempty"`
+}
+
+type healthCheckConfig struct {
+	ServiceName string `json:"serviceName"`
+}
+
+// getPolicy provides the configured policy or the default one
+func (opt ConnectionOptions) getPolicy() string {
+	if opt.Balancing.Policy != "" {
+		return opt.Balancing.Policy
+	}
+	if len(opt.Endpoints) > 0 {
+		return BalancingRoundRobin
+	}
+
+	return BalancingPickFirst
+}
+
+// balancingDialOptions provides the target to dial, and the dial options
+// setting up the endpoints resolution, the balancing, the health checks and
+// the keepalive.
+//
+// With endpoints, the target is only a name: the endpoints are provided by a
+// resolver, and each endpoint host is its TLS server name.
+func (opt ConnectionOptions) balancingDialOptions() (
+	string, []grpc.DialOption, error) {
+
+	policy := opt.getPolicy()
+	name, exists := balancerNames[policy]
+	if !exists {
+		return "", nil, fmt.Errorf("unknown balancing policy %q", policy)
+	}
+	if opt.Balancing.HealthCheck && policy == BalancingPickFirst {
+		return "", nil, fmt.Errorf("policy %s does not support health checks",
+			policy)
+	}
+
+	cfg := serviceConfig{
+		LoadBalancingConfig: []map[string]struct{}{{name: {}}},
+	}
+	if opt.Balancing.HealthCheck {
+		cfg.HealthCheckConfig = &healthCheckConfig{
+			ServiceName: opt.Balancing.HealthCheckService,
+		}
+	}
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return "", nil, fmt.Errorf("json.Marshal: %v", err)
+	}
+
+	dialOpts := []grpc.DialOption{grpc.WithDefaultServiceConfig(string(b))}
+
+	if opt.Keepalive.Time > 0 {
+		dialOpts = append(dialOpts, grpc.WithKeepaliveParams(
+			keepalive.ClientParameters{
+				Time:                opt.Keepalive.Time,
+				Timeout:             opt.Keepalive.Timeout,
+				PermitWithoutStream: opt.Keepalive.PermitWithoutStream,
+			}))
+	}
+
+	if len(opt.Endpoints) == 0 {
+		return opt.Target, dialOpts, nil
+	}
+
+	addrs := make([]resolver.Address, 0, len(opt.Endpoints))
+	for _, e := range opt.Endpoints {
+		host, _, err := net.SplitHostPort(e.Address)
+		if err != nil {
+			return "", nil, fmt.Errorf("endpoint %q: %v", e.Address, err)
+		}
+
+		weight := e.Weight
+		if weight == 0 {
+			weight = 1
+		}
+
+		addrs = append(addrs, resolver.Address{
+			Addr:               e.Address,
+			ServerName:         host,
+			BalancerAttributes: attributes.New(weightKey{}, weight),
+		})
+	}
+
+	r := manual.NewBuilderWithScheme(endpointsScheme)
+	r.InitialState(resolver.State{Addresses: addrs})
+	dialOpts = append(dialOpts, grpc.WithResolvers(r))
+
+	return endpointsScheme + ":///" + opt.Target, dialOpts, nil
+}
+
+// weightedPickerBuilder builds the pickers of the weighted policy
+type weightedPickerBuilder struct{}
+
+func (*weightedPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	p := &weightedPicker{}
+	for sc, scInfo := range info.ReadySCs {
+		weight, _ := scInfo.Address.BalancerAttributes.Value(
+			weightKey{}).(uint32)
+		if weight == 0 {
+			weight = 1
+		}
+		p.subConns = append(p.subConns, &weightedSubConn{
+			subConn: sc,
+			weight:  int64(weight),
+		})
+		p.total += int64(weight)
+	}
+
+	return p
+}
+
+type weightedSubConn struct {
+	subConn balancer.SubConn
+	weight  int64
+	current int64
+}
+
+// weightedPicker is a smooth weighted round robin: the calls are spread
+// over the ready addresses according to their weight, without bursts on the
+// heaviest one.
+type weightedPicker struct {
+	mu       sync.Mutex
+	subConns []*weightedSubConn
+	total    int64
+}
+
+func (p *weightedPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var picked *weightedSubConn
+	for _, sc := range p.subConns {
+		sc.current += sc.weight
+		if picked == nil || sc.current > picked.current {
+			picked = sc
+		}
+	}
+	picked.current -= p.total
+
+	return balancer.PickResult{SubConn: picked.subConn}, nil
+}
@@ -0,0 +1,175 @@
+package grpc_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/planetfall/gateway/internal/connection/grpc"
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/stretchr/testify/assert"
+	grpcG "google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// researcherFake answers the genre list with its own name
+type researcherFake struct {
+	pb.UnimplementedMusicResearcherServer
+
+	name string
+}
+
+func (s *researcherFake) GetGenreList(
+	ctx context.Context, e *pb.Empty) (*pb.GenreList, error) {
+
+	return &pb.GenreList{Genres: []string{s.name}}, nil
+}
+
+// newBackend starts a music researcher backend with a health server, and
+// provides its address.
+func newBackend(t *testing.T, name string,
+	status healthpb.HealthCheckResponse_ServingStatus) string {
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	healthSrv := health.NewServer()
+	healthSrv.SetServingStatus("", status)
+
+	srv := grpcG.NewServer()
+	pb.RegisterMusicResearcherServer(srv, &researcherFake{name: name})
+	healthpb.RegisterHealthServer(srv, healthSrv)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	return lis.Addr().String()
+}
+
+// newEndpointsConnection connects to the endpoints, and waits until each
+// of the expected backends answered once.
+func newEndpointsConnection(t *testing.T, endpoints []grpc.Endpoint,
+	balancing grpc.BalancingOptions, expected ...string) grpc.Connection {
+
+	c, err := grpc.NewConnection(grpc.ConnectionOptions{
+		Target:    "music-researcher",
+		Insecure:  true,
+		Endpoints: endpoints,
+		Balancing: balancing,
+		Keepalive: grpc.KeepaliveOptions{
+			Time:    time.Minute,
+			Timeout: 10 * time.Second,
+		},
+	})
+	assert.Nil(t, err)
+	t.Cleanup(func() { c.Close() })
+
+	seen := make(map[string]bool)
+	assert.Eventually(t, func() bool {
+		seen[call(t, c)] = true
+		return len(seen) == len(expected)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	return c
+}
+
+// call provides the name of the backend answering the call
+func call(t *testing.T, c grpc.Connection) string {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	res, err := pb.NewMusicResearcherClient(c.Client()).
+		GetGenreList(ctx, &pb.Empty{}, grpcG.WaitForReady(true))
+	assert.Nil(t, err)
+
+	return res.GetGenres()[0]
+}
+
+// countCalls makes the calls, and counts the calls of each backend
+func countCalls(t *testing.T, c grpc.Connection, calls int) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < calls; i++ {
+		counts[call(t, c)]++
+	}
+
+	return counts
+}
+
+func TestNewConnection_withRoundRobin(t *testing.T) {
+	// given
+	serving := healthpb.HealthCheckResponse_SERVING
+	endpointsGiven := []grpc.Endpoint{
+		{Address: newBackend(t, "a", serving)},
+		{Address: newBackend(t, "b", serving)},
+		{Address: newBackend(t, "c", serving)},
+	}
+	c := newEndpointsConnection(t, endpointsGiven,
+		grpc.BalancingOptions{}, "a", "b", "c")
+
+	// when
+	counts := countCalls(t, c, 30)
+
+	// then
+	assert.Equal(t, map[string]int{"a": 10, "b": 10, "c": 10}, counts)
+}
+
+func TestNewConnection_withWeighted(t *testing.T) {
+	// given
+	serving := healthpb.HealthCheckResponse_SERVING
+	endpointsGiven := []grpc.Endpoint{
+		{Address: newBackend(t, "a", serving), Weight: 3},
+		{Address: newBackend(t, "b", serving)},
+	}
+	c := newEndpointsConnection(t, endpointsGiven,
+		grpc.BalancingOptions{Policy: grpc.BalancingWeighted}, "a", "b")
+
+	// when
+	counts := countCalls(t, c, 40)
+
+	// then
+	assert.Equal(t, map[string]int{"a": 30, "b": 10}, counts)
+}
+
+func TestNewConnection_withHealthCheck(t *testing.T) {
+	// given
+	endpointsGiven := []grpc.Endpoint{
+		{Address: newBackend(t, "a", healthpb.HealthCheckResponse_SERVING)},
+		{Address: newBackend(t, "b", healthpb.HealthCheckResponse_NOT_SERVING)},
+	}
+	c := newEndpointsConnection(t, endpointsGiven,
+		grpc.BalancingOptions{HealthCheck: true}, "a")
+
+	// when
+	counts := countCalls(t, c, 10)
+
+	// then
+	assert.Equal(t, map[string]int{"a": 10}, counts)
+}
+
+func TestNewConnection_withInvalidBalancing_shouldFail(t *testing.T) {
+	optsGiven := map[string]grpc.ConnectionOptions{
+		`unknown balancing policy "random"`: {
+			Balancing: grpc.BalancingOptions{Policy: "random"},
+		},
+		"does not support health checks": {
+			Balancing: grpc.BalancingOptions{HealthCheck: true},
+		},
+		`endpoint "localhost"`: {
+			Endpoints: []grpc.Endpoint{{Address: "localhost"}},
+		},
+	}
+
+	for errExpected, optGiven := range optsGiven {
+		optGiven.Target = "target"
+		optGiven.Insecure = true
+
+		// when
+		c, err := grpc.NewConnection(optGiven)
+
+		// then
+		assert.Nil(t, c)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), errExpected)
+	}
+}
@@ -0,0 +1,235 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// BreakerState is the state of a circuit breaker
+type BreakerState string
+
+const (
+	// BreakerClosed lets the calls through
+	BreakerClosed BreakerState = "closed"
+
+	// BreakerOpen fails the calls fast, without reaching the backend
+	BreakerOpen BreakerState = "open"
+
+	// BreakerHalfOpen lets a single probe call through, which closes the
+	// breaker if it succeeds, or opens it again if it fails
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// The default time a breaker stays open before letting a probe call through
+const DefaultOpenTimeout = 30 * time.Second
+
+// breakerFailures are the codes telling the backend is unhealthy. The other
+// codes are answers from a working backend.
+var breakerFailures = map[codes.Code]bool{
+	codes.Unavailable:      true,
+	codes.DeadlineExceeded: true,
+	codes.Internal:         true,
+	codes.Unknown:          true,
+}
+
+// BreakerOpenError is returned instead of calling the backend, while the
+// breaker is open. It is seen as an Unavailable status.
+type BreakerOpenError struct {
+	retryAfter time.Duration
+}
+
+func (e *BreakerOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker open, retry after %v", e.retryAfter)
+}
+
+// GRPCStatus allows the error to be handled as a backend status
+func (e *BreakerOpenError) GRPCStatus() *status.Status {
+	return status.New(codes.Unavailable, e.Error())
+}
+
+// RetryAfter is the time left before the breaker lets a probe call through
+func (e *BreakerOpenError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// Breaker is a circuit breaker, it opens after consecutive failed calls so
+// an unhealthy backend is not flooded with calls.
+type Breaker interface {
+	// Allow tells if a call can be made. If so, the done callback must be
+	// given the call result. Else, the error is a BreakerOpenError.
+	Allow() (done func(error), err error)
+
+	// State provides the current state of the breaker
+	State() BreakerState
+}
+
+// BreakerOptions holds the parameters for the Breaker builder
+type BreakerOptions struct {
+	// The count of consecutive failed calls opening the breaker. The breaker
+	// never opens if zero.
+	FailureThreshold int
+
+	// The time the breaker stays open, DefaultOpenTimeout if zero
+	OpenTimeout time.Duration
+
+	// The logger of the state transitions, log.Default if nil
+	Logger *log.Logger
+}
+
+func (opt BreakerOptions) getOpenTimeout() time.Duration {
+	if opt.OpenTimeout <= 0 {
+		return DefaultOpenTimeout
+	}
+
+	return opt.OpenTimeout
+}
+
+func (opt BreakerOptions) getLogger() *log.Logger {
+	if opt.Logger == nil {
+		return log.Default()
+	}
+
+	return opt.Logger
+}
+
+type breakerImpl struct {
+	threshold   int
+	openTimeout time.Duration
+	logger      *log.Logger
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+
+	// the count of transitions, telling the calls allowed in a previous
+	// state apart
+	generation uint64
+}
+
+// NewBreaker builds a new closed breaker.
+func NewBreaker(opt BreakerOptions) Breaker {
+	return &breakerImpl{
+		threshold:   opt.FailureThreshold,
+		openTimeout: opt.getOpenTimeout(),
+		logger:      opt.getLogger(),
+		state:       BreakerClosed,
+	}
+}
+
+func (b *breakerImpl) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+func (b *breakerImpl) Allow() (func(error), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen {
+		elapsed := time.Since(b.openedAt)
+		if elapsed < b.openTimeout {
+			return nil, &BreakerOpenError{retryAfter: b.openTimeout - elapsed}
+		}
+		b.transition(BreakerHalfOpen)
+	}
+
+	probe := false
+	if b.state == BreakerHalfOpen {
+		// only one probe at a time, the others wait for its result
+		if b.probing {
+			return nil, &BreakerOpenError{retryAfter: time.Second}
+		}
+		b.probing = true
+		probe = true
+	}
+
+	generation := b.generation
+	return func(err error) { b.done(generation, probe, err) }, nil
+}
+
+// done records the result of a call allowed in the generation. The result
+// of a call allowed before the last transition is ignored, as it tells
+// nothing about the current state. A canceled call is not recorded either,
+// as it tells nothing about the backend.
+func (b *breakerImpl) done(generation uint64, probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+	if probe {
+		b.probing = false
+	}
+
+	if status.Code(err) == codes.Canceled {
+		return
+	}
+
+	if !breakerFailures[status.Code(err)] {
+		b.failures = 0
+		if b.state != BreakerClosed {
+			b.transition(BreakerClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen ||
+		(b.threshold > 0 && b.failures >= b.threshold) {
+
+		b.openedAt = time.Now()
+		b.transition(BreakerOpen)
+	}
+}
+
+// transition changes the state, and logs it. The calls allowed so far
+// belong to the previous generation. The lock must be held.
+func (b *breakerImpl) transition(state BreakerState) {
+	b.logger.Printf("circuit breaker %s -> %s, %d consecutive failures",
+		b.state, state, b.failures)
+	b.state = state
+	b.generation++
+}
+
+// outcome provides the result of a call recorded by the breaker. A call which
+// failed once its caller gave up, canceled or past the caller deadline, tells
+// nothing about the backend: it is recorded as canceled, and then ignored.
+func outcome(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return status.Error(codes.Canceled, ctx.Err().Error())
+	}
+
+	return err
+}
+
+// BreakerUnaryInterceptor fails the calls fast while the breaker is open.
+// The calls failing because of their caller are not recorded, so a client
+// sending short deadlines cannot open the breaker for everyone.
+func BreakerUnaryInterceptor(breaker Breaker) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption) error {
+
+		done, err := breaker.Allow()
+		if err != nil {
+			return err
+		}
+
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		done(outcome(ctx, err))
+
+		return err
+	}
+}
@@ -0,0 +1,218 @@
+package grpc_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/planetfall/gateway/internal/connection/grpc"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errUnavailable = status.Error(codes.Unavailable, "test unavailable")
+
+// fail records failed calls on the breaker
+func fail(t *testing.T, breaker grpc.Breaker, count int) {
+	for i := 0; i < count; i++ {
+		done, err := breaker.Allow()
+		assert.Nil(t, err)
+		done(errUnavailable)
+	}
+}
+
+func TestNewBreaker_withConsecutiveFailures_shouldOpen(t *testing.T) {
+	// given
+	breaker := grpc.NewBreaker(grpc.BreakerOptions{
+		FailureThreshold: 3,
+		OpenTimeout:      time.Minute,
+	})
+
+	// when
+	fail(t, breaker, 2)
+	assert.Equal(t, grpc.BreakerClosed, breaker.State())
+	fail(t, breaker, 1)
+
+	// then
+	assert.Equal(t, grpc.BreakerOpen, breaker.State())
+
+	_, err := breaker.Allow()
+	assert.NotNil(t, err)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	var openErr *grpc.BreakerOpenError
+	assert.True(t, errors.As(fmt.Errorf("client.Search: %w", err), &openErr))
+	assert.InDelta(t, time.Minute.Seconds(),
+		openErr.RetryAfter().Seconds(), 1)
+}
+
+func TestNewBreaker_withSuccess_shouldResetFailures(t *testing.T) {
+	// given
+	breaker := grpc.NewBreaker(grpc.BreakerOptions{FailureThreshold: 2})
+
+	// when
+	fail(t, breaker, 1)
+	done, _ := breaker.Allow()
+	done(status.Error(codes.NotFound, "test not found"))
+	fail(t, breaker, 1)
+
+	// then
+	assert.Equal(t, grpc.BreakerClosed, breaker.State())
+}
+
+func TestNewBreaker_withCanceledCalls_shouldNotOpen(t *testing.T) {
+	// given
+	breaker := grpc.NewBreaker(grpc.BreakerOptions{FailureThreshold: 1})
+
+	// when
+	done, _ := breaker.Allow()
+	done(status.Error(codes.Canceled, "test canceled"))
+
+	// then
+	assert.Equal(t, grpc.BreakerClosed, breaker.State())
+}
+
+func TestNewBreaker_withZeroThreshold_shouldNotOpen(t *testing.T) {
+	// given
+	breaker := grpc.NewBreaker(grpc.BreakerOptions{})
+
+	// when
+	fail(t, breaker, 100)
+
+	// then
+	assert.Equal(t, grpc.BreakerClosed, breaker.State())
+}
+
+func TestNewBreaker_withHalfOpen(t *testing.T) {
+	// given
+	breaker := grpc.NewBreaker(grpc.BreakerOptions{
+		FailureThreshold: 1,
+		OpenTimeout:      10 * time.Millisecond,
+	})
+	fail(t, breaker, 1)
+	time.Sleep(20 * time.Millisecond)
+
+	// when
+	done, err := breaker.Allow()
+	assert.Nil(t, err)
+
+	// then
+	// a single probe is let through
+	assert.Equal(t, grpc.BreakerHalfOpen, breaker.State())
+	_, err = breaker.Allow()
+	assert.NotNil(t, err)
+
+	done(nil)
+	assert.Equal(t, grpc.BreakerClosed, breaker.State())
+}
+
+func TestNewBreaker_withHalfOpenFailure_shouldOpen(t *testing.T) {
+	// given
+	breaker := grpc.NewBreaker(grpc.BreakerOptions{
+		FailureThreshold: 2,
+		OpenTimeout:      10 * time.Millisecond,
+	})
+	fail(t, breaker, 2)
+	time.Sleep(20 * time.Millisecond)
+
+	// when
+	fail(t, breaker, 1)
+
+	// then
+	assert.Equal(t, grpc.BreakerOpen, breaker.State())
+}
+
+func TestNewBreaker_withLateCalls_shouldIgnoreThem(t *testing.T) {
+	// given
+	breaker := grpc.NewBreaker(grpc.BreakerOptions{
+		FailureThreshold: 1,
+		OpenTimeout:      10 * time.Millisecond,
+	})
+	lateSuccess, _ := breaker.Allow()
+	lateFailure, _ := breaker.Allow()
+	fail(t, breaker, 1)
+
+	// when
+	lateSuccess(nil)
+	lateFailure(errUnavailable)
+
+	// then
+	// the calls allowed while closed do not close the open breaker
+	assert.Equal(t, grpc.BreakerOpen, breaker.State())
+
+	time.Sleep(20 * time.Millisecond)
+	probe, err := breaker.Allow()
+	assert.Nil(t, err)
+	lateSuccess(nil)
+	lateFailure(errUnavailable)
+
+	// nor do they end the probe, or let a second one through
+	assert.Equal(t, grpc.BreakerHalfOpen, breaker.State())
+	_, err = breaker.Allow()
+	assert.NotNil(t, err)
+
+	probe(nil)
+	assert.Equal(t, grpc.BreakerClosed, breaker.State())
+}
+
+func TestNewBreaker_withCanceledProbe_shouldAllowAnother(t *testing.T) {
+	// given
+	breaker := grpc.NewBreaker(grpc.BreakerOptions{
+		FailureThreshold: 1,
+		OpenTimeout:      10 * time.Millisecond,
+	})
+	fail(t, breaker, 1)
+	time.Sleep(20 * time.Millisecond)
+	probe, err := breaker.Allow()
+	assert.Nil(t, err)
+
+	// when
+	probe(status.Error(codes.Canceled, "test canceled"))
+
+	// then
+	assert.Equal(t, grpc.BreakerHalfOpen, breaker.State())
+	_, err = breaker.Allow()
+	assert.Nil(t, err)
+}
+
+func TestBreakerUnaryInterceptor(t *testing.T) {
+	// given
+	breaker := grpc.NewBreaker(grpc.BreakerOptions{FailureThreshold: 2})
+	invoker := &invokerFake{errs: []error{errUnavailable}}
+	interceptor := grpc.BreakerUnaryInterceptor(breaker)
+
+	// when
+	for i := 0; i < 5; i++ {
+		err := interceptor(
+			context.Background(), "/svc/Method", nil, nil, nil, invoker.invoke)
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+	}
+
+	// then
+	assert.Equal(t, 2, invoker.calls)
+	assert.Equal(t, grpc.BreakerOpen, breaker.State())
+}
+
+func TestBreakerUnaryInterceptor_withCallerDeadline_shouldNotOpen(t *testing.T) {
+	// given
+	breaker := grpc.NewBreaker(grpc.BreakerOptions{FailureThreshold: 2})
+	invoker := &invokerFake{errs: []error{
+		status.Error(codes.DeadlineExceeded, "test deadline exceeded")}}
+	interceptor := grpc.BreakerUnaryInterceptor(breaker)
+
+	// when
+	for i := 0; i < 5; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		<-ctx.Done()
+		err := interceptor(ctx, "/svc/Method", nil, nil, nil, invoker.invoke)
+		cancel()
+		assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	}
+
+	// then
+	assert.Equal(t, 5, invoker.calls)
+	assert.Equal(t, grpc.BreakerClosed, breaker.State())
+}
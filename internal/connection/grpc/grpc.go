@@ -6,27 +6,29 @@
 package grpc
 
 import (
-	"context"
 	"fmt"
+	"net"
 	"strings"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 )
 
 // Connection is an helper, that holds the actual grpc.ClientConn
 // connection.
-// It encapsulate the authentication, and the setup of the transport
-// credentials.
+// It encapsulate the authentication, the setup of the transport
+// credentials and of the interceptor chain: the calls made with the
+// generated clients need no further setup.
 type Connection interface {
 	Client() *grpc.ClientConn
 	Close() error
-	AuthenticateContext(context.Context) (context.Context, error)
+	State() connectivity.State
+	BreakerState() BreakerState
 }
 
 type connectionImpl struct {
-	client      *grpc.ClientConn
-	tokenSource TokenSource
-	insecure    bool
+	client  *grpc.ClientConn
+	breaker Breaker
 }
 
 // Client allows read access on the grpc.ClientConn property.
@@ -34,6 +36,17 @@ func (c *connectionImpl) Client() *grpc.ClientConn {
 	return c.client
 }
 
+// State provides the connectivity state of the grpc.ClientConn connection
+func (c *connectionImpl) State() connectivity.State {
+	return c.client.GetState()
+}
+
+// BreakerState provides the state of the connection circuit breaker. It is
+// always closed if the breaker is not part of the interceptor chain.
+func (c *connectionImpl) BreakerState() BreakerState {
+	return c.breaker.State()
+}
+
 // Close terminates the grpc.ClientConn connection
 func (c *connectionImpl) Close() error {
 	return c.client.Close()
@@ -50,6 +63,26 @@ type ConnectionOptions struct {
 	// Custom provider which provides a token source and a GRPC client
 	// connection
 	Provider Provider
+
+	// Interceptors builder parameter (optional)
+	Interceptors InterceptorOptions
+
+	// Auth builder parameter (optional)
+	Auth AuthOptions
+
+	// TLS builder parameter (optional), used if not insecure
+	TLS TLSOptions
+
+	// Endpoints builder parameter (optional). If set, the target is only
+	// used as a name, such as for the audience, and the calls are spread
+	// over the endpoints.
+	Endpoints []Endpoint
+
+	// Balancing builder parameter (optional)
+	Balancing BalancingOptions
+
+	// Keepalive builder parameter (optional)
+	Keepalive KeepaliveOptions
 }
 
 // getProvider returns the provider given in options if not nil.
@@ -64,34 +97,56 @@ func (opt ConnectionOptions) getProvider() Provider {
 
 // NewConnection builds a new GRPC connection object.
 // It holds the actual grpc.ClientConn used to interact with a GRPC service.
-// It also provides an helper method to authenticate a context.
 //
 // The isInsecure parameter is used to set on/off the security context:
-//   - if true, the token source is unset, and the transport credentials are
-//     empty.
-//   - else, the token source is configured, and and the transport credentials
-//     use TLS.
+//   - if true, the transport credentials are empty, and no Google ID token
+//     is requested. A static token is still sent.
+//   - else, the transport credentials use TLS, configured with the TLS
+//     options.
 //
+// The token of the auth mode, if any, is cached and attached to each call by
+// per-RPC credentials.
+//
+// The configured interceptor chain is installed on the connection.
 // The host is used to setup the grpc.ClientConn.
 func NewConnection(opt ConnectionOptions) (Connection, error) {
 
 	provider := opt.getProvider()
 
-	client, err := provider.NewClient(opt.Target, opt.Insecure)
+	breaker := opt.Interceptors.newBreaker()
+	dialOpts, err := opt.Interceptors.dialOptions(breaker)
 	if err != nil {
-		return nil, fmt.Errorf("provider.NewClient: %v", err)
+		return nil, fmt.Errorf("interceptors: %v", err)
 	}
 
-	audience := buildAudienceFromTarget(opt.Target)
-	tokenSource, err := provider.NewTokenSource(audience, opt.Insecure)
+	tokenSource, err := opt.newTokenSource(provider)
 	if err != nil {
-		return nil, fmt.Errorf("provider.NewTokenSource: %v", err)
+		return nil, fmt.Errorf("auth: %v", err)
+	}
+	if tokenSource != nil {
+		creds := NewTokenCredentials(tokenSource, !opt.Insecure)
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(creds))
+	}
+
+	creds, err := newTransportCredentials(opt.Insecure, opt.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("tls: %v", err)
+	}
+
+	target, balancingOpts, err := opt.balancingDialOptions()
+	if err != nil {
+		return nil, fmt.Errorf("balancing: %v", err)
+	}
+	dialOpts = append(dialOpts, balancingOpts...)
+
+	client, err := provider.NewClient(target, creds, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("provider.NewClient: %v", err)
 	}
 
 	return &connectionImpl{
-		client:      client,
-		tokenSource: tokenSource,
-		insecure:    opt.Insecure,
+		client:  client,
+		breaker: breaker,
 	}, nil
 }
 
@@ -102,17 +157,40 @@ func NewConnection(opt ConnectionOptions) (Connection, error) {
 //
 // For example, the following targets:
 //   - music-researcher.run.app:443
-//   - locahost:8080
+//   - dns:///music-researcher.run.app:443
+//   - localhost:8080
+//   - [::1]:8080
 //
 // Should have the following audiences:
 //   - https://music-researcher.run.app
-//   - https://localhost:8080
+//   - https://music-researcher.run.app
+//   - https://localhost
+//   - https://[::1]
 //
 // It is generated through this method and not configured to avoid duplication
-// of the host.
+// of the host. It can still be overridden by the auth options.
 func buildAudienceFromTarget(target string) string {
+	// removes the scheme if any, the gRPC resolvers targets such as
+	// dns://resolver/host:443 hold the endpoint in the path
+	if _, rest, found := strings.Cut(target, "://"); found {
+		authority, endpoint, _ := strings.Cut(rest, "/")
+		if endpoint == "" {
+			endpoint = authority
+		}
+		target = endpoint
+	}
+
 	// removes the port part if any
-	host := strings.Split(target, ":")[0]
+	host := target
+	if h, _, err := net.SplitHostPort(target); err == nil {
+		host = h
+	}
+
+	// IPv6 literals are enclosed in brackets
+	host = strings.Trim(host, "[]")
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
 
 	// audience is only used in secured/TLS environment
 	// we can safely assume that only HTTPS scheme is needed
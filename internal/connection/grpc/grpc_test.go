@@ -8,10 +8,15 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	grpcG "google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
+// providerMock is called with the security protocol of the transport
+// credentials, and keeps them.
 type providerMock struct {
 	mock.Mock
+
+	creds credentials.TransportCredentials
 }
 
 func (m *providerMock) NewTokenSource(
@@ -21,10 +26,12 @@ func (m *providerMock) NewTokenSource(
 	return args.Get(0).(grpc.TokenSource), args.Error(1)
 }
 
-func (m *providerMock) NewClient(
-	target string, insecure bool) (*grpcG.ClientConn, error) {
+func (m *providerMock) NewClient(target string,
+	creds credentials.TransportCredentials,
+	opts ...grpcG.DialOption) (*grpcG.ClientConn, error) {
 
-	args := m.Called(target, insecure)
+	m.creds = creds
+	args := m.Called(target, creds.Info().SecurityProtocol)
 	return args.Get(0).(*grpcG.ClientConn), args.Error(1)
 }
 
@@ -77,16 +84,18 @@ func TestNewConnect_withClientError(t *testing.T) {
 	}
 
 	// when
+	providerGiven.
+		On("NewTokenSource", mock.Anything, insecureGiven).
+		Return(&tokenSourceMock{}, nil)
 	errMessageGiven := "test client error"
 	providerGiven.
-		On("NewClient", targetGiven, insecureGiven).
+		On("NewClient", targetGiven, "tls").
 		Return(&grpcG.ClientConn{}, fmt.Errorf(errMessageGiven))
 
 	// then
 	c, err := grpc.NewConnection(optGiven)
 
 	providerGiven.AssertExpectations(t)
-	providerGiven.AssertNotCalled(t, "NewTokenSource")
 
 	assert.Nil(t, c)
 	assert.NotNil(t, err)
@@ -107,9 +116,6 @@ func TestNewConnect_withTokenSourceError(t *testing.T) {
 	tokenSourceGiven := &tokenSourceMock{}
 
 	// when
-	providerGiven.
-		On("NewClient", targetGiven, insecureGiven).
-		Return(&grpcG.ClientConn{}, nil)
 	errMessageGiven := "test token source error"
 	providerGiven.
 		On("NewTokenSource", mock.Anything, insecureGiven).
@@ -119,9 +125,89 @@ func TestNewConnect_withTokenSourceError(t *testing.T) {
 	c, err := grpc.NewConnection(optGiven)
 
 	providerGiven.AssertExpectations(t)
-	providerGiven.AssertNotCalled(t, "NewTokenSource")
+	providerGiven.AssertNotCalled(t, "NewClient", targetGiven, "tls")
 
 	assert.Nil(t, c)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), errMessageGiven)
 }
+
+func TestNewConnection_withUnknownInterceptor_shouldFail(t *testing.T) {
+	// given
+	providerGiven := &providerMock{}
+	optGiven := grpc.ConnectionOptions{
+		Target:   "target",
+		Insecure: true,
+		Provider: providerGiven,
+		Interceptors: grpc.InterceptorOptions{
+			Chain: []string{grpc.InterceptorLogging, "unknown"},
+		},
+	}
+
+	// when
+	c, err := grpc.NewConnection(optGiven)
+
+	// then
+	assert.Nil(t, c)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), `unknown interceptor "unknown"`)
+	providerGiven.AssertNotCalled(t, "NewClient", mock.Anything, mock.Anything)
+}
+
+func TestNewConnection_withAudience(t *testing.T) {
+	targetsGiven := map[string]string{
+		"music-researcher.run.app:443":           "https://music-researcher.run.app",
+		"music-researcher.run.app":               "https://music-researcher.run.app",
+		"dns:///music-researcher.run.app:443":    "https://music-researcher.run.app",
+		"dns://8.8.8.8/music-researcher.run.app": "https://music-researcher.run.app",
+		"https://music-researcher.run.app":       "https://music-researcher.run.app",
+		"localhost:8080":                         "https://localhost",
+		"[::1]:8080":                             "https://[::1]",
+		"[2001:db8::1]":                          "https://[2001:db8::1]",
+		"2001:db8::1":                            "https://[2001:db8::1]",
+	}
+
+	for targetGiven, audienceExpected := range targetsGiven {
+		// given
+		providerGiven := &providerMock{}
+		providerGiven.
+			On("NewTokenSource", audienceExpected, false).
+			Return(&tokenSourceMock{}, nil)
+		providerGiven.
+			On("NewClient", targetGiven, "tls").
+			Return(&grpcG.ClientConn{}, nil)
+
+		// when
+		_, err := grpc.NewConnection(grpc.ConnectionOptions{
+			Target:   targetGiven,
+			Provider: providerGiven,
+		})
+
+		// then
+		assert.Nil(t, err)
+		providerGiven.AssertExpectations(t)
+	}
+}
+
+func TestNewConnection_withAudienceOverride(t *testing.T) {
+	// given
+	providerGiven := &providerMock{}
+	audienceGiven := "https://music-researcher.example.com"
+	providerGiven.
+		On("NewTokenSource", audienceGiven, false).
+		Return(&tokenSourceMock{}, nil)
+	providerGiven.
+		On("NewClient", "10.0.0.1:443", "tls").
+		Return(&grpcG.ClientConn{}, nil)
+
+	// when
+	_, err := grpc.NewConnection(grpc.ConnectionOptions{
+		Target:   "10.0.0.1:443",
+		Provider: providerGiven,
+		Auth:     grpc.AuthOptions{Audience: audienceGiven},
+	})
+
+	// then
+	assert.Nil(t, err)
+	providerGiven.AssertExpectations(t)
+}
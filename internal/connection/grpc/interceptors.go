@@ -0,0 +1,346 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/planetfall/gateway/internal/metrics"
+	"github.com/planetfall/gateway/internal/requestid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcMetadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// The interceptors which can be installed on a connection. The
+// authentication is not part of the chain: the token is attached by the
+// per-RPC credentials of the connection, on every attempt.
+const (
+	// InterceptorRequestID forwards the request ID as outgoing metadata
+	InterceptorRequestID = "request-id"
+
+	// InterceptorLogging logs the method, status and duration of each call
+	InterceptorLogging = "logging"
+
+	// InterceptorMetrics observes the duration of the unary calls
+	InterceptorMetrics = "metrics"
+
+	// InterceptorBreaker fails the unary calls fast while the backend is
+	// unhealthy
+	InterceptorBreaker = "breaker"
+
+	// InterceptorRetry retries the unary calls failing with a retryable code
+	InterceptorRetry = "retry"
+
+	// InterceptorTimeout bounds the duration of each unary call attempt
+	InterceptorTimeout = "timeout"
+)
+
+// DefaultInterceptors is the chain installed when none is configured. The
+// first interceptor is the outermost one: the calls are logged, measured and
+// recorded by the breaker once, while the timeout applies to each retried
+// attempt.
+var DefaultInterceptors = []string{
+	InterceptorRequestID,
+	InterceptorLogging,
+	InterceptorMetrics,
+	InterceptorBreaker,
+	InterceptorRetry,
+	InterceptorTimeout,
+}
+
+const (
+	// The default backoff before the first retry
+	DefaultInitialBackoff = 100 * time.Millisecond
+
+	// The default maximum backoff between two retries
+	DefaultMaxBackoff = 2 * time.Second
+
+	// The default factor the backoff grows by after each retry
+	DefaultMultiplier = 2.0
+
+	// The default fraction of the backoff randomly added or removed
+	DefaultJitter = 0.2
+)
+
+// DefaultRetryCodes are the codes retried when none is configured. The
+// Unavailable status is returned when the backend could not be reached, or
+// is starting.
+var DefaultRetryCodes = []codes.Code{codes.Unavailable}
+
+// RetryOptions holds the parameters of the retry interceptor
+type RetryOptions struct {
+	// The maximum count of attempts of a call, the first one included.
+	// The calls are not retried if lower than 2.
+	MaxAttempts int
+
+	// The time waited before the first retry
+	InitialBackoff time.Duration
+
+	// The upper bound of the time waited between two attempts
+	MaxBackoff time.Duration
+
+	// The factor applied to the backoff after each retry
+	Multiplier float64
+
+	// The fraction of the backoff randomly added or removed, so the clients
+	// do not retry all at once
+	Jitter float64
+
+	// The retried codes, DefaultRetryCodes if empty
+	Codes []codes.Code
+}
+
+func (opt RetryOptions) withDefaults() RetryOptions {
+	if opt.InitialBackoff <= 0 {
+		opt.InitialBackoff = DefaultInitialBackoff
+	}
+	if opt.MaxBackoff <= 0 {
+		opt.MaxBackoff = DefaultMaxBackoff
+	}
+	if opt.Multiplier < 1 {
+		opt.Multiplier = DefaultMultiplier
+	}
+	if opt.Jitter <= 0 || opt.Jitter > 1 {
+		opt.Jitter = DefaultJitter
+	}
+	if len(opt.Codes) == 0 {
+		opt.Codes = DefaultRetryCodes
+	}
+	return opt
+}
+
+// backoff provides the time to wait before the given retry, starting at 1.
+func (opt RetryOptions) backoff(retry int) time.Duration {
+	backoff := float64(opt.InitialBackoff) *
+		math.Pow(opt.Multiplier, float64(retry-1))
+	backoff = math.Min(backoff, float64(opt.MaxBackoff))
+
+	// spread the backoff over [1-jitter, 1+jitter]
+	backoff *= 1 + opt.Jitter*(2*rand.Float64()-1)
+
+	return time.Duration(backoff)
+}
+
+// retryable tells if a call failing with the code can be retried
+func (opt RetryOptions) retryable(code codes.Code) bool {
+	for _, c := range opt.Codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// InterceptorOptions holds the parameters of the interceptor chain
+type InterceptorOptions struct {
+	// The interceptors names, in order. DefaultInterceptors if nil.
+	Chain []string
+
+	// The logger of the logging interceptor, log.Default if nil
+	Logger *log.Logger
+
+	// The timeout of each call attempt, when the call context has no
+	// earlier deadline. No timeout is set if zero.
+	Timeout time.Duration
+
+	// The retry interceptor parameters
+	Retry RetryOptions
+
+	// The breaker interceptor parameters. The breaker logs with the
+	// interceptors logger if it has none.
+	Breaker BreakerOptions
+}
+
+func (opt InterceptorOptions) getChain() []string {
+	if opt.Chain == nil {
+		return DefaultInterceptors
+	}
+
+	return opt.Chain
+}
+
+func (opt InterceptorOptions) getLogger() *log.Logger {
+	if opt.Logger == nil {
+		return log.Default()
+	}
+
+	return opt.Logger
+}
+
+// newBreaker builds the breaker of the connection.
+func (opt InterceptorOptions) newBreaker() Breaker {
+	breakerOpt := opt.Breaker
+	if breakerOpt.Logger == nil {
+		breakerOpt.Logger = opt.getLogger()
+	}
+
+	return NewBreaker(breakerOpt)
+}
+
+// dialOptions builds the unary and stream interceptor chains. The stream
+// calls are only concerned by the request ID and logging interceptors.
+func (opt InterceptorOptions) dialOptions(
+	breaker Breaker) ([]grpc.DialOption, error) {
+
+	unary := make([]grpc.UnaryClientInterceptor, 0)
+	stream := make([]grpc.StreamClientInterceptor, 0)
+
+	for _, name := range opt.getChain() {
+		switch name {
+		case InterceptorRequestID:
+			unary = append(unary, RequestIDUnaryInterceptor())
+			stream = append(stream, RequestIDStreamInterceptor())
+		case InterceptorLogging:
+			unary = append(unary, LoggingUnaryInterceptor(opt.getLogger()))
+			stream = append(stream, LoggingStreamInterceptor(opt.getLogger()))
+		case InterceptorMetrics:
+			unary = append(unary, metrics.UnaryClientInterceptor())
+		case InterceptorBreaker:
+			unary = append(unary, BreakerUnaryInterceptor(breaker))
+		case InterceptorRetry:
+			unary = append(unary, RetryUnaryInterceptor(opt.Retry))
+		case InterceptorTimeout:
+			unary = append(unary, TimeoutUnaryInterceptor(opt.Timeout))
+		default:
+			return nil, fmt.Errorf("unknown interceptor %q", name)
+		}
+	}
+
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(unary...),
+		grpc.WithChainStreamInterceptor(stream...),
+	}, nil
+}
+
+// withRequestID appends the request ID carried by the context, if any, to
+// the outgoing metadata.
+func withRequestID(ctx context.Context) context.Context {
+	if id, ok := requestid.FromContext(ctx); ok {
+		ctx = grpcMetadata.AppendToOutgoingContext(
+			ctx, requestid.MetadataKey, id)
+	}
+
+	return ctx
+}
+
+// RequestIDUnaryInterceptor forwards the request ID to the backend.
+func RequestIDUnaryInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption) error {
+
+		return invoker(withRequestID(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// RequestIDStreamInterceptor forwards the request ID to the backend.
+func RequestIDStreamInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc,
+		cc *grpc.ClientConn, method string, streamer grpc.Streamer,
+		opts ...grpc.CallOption) (grpc.ClientStream, error) {
+
+		return streamer(withRequestID(ctx), desc, cc, method, opts...)
+	}
+}
+
+// logCall logs a call with its request ID, if any.
+func logCall(logger *log.Logger, ctx context.Context,
+	method string, err error, elapsed time.Duration) {
+
+	id, ok := requestid.FromContext(ctx)
+	if !ok {
+		id = "-"
+	}
+
+	if err != nil {
+		logger.Printf("[%s] grpc %s: %s in %v: %v",
+			id, method, status.Code(err), elapsed, err)
+		return
+	}
+
+	logger.Printf("[%s] grpc %s: %s in %v", id, method, codes.OK, elapsed)
+}
+
+// LoggingUnaryInterceptor logs the method, status and duration of each call.
+func LoggingUnaryInterceptor(logger *log.Logger) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption) error {
+
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		logCall(logger, ctx, method, err, time.Since(start))
+
+		return err
+	}
+}
+
+// LoggingStreamInterceptor logs the opening of each stream. Only the errors
+// preventing the stream to open are logged.
+func LoggingStreamInterceptor(
+	logger *log.Logger) grpc.StreamClientInterceptor {
+
+	return func(ctx context.Context, desc *grpc.StreamDesc,
+		cc *grpc.ClientConn, method string, streamer grpc.Streamer,
+		opts ...grpc.CallOption) (grpc.ClientStream, error) {
+
+		start := time.Now()
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		logCall(logger, ctx, method, err, time.Since(start))
+
+		return stream, err
+	}
+}
+
+// RetryUnaryInterceptor retries the calls failing with a retryable code,
+// waiting for an exponential backoff between the attempts. It gives up when
+// the call context is done.
+func RetryUnaryInterceptor(opt RetryOptions) grpc.UnaryClientInterceptor {
+	opt = opt.withDefaults()
+
+	return func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption) error {
+
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		for attempt := 1; attempt < opt.MaxAttempts; attempt++ {
+			if !opt.retryable(status.Code(err)) {
+				return err
+			}
+
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(opt.backoff(attempt)):
+			}
+
+			err = invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		return err
+	}
+}
+
+// TimeoutUnaryInterceptor bounds each call with the timeout. A call context
+// with an earlier deadline keeps it. The interceptor does nothing if the
+// timeout is zero.
+func TimeoutUnaryInterceptor(timeout time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption) error {
+
+		if timeout <= 0 {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
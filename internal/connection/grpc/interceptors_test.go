@@ -0,0 +1,254 @@
+package grpc_test
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/planetfall/gateway/internal/connection/grpc"
+	"github.com/planetfall/gateway/internal/requestid"
+	"github.com/stretchr/testify/assert"
+	grpcG "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcMetadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// invokerFake records the calls, and answers with the given errors in order.
+// The last error is repeated.
+type invokerFake struct {
+	errs  []error
+	calls int
+	ctxs  []context.Context
+}
+
+func (f *invokerFake) invoke(ctx context.Context, method string,
+	req, reply interface{}, cc *grpcG.ClientConn,
+	opts ...grpcG.CallOption) error {
+
+	f.ctxs = append(f.ctxs, ctx)
+	err := f.errs[len(f.errs)-1]
+	if f.calls < len(f.errs) {
+		err = f.errs[f.calls]
+	}
+	f.calls++
+
+	return err
+}
+
+func TestRequestIDUnaryInterceptor(t *testing.T) {
+	// given
+	invoker := &invokerFake{errs: []error{nil}}
+	interceptor := grpc.RequestIDUnaryInterceptor()
+	ctxGiven := requestid.NewContext(context.Background(), "request-id")
+
+	// when
+	err := interceptor(ctxGiven, "/svc/Method", nil, nil, nil, invoker.invoke)
+
+	// then
+	assert.Nil(t, err)
+	md, found := grpcMetadata.FromOutgoingContext(invoker.ctxs[0])
+	assert.True(t, found)
+	assert.Equal(t, []string{"request-id"}, md[requestid.MetadataKey])
+}
+
+func TestRequestIDUnaryInterceptor_withoutRequestID(t *testing.T) {
+	// given
+	invoker := &invokerFake{errs: []error{nil}}
+	interceptor := grpc.RequestIDUnaryInterceptor()
+
+	// when
+	err := interceptor(
+		context.Background(), "/svc/Method", nil, nil, nil, invoker.invoke)
+
+	// then
+	assert.Nil(t, err)
+	_, found := grpcMetadata.FromOutgoingContext(invoker.ctxs[0])
+	assert.False(t, found)
+}
+
+func TestLoggingUnaryInterceptor(t *testing.T) {
+	// given
+	var buf bytes.Buffer
+	errGiven := status.Error(codes.NotFound, "test not found")
+	invoker := &invokerFake{errs: []error{errGiven}}
+	interceptor := grpc.LoggingUnaryInterceptor(log.New(&buf, "", 0))
+	ctxGiven := requestid.NewContext(context.Background(), "request-id")
+
+	// when
+	err := interceptor(ctxGiven, "/svc/Method", nil, nil, nil, invoker.invoke)
+
+	// then
+	assert.Equal(t, errGiven, err)
+	assert.Contains(t, buf.String(), "[request-id] grpc /svc/Method: NotFound")
+	assert.Contains(t, buf.String(), "test not found")
+}
+
+func TestRetryUnaryInterceptor(t *testing.T) {
+	// given
+	unavailable := status.Error(codes.Unavailable, "test unavailable")
+	invoker := &invokerFake{errs: []error{unavailable, unavailable, nil}}
+	interceptor := grpc.RetryUnaryInterceptor(grpc.RetryOptions{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+	})
+
+	// when
+	err := interceptor(
+		context.Background(), "/svc/Method", nil, nil, nil, invoker.invoke)
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, 3, invoker.calls)
+}
+
+func TestRetryUnaryInterceptor_withMaxAttempts(t *testing.T) {
+	// given
+	unavailable := status.Error(codes.Unavailable, "test unavailable")
+	invoker := &invokerFake{errs: []error{unavailable}}
+	interceptor := grpc.RetryUnaryInterceptor(grpc.RetryOptions{
+		MaxAttempts:    2,
+		InitialBackoff: time.Millisecond,
+	})
+
+	// when
+	err := interceptor(
+		context.Background(), "/svc/Method", nil, nil, nil, invoker.invoke)
+
+	// then
+	assert.Equal(t, unavailable, err)
+	assert.Equal(t, 2, invoker.calls)
+}
+
+func TestRetryUnaryInterceptor_withNotRetryableCode(t *testing.T) {
+	// given
+	errGiven := status.Error(codes.InvalidArgument, "test invalid")
+	invoker := &invokerFake{errs: []error{errGiven}}
+	interceptor := grpc.RetryUnaryInterceptor(grpc.RetryOptions{
+		MaxAttempts: 3,
+	})
+
+	// when
+	err := interceptor(
+		context.Background(), "/svc/Method", nil, nil, nil, invoker.invoke)
+
+	// then
+	assert.Equal(t, errGiven, err)
+	assert.Equal(t, 1, invoker.calls)
+}
+
+func TestRetryUnaryInterceptor_withContextDone(t *testing.T) {
+	// given
+	unavailable := status.Error(codes.Unavailable, "test unavailable")
+	invoker := &invokerFake{errs: []error{unavailable}}
+	interceptor := grpc.RetryUnaryInterceptor(grpc.RetryOptions{
+		MaxAttempts:    3,
+		InitialBackoff: time.Minute,
+	})
+	ctxGiven, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// when
+	err := interceptor(ctxGiven, "/svc/Method", nil, nil, nil, invoker.invoke)
+
+	// then
+	assert.Equal(t, unavailable, err)
+	assert.Equal(t, 1, invoker.calls)
+}
+
+func TestRetryUnaryInterceptor_withCodes(t *testing.T) {
+	// given
+	deadline := status.Error(codes.DeadlineExceeded, "test deadline")
+	invoker := &invokerFake{errs: []error{deadline, nil}}
+	interceptor := grpc.RetryUnaryInterceptor(grpc.RetryOptions{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		Codes:          []codes.Code{codes.DeadlineExceeded},
+	})
+
+	// when
+	err := interceptor(
+		context.Background(), "/svc/Method", nil, nil, nil, invoker.invoke)
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, 2, invoker.calls)
+}
+
+func TestRetryUnaryInterceptor_withExponentialBackoff(t *testing.T) {
+	// given
+	unavailable := status.Error(codes.Unavailable, "test unavailable")
+	invoker := &invokerFake{errs: []error{unavailable}}
+	interceptor := grpc.RetryUnaryInterceptor(grpc.RetryOptions{
+		MaxAttempts:    4,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     40 * time.Millisecond,
+		Multiplier:     3,
+		Jitter:         0.01,
+	})
+
+	// when
+	before := time.Now()
+	err := interceptor(
+		context.Background(), "/svc/Method", nil, nil, nil, invoker.invoke)
+	elapsed := time.Since(before)
+
+	// then
+	// waits for 10ms, 30ms, then 40ms as 90ms is over the max backoff
+	assert.Equal(t, unavailable, err)
+	assert.Equal(t, 4, invoker.calls)
+	assert.GreaterOrEqual(t, elapsed, 78*time.Millisecond)
+	assert.Less(t, elapsed, 500*time.Millisecond)
+}
+
+func TestTimeoutUnaryInterceptor(t *testing.T) {
+	// given
+	invoker := &invokerFake{errs: []error{nil}}
+	interceptor := grpc.TimeoutUnaryInterceptor(time.Second)
+
+	// when
+	before := time.Now()
+	err := interceptor(
+		context.Background(), "/svc/Method", nil, nil, nil, invoker.invoke)
+
+	// then
+	assert.Nil(t, err)
+	deadline, ok := invoker.ctxs[0].Deadline()
+	assert.True(t, ok)
+	assert.WithinDuration(t, before.Add(time.Second), deadline,
+		100*time.Millisecond)
+}
+
+func TestTimeoutUnaryInterceptor_withEarlierDeadline(t *testing.T) {
+	// given
+	invoker := &invokerFake{errs: []error{nil}}
+	interceptor := grpc.TimeoutUnaryInterceptor(time.Minute)
+	ctxGiven, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	deadlineGiven, _ := ctxGiven.Deadline()
+
+	// when
+	err := interceptor(ctxGiven, "/svc/Method", nil, nil, nil, invoker.invoke)
+
+	// then
+	assert.Nil(t, err)
+	deadline, _ := invoker.ctxs[0].Deadline()
+	assert.Equal(t, deadlineGiven, deadline)
+}
+
+func TestTimeoutUnaryInterceptor_withZeroTimeout(t *testing.T) {
+	// given
+	invoker := &invokerFake{errs: []error{nil}}
+	interceptor := grpc.TimeoutUnaryInterceptor(0)
+
+	// when
+	err := interceptor(
+		context.Background(), "/svc/Method", nil, nil, nil, invoker.invoke)
+
+	// then
+	assert.Nil(t, err)
+	_, ok := invoker.ctxs[0].Deadline()
+	assert.False(t, ok)
+}
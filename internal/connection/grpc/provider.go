@@ -2,14 +2,12 @@ package grpc
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"fmt"
 
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/api/idtoken"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
 // Provider is responsible to provide new instances of:
@@ -20,27 +18,28 @@ type Provider interface {
 	// NewTokenSource builds a new token source instance.
 	NewTokenSource(audience string, insecure bool) (TokenSource, error)
 
-	// NewClient builds a new GRPC client connection
-	NewClient(target string, insecure bool) (*grpc.ClientConn, error)
+	// NewClient builds a new GRPC client connection, with the transport
+	// credentials and the additional dial options
+	NewClient(target string, creds credentials.TransportCredentials,
+		opts ...grpc.DialOption) (*grpc.ClientConn, error)
 }
 
 // The default provider implementation
 type providerImpl struct {
 }
 
-// NewClient creates a new GRPC connection.
-// It retrieves transport credentials if insecure is false.
-func (p *providerImpl) NewClient(
-	target string, insecure bool) (*grpc.ClientConn, error) {
-
-	creds, err := p.newCredentials(insecure)
-	if err != nil {
-		return nil, fmt.Errorf("getCredentials: %v", err)
-	}
+// NewClient creates a new GRPC connection, using the transport credentials.
+// The calls are traced, and the W3C trace context is propagated as outgoing
+// metadata.
+func (p *providerImpl) NewClient(target string,
+	creds credentials.TransportCredentials,
+	opts ...grpc.DialOption) (*grpc.ClientConn, error) {
 
 	dialOpts := []grpc.DialOption{
 		grpc.WithTransportCredentials(creds),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
 	}
+	dialOpts = append(dialOpts, opts...)
 	client, err := grpc.Dial(target, dialOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("grpc.Dial: %v", err)
@@ -49,26 +48,6 @@ func (p *providerImpl) NewClient(
 	return client, nil
 }
 
-// newCredentials provides transport credentials according to the isInsecure
-// argument:
-//   - if true, it use the [insecure] library to provide empty credentials
-//   - else, it will provide valid TLS transport credentials
-func (p *providerImpl) newCredentials(isInsecure bool) (credentials.TransportCredentials, error) {
-	if isInsecure {
-		return insecure.NewCredentials(), nil
-	}
-
-	systemRoots, err := x509.SystemCertPool()
-	if err != nil {
-		return nil, fmt.Errorf("x509.SystemCertPool: %v", err)
-	}
-	creds := credentials.NewTLS(&tls.Config{
-		RootCAs: systemRoots,
-	})
-
-	return creds, nil
-}
-
 // NewTokenSource builds a new source which provides authentication tokens.
 // The audience is the target service host that we need authentication for.
 // This is reused from the [Cloud Run] documentation
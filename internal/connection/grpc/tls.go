@@ -0,0 +1,96 @@
+package grpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// TLSOptions holds the TLS parameters of a connection. The zero value
+// verifies the server with the system roots.
+type TLSOptions struct {
+	// The PEM bundle of the CA certificates verifying the server, the system
+	// roots are used if empty
+	CAFile string
+
+	// The PEM client certificate and key, for mutual TLS. Both or none are
+	// set.
+	CertFile string
+	KeyFile  string
+
+	// The name verified in the server certificate, the target host if empty
+	ServerName string
+}
+
+// isSet tells if any TLS parameter is set
+func (opt TLSOptions) isSet() bool {
+	return opt != TLSOptions{}
+}
+
+// newTransportCredentials provides transport credentials according to the
+// isInsecure argument:
+//   - if true, it use the [insecure] library to provide empty credentials.
+//     The TLS options must be empty.
+//   - else, it will provide valid TLS transport credentials, configured with
+//     the TLS options
+func newTransportCredentials(isInsecure bool,
+	opt TLSOptions) (credentials.TransportCredentials, error) {
+
+	if isInsecure {
+		if opt.isSet() {
+			return nil, fmt.Errorf("TLS options set on an insecure connection")
+		}
+		return insecure.NewCredentials(), nil
+	}
+
+	roots, err := opt.rootCAs()
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		RootCAs:    roots,
+		ServerName: opt.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if opt.CertFile != "" || opt.KeyFile != "" {
+		if opt.CertFile == "" || opt.KeyFile == "" {
+			return nil, fmt.Errorf("both client certificate and key are needed")
+		}
+		cert, err := tls.LoadX509KeyPair(opt.CertFile, opt.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls.LoadX509KeyPair: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return credentials.NewTLS(config), nil
+}
+
+// rootCAs provides the CA bundle if set, else the system roots
+func (opt TLSOptions) rootCAs() (*x509.CertPool, error) {
+	if opt.CAFile == "" {
+		systemRoots, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("x509.SystemCertPool: %v", err)
+		}
+		return systemRoots, nil
+	}
+
+	pem, err := os.ReadFile(opt.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile: %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", opt.CAFile)
+	}
+
+	return roots, nil
+}
@@ -0,0 +1,227 @@
+package grpc_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/planetfall/gateway/internal/connection/grpc"
+	"github.com/stretchr/testify/assert"
+	grpcG "google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// certFiles are PEM files of a certificate and its key
+type certFiles struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM string
+	keyPEM  string
+}
+
+// newCert issues a certificate for the DNS name, signed by the parent. The
+// certificate is self signed, and is a CA, if the parent is nil.
+func newCert(t *testing.T, name string, parent *certFiles) *certFiles {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(
+		rand.Reader, template, signer, &key.PublicKey, signerKey)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	dir := t.TempDir()
+	files := &certFiles{
+		cert:    cert,
+		key:     key,
+		certPEM: filepath.Join(dir, "cert.pem"),
+		keyPEM:  filepath.Join(dir, "key.pem"),
+	}
+	assert.Nil(t, os.WriteFile(files.certPEM, pem.EncodeToMemory(
+		&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.Nil(t, os.WriteFile(files.keyPEM, pem.EncodeToMemory(
+		&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	return files
+}
+
+// newMutualTLSServer starts a health server, requiring a client certificate
+// signed by the CA.
+func newMutualTLSServer(t *testing.T, ca, server *certFiles) string {
+	serverCert, err := tls.LoadX509KeyPair(server.certPEM, server.keyPEM)
+	assert.Nil(t, err)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	creds := credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	srv := grpcG.NewServer(grpcG.Creds(creds))
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	return lis.Addr().String()
+}
+
+func TestNewConnection_withMutualTLS(t *testing.T) {
+	// given
+	ca := newCert(t, "ca.test", nil)
+	server := newCert(t, "backend.test", ca)
+	client := newCert(t, "gateway.test", ca)
+	target := newMutualTLSServer(t, ca, server)
+
+	c, err := grpc.NewConnection(grpc.ConnectionOptions{
+		Target: target,
+		Auth:   grpc.AuthOptions{Mode: grpc.AuthNone},
+		TLS: grpc.TLSOptions{
+			CAFile:     ca.certPEM,
+			CertFile:   client.certPEM,
+			KeyFile:    client.keyPEM,
+			ServerName: "backend.test",
+		},
+	})
+	assert.Nil(t, err)
+	defer c.Close()
+
+	// when
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := healthpb.NewHealthClient(c.Client()).Check(
+		ctx, &healthpb.HealthCheckRequest{})
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, res.GetStatus())
+}
+
+func TestNewConnection_withoutClientCertificate_shouldFailCalls(t *testing.T) {
+	// given
+	ca := newCert(t, "ca.test", nil)
+	server := newCert(t, "backend.test", ca)
+	target := newMutualTLSServer(t, ca, server)
+
+	c, err := grpc.NewConnection(grpc.ConnectionOptions{
+		Target: target,
+		Auth:   grpc.AuthOptions{Mode: grpc.AuthNone},
+		TLS: grpc.TLSOptions{
+			CAFile:     ca.certPEM,
+			ServerName: "backend.test",
+		},
+	})
+	assert.Nil(t, err)
+	defer c.Close()
+
+	// when
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = healthpb.NewHealthClient(c.Client()).Check(
+		ctx, &healthpb.HealthCheckRequest{})
+
+	// then
+	assert.NotNil(t, err)
+}
+
+func TestNewConnection_withServerName(t *testing.T) {
+	// given
+	ca := newCert(t, "ca.test", nil)
+	providerGiven := &providerMock{}
+	providerGiven.
+		On("NewClient", "10.0.0.1:443", "tls").
+		Return(&grpcG.ClientConn{}, nil)
+
+	// when
+	_, err := grpc.NewConnection(grpc.ConnectionOptions{
+		Target:   "10.0.0.1:443",
+		Provider: providerGiven,
+		Auth:     grpc.AuthOptions{Mode: grpc.AuthNone},
+		TLS: grpc.TLSOptions{
+			CAFile:     ca.certPEM,
+			ServerName: "backend.test",
+		},
+	})
+
+	// then
+	assert.Nil(t, err)
+	providerGiven.AssertExpectations(t)
+	assert.Equal(t, "backend.test", providerGiven.creds.Info().ServerName)
+}
+
+func TestNewConnection_withInvalidTLS_shouldFail(t *testing.T) {
+	// given
+	ca := newCert(t, "ca.test", nil)
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	assert.Nil(t, os.WriteFile(notPEM, []byte("not a certificate"), 0600))
+
+	optsGiven := map[string]grpc.ConnectionOptions{
+		"insecure connection": {
+			Insecure: true,
+			TLS:      grpc.TLSOptions{CAFile: ca.certPEM},
+		},
+		"both client certificate and key": {
+			TLS: grpc.TLSOptions{CertFile: ca.certPEM},
+		},
+		"tls.LoadX509KeyPair": {
+			TLS: grpc.TLSOptions{CertFile: ca.certPEM, KeyFile: ca.certPEM},
+		},
+		"os.ReadFile": {
+			TLS: grpc.TLSOptions{CAFile: "missing.pem"},
+		},
+		"no certificate found": {
+			TLS: grpc.TLSOptions{CAFile: notPEM},
+		},
+	}
+
+	for errExpected, optGiven := range optsGiven {
+		optGiven.Target = "target"
+		optGiven.Auth = grpc.AuthOptions{Mode: grpc.AuthNone}
+
+		// when
+		c, err := grpc.NewConnection(optGiven)
+
+		// then
+		assert.Nil(t, c)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), errExpected)
+	}
+}
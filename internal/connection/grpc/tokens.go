@@ -0,0 +1,213 @@
+package grpc
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// The authentication modes of a connection
+const (
+	// AuthGoogle authenticates with a Google ID token, whose audience is
+	// built from the target. It is the default mode.
+	AuthGoogle = "google"
+
+	// AuthStatic authenticates with a static bearer token, read from a file
+	// or an environment variable
+	AuthStatic = "static"
+
+	// AuthNone does not authenticate the calls
+	AuthNone = "none"
+)
+
+// DefaultEarlyRefresh is the time before the token expiry when it is
+// refreshed in the background, when unset. The Google ID tokens last an
+// hour.
+const DefaultEarlyRefresh = 5 * time.Minute
+
+// AuthOptions holds the authentication parameters of a connection
+type AuthOptions struct {
+	// The authentication mode, AuthGoogle if empty
+	Mode string
+
+	// The audience of the Google ID token, built from the target if empty
+	Audience string
+
+	// The file holding the static token
+	TokenFile string
+
+	// The environment variable holding the static token, used if no file
+	// is set
+	TokenEnv string
+
+	// The time before the token expiry when it is refreshed,
+	// DefaultEarlyRefresh if zero
+	EarlyRefresh time.Duration
+}
+
+func (opt AuthOptions) getMode() string {
+	if opt.Mode == "" {
+		return AuthGoogle
+	}
+
+	return opt.Mode
+}
+
+func (opt AuthOptions) getEarlyRefresh() time.Duration {
+	if opt.EarlyRefresh <= 0 {
+		return DefaultEarlyRefresh
+	}
+
+	return opt.EarlyRefresh
+}
+
+// newTokenSource provides the token source of the authentication mode. It
+// is nil if the calls are not authenticated.
+func (opt ConnectionOptions) newTokenSource(
+	provider Provider) (TokenSource, error) {
+
+	switch opt.Auth.getMode() {
+	case AuthNone:
+		return nil, nil
+	case AuthStatic:
+		return newStaticTokenSource(opt.Auth)
+	case AuthGoogle:
+		audience := opt.Auth.Audience
+		if audience == "" {
+			audience = buildAudienceFromTarget(opt.Target)
+		}
+		tokenSource, err := provider.NewTokenSource(audience, opt.Insecure)
+		if err != nil {
+			return nil, fmt.Errorf("provider.NewTokenSource: %v", err)
+		}
+		if tokenSource == nil {
+			return nil, nil
+		}
+		return NewCachedTokenSource(
+			tokenSource, opt.Auth.getEarlyRefresh()), nil
+	default:
+		return nil, fmt.Errorf("unknown auth mode %q", opt.Auth.Mode)
+	}
+}
+
+// newStaticTokenSource reads the static token, from the file if set, else
+// from the environment variable.
+func newStaticTokenSource(opt AuthOptions) (TokenSource, error) {
+	var token string
+	switch {
+	case opt.TokenFile != "":
+		b, err := os.ReadFile(opt.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("os.ReadFile: %v", err)
+		}
+		token = string(b)
+	case opt.TokenEnv != "":
+		token = os.Getenv(opt.TokenEnv)
+	default:
+		return nil, fmt.Errorf("static auth needs a token file or variable")
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, fmt.Errorf("static token is empty")
+	}
+
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}), nil
+}
+
+// expiryDelta is the time before its expiry when a token is no longer
+// provided, so it does not expire during the call. It matches the
+// [oauth2.Token] one.
+const expiryDelta = 10 * time.Second
+
+// cachedTokenSource keeps the token until it expires. Once the token is
+// about to expire, it is still provided while a new one is fetched in the
+// background, so the calls do not wait for the refresh.
+type cachedTokenSource struct {
+	src          TokenSource
+	earlyRefresh time.Duration
+
+	mu         sync.Mutex
+	token      *oauth2.Token
+	refreshing bool
+}
+
+// NewCachedTokenSource wraps a token source with a cache. The token is
+// refreshed in the background when its expiry is closer than the early
+// refresh duration. A token without expiry is never refreshed.
+//
+// The source may already reuse its tokens, as the Google ID token source
+// does until 10 seconds before their expiry: it is then made to fetch a new
+// token within the early refresh duration, else the refresh would get the
+// same token back.
+func NewCachedTokenSource(
+	src TokenSource, earlyRefresh time.Duration) TokenSource {
+
+	return &cachedTokenSource{
+		src:          oauth2.ReuseTokenSourceWithExpiry(nil, src, earlyRefresh),
+		earlyRefresh: earlyRefresh,
+	}
+}
+
+// usable tells if the token can still be provided. The tokens of the source
+// are not valid anymore within the early refresh duration, they are still
+// provided while refreshed.
+func usable(token *oauth2.Token) bool {
+	return token != nil && token.AccessToken != "" &&
+		(token.Expiry.IsZero() || time.Until(token.Expiry) > expiryDelta)
+}
+
+// Token provides the cached token if it is still valid, else it fetches a
+// new one.
+func (s *cachedTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	token := s.token
+	if usable(token) {
+		if s.expiresSoon(token) && !s.refreshing {
+			s.refreshing = true
+			go s.refresh()
+		}
+		s.mu.Unlock()
+		return token, nil
+	}
+	s.mu.Unlock()
+
+	token, err := s.src.Token()
+	if err != nil {
+		return nil, err
+	}
+	s.store(token)
+
+	return token, nil
+}
+
+// expiresSoon tells if the token is to be refreshed
+func (s *cachedTokenSource) expiresSoon(token *oauth2.Token) bool {
+	return !token.Expiry.IsZero() &&
+		time.Until(token.Expiry) < s.earlyRefresh
+}
+
+// refresh fetches a new token in the background. On error, the cached
+// token is kept, and the refresh is tried again on the next call.
+func (s *cachedTokenSource) refresh() {
+	token, err := s.src.Token()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refreshing = false
+	if err == nil {
+		s.token = token
+	}
+}
+
+func (s *cachedTokenSource) store(token *oauth2.Token) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.token = token
+}
@@ -0,0 +1,205 @@
+package grpc_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/planetfall/gateway/internal/connection/grpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/oauth2"
+	grpcG "google.golang.org/grpc"
+)
+
+// tokenSourceFake provides a new token on each call, expiring after the
+// given lifetime.
+type tokenSourceFake struct {
+	mu       sync.Mutex
+	calls    int
+	lifetime time.Duration
+	err      error
+}
+
+func (s *tokenSourceFake) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &oauth2.Token{
+		AccessToken: fmt.Sprintf("token-%d", s.calls),
+		Expiry:      time.Now().Add(s.lifetime),
+	}, nil
+}
+
+func (s *tokenSourceFake) getCalls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func TestNewCachedTokenSource(t *testing.T) {
+	// given
+	srcGiven := &tokenSourceFake{lifetime: time.Hour}
+	ts := grpc.NewCachedTokenSource(srcGiven, time.Minute)
+
+	// when
+	first, err := ts.Token()
+	assert.Nil(t, err)
+	second, err := ts.Token()
+	assert.Nil(t, err)
+
+	// then
+	assert.Equal(t, "token-1", first.AccessToken)
+	assert.Equal(t, first, second)
+	assert.Equal(t, 1, srcGiven.getCalls())
+}
+
+func TestNewCachedTokenSource_withEarlyRefresh(t *testing.T) {
+	// given
+	srcGiven := &tokenSourceFake{lifetime: 30 * time.Second}
+	ts := grpc.NewCachedTokenSource(srcGiven, time.Minute)
+
+	first, err := ts.Token()
+	assert.Nil(t, err)
+
+	// when
+	second, err := ts.Token()
+	assert.Nil(t, err)
+
+	// then
+	// the token about to expire is still provided, while refreshed
+	assert.Equal(t, first, second)
+	assert.Eventually(t, func() bool {
+		token, err := ts.Token()
+		return err == nil && token.AccessToken != first.AccessToken
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestNewCachedTokenSource_withExpiredToken(t *testing.T) {
+	// given
+	srcGiven := &tokenSourceFake{lifetime: -time.Second}
+	ts := grpc.NewCachedTokenSource(srcGiven, time.Minute)
+
+	// when
+	_, err := ts.Token()
+	assert.Nil(t, err)
+	token, err := ts.Token()
+
+	// then
+	assert.Nil(t, err)
+	assert.Equal(t, "token-2", token.AccessToken)
+}
+
+func TestNewCachedTokenSource_withError(t *testing.T) {
+	// given
+	srcGiven := &tokenSourceFake{err: fmt.Errorf("test token error")}
+	ts := grpc.NewCachedTokenSource(srcGiven, time.Minute)
+
+	// when
+	_, err := ts.Token()
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "test token error")
+}
+
+func TestNewConnection_withAuthNone(t *testing.T) {
+	// given
+	providerGiven := &providerMock{}
+	providerGiven.
+		On("NewClient", "target", "tls").
+		Return(&grpcG.ClientConn{}, nil)
+
+	optGiven := grpc.ConnectionOptions{
+		Target:   "target",
+		Provider: providerGiven,
+		Auth:     grpc.AuthOptions{Mode: grpc.AuthNone},
+	}
+
+	// when
+	c, err := grpc.NewConnection(optGiven)
+
+	// then
+	assert.Nil(t, err)
+	assert.NotNil(t, c)
+	providerGiven.AssertNotCalled(t, "NewTokenSource", mock.Anything, false)
+}
+
+func TestNewConnection_withAuthStatic(t *testing.T) {
+	// given
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.Nil(t, os.WriteFile(tokenFile, []byte("fake-token\n"), 0600))
+	t.Setenv("TEST_GATEWAY_TOKEN", "fake-token")
+
+	authsGiven := []grpc.AuthOptions{
+		{Mode: grpc.AuthStatic, TokenFile: tokenFile},
+		{Mode: grpc.AuthStatic, TokenEnv: "TEST_GATEWAY_TOKEN"},
+	}
+
+	for _, authGiven := range authsGiven {
+		// when
+		c, err := grpc.NewConnection(grpc.ConnectionOptions{
+			Target:   "localhost:8080",
+			Insecure: true,
+			Auth:     authGiven,
+		})
+
+		// then
+		assert.Nil(t, err)
+		assert.Nil(t, c.Close())
+	}
+}
+
+func TestNewConnection_withInvalidAuth_shouldFail(t *testing.T) {
+	authsGiven := map[string]grpc.AuthOptions{
+		"unknown auth mode": {Mode: "unknown"},
+		"token file or var": {Mode: grpc.AuthStatic},
+		"static token is empty": {
+			Mode: grpc.AuthStatic, TokenEnv: "TEST_GATEWAY_EMPTY_TOKEN"},
+		"os.ReadFile": {Mode: grpc.AuthStatic, TokenFile: "missing"},
+	}
+
+	for errExpected, authGiven := range authsGiven {
+		// when
+		c, err := grpc.NewConnection(grpc.ConnectionOptions{
+			Target:   "target",
+			Insecure: true,
+			Auth:     authGiven,
+		})
+
+		// then
+		assert.Nil(t, c)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), errExpected)
+	}
+}
+
+func TestNewCachedTokenSource_withReuseTokenSource(t *testing.T) {
+	// given
+	// the source reuses its tokens until 10 seconds before their expiry,
+	// as the Google ID token source does
+	srcGiven := &tokenSourceFake{lifetime: 30 * time.Second}
+	ts := grpc.NewCachedTokenSource(
+		oauth2.ReuseTokenSource(nil, srcGiven), time.Minute)
+
+	first, err := ts.Token()
+	assert.Nil(t, err)
+
+	// when
+	second, err := ts.Token()
+	assert.Nil(t, err)
+
+	// then
+	assert.Equal(t, first.AccessToken, second.AccessToken)
+	assert.Eventually(t, func() bool {
+		token, err := ts.Token()
+		return err == nil && token.AccessToken == "token-2"
+	}, time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StatusClientClosedRequest is the non standard status used when the client
+// went away before the response was ready.
+const StatusClientClosedRequest = 499
+
+// backendResponse describes how the controller answers a backend gRPC status.
+type backendResponse struct {
+	// the HTTP status
+	status int
+
+	// the error code sent back
+	code ErrorCode
+
+	// the gRPC status message is safe to send back as detail
+	detail bool
+
+	// the status is a server fault, reported to the service
+	report bool
+}
+
+// backendResponses maps the gRPC codes to their response. The codes missing
+// from this map are answered as internal errors.
+var backendResponses = map[codes.Code]backendResponse{
+	codes.InvalidArgument: {
+		http.StatusBadRequest, CodeInvalidParameters, true, false},
+	codes.OutOfRange: {
+		http.StatusBadRequest, CodeInvalidParameters, true, false},
+	codes.FailedPrecondition: {
+		http.StatusBadRequest, CodeInvalidParameters, true, false},
+	codes.NotFound: {
+		http.StatusNotFound, CodeNotFound, true, false},
+	codes.AlreadyExists: {
+		http.StatusConflict, CodeConflict, true, false},
+	codes.Aborted: {
+		http.StatusConflict, CodeConflict, true, false},
+	codes.ResourceExhausted: {
+		http.StatusTooManyRequests, CodeRateLimited, false, false},
+	codes.Canceled: {
+		StatusClientClosedRequest, CodeRequestCanceled, false, false},
+	codes.DeadlineExceeded: {
+		http.StatusGatewayTimeout, CodeBackendTimeout, false, false},
+	codes.Unavailable: {
+		http.StatusServiceUnavailable, CodeBackendUnavailable, false, false},
+	codes.Unimplemented: {
+		http.StatusNotImplemented, CodeNotImplemented, false, true},
+	codes.Unauthenticated: {
+		http.StatusBadGateway, CodeBackendFailure, false, true},
+	codes.PermissionDenied: {
+		http.StatusBadGateway, CodeBackendFailure, false, true},
+}
+
+// retryAfter retrieves the time the client should wait before trying again,
+// if the error tells it, such as an open circuit breaker.
+func retryAfter(err error) (time.Duration, bool) {
+	var ra interface{ RetryAfter() time.Duration }
+	if !errors.As(err, &ra) {
+		return 0, false
+	}
+
+	return ra.RetryAfter(), true
+}
+
+// grpcStatus retrieves the gRPC status wrapped by the error, if any.
+func grpcStatus(err error) (*status.Status, bool) {
+	var gs interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &gs) || gs.GRPCStatus() == nil {
+		return nil, false
+	}
+
+	return gs.GRPCStatus(), true
+}
+
+// internalResponse is the response of the errors which are not a known gRPC
+// status.
+var internalResponse = backendResponse{
+	http.StatusInternalServerError, CodeInternal, false, true}
+
+// backendResponseOf translates the error of a backend gRPC call into its
+// response, and provides the detail safe to send back.
+func backendResponseOf(err error) (backendResponse, string) {
+	st, ok := grpcStatus(err)
+	if !ok {
+		return internalResponse, ""
+	}
+
+	res, exists := backendResponses[st.Code()]
+	if !exists {
+		return internalResponse, ""
+	}
+
+	if !res.detail {
+		return res, ""
+	}
+
+	return res, st.Message()
+}
+
+// BackendError answers an error returned by a backend gRPC call.
+// The gRPC status code is translated into a matching HTTP status, and the
+// status message is sent back as detail when it is safe to.
+//
+// Only the server faults are reported, the other errors are logged. The
+// errors which are not a gRPC status are answered as internal errors.
+//
+// If the error tells when the backend can be called again, the time is sent
+// back in seconds in the Retry-After header.
+func (c *Controller) BackendError(err error, g *gin.Context) {
+
+	if d, ok := retryAfter(err); ok {
+		g.Header("Retry-After",
+			strconv.Itoa(int(math.Ceil(d.Seconds()))))
+	}
+
+	res, detail := backendResponseOf(err)
+	if res.report {
+		c.logAndReport(err, g, res.status, res.code, detail)
+		return
+	}
+
+	c.log(err, g, res.status, res.code, detail)
+}
+
+// BackendItemError provides the ItemError of a batch item whose backend
+// gRPC call failed. The error is translated as BackendError does it: only
+// the server faults are reported, the other errors are logged.
+func (c *Controller) BackendItemError(err error, g *gin.Context) *ItemError {
+
+	res, detail := backendResponseOf(err)
+	item := c.logItem(err, g, res.status, res.code, detail)
+	if res.report {
+		c.report(err, g, res.code)
+	}
+
+	return item
+}
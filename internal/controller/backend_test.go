@@ -0,0 +1,198 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	connection "github.com/planetfall/gateway/internal/connection/grpc"
+	"github.com/planetfall/gateway/internal/controller"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBackendError(t *testing.T) {
+	// given
+	statusesGiven := map[codes.Code]int{
+		codes.InvalidArgument:   http.StatusBadRequest,
+		codes.NotFound:          http.StatusNotFound,
+		codes.ResourceExhausted: http.StatusTooManyRequests,
+		codes.Canceled:          controller.StatusClientClosedRequest,
+		codes.DeadlineExceeded:  http.StatusGatewayTimeout,
+		codes.Unavailable:       http.StatusServiceUnavailable,
+		codes.Unauthenticated:   http.StatusBadGateway,
+		codes.Internal:          http.StatusInternalServerError,
+		codes.Unknown:           http.StatusInternalServerError,
+	}
+
+	for codeGiven, statusExpected := range statusesGiven {
+		writerGiven := httptest.NewRecorder()
+		ginContextGiven, _ := gin.CreateTestContext(writerGiven)
+
+		c := &controller.Controller{
+			Logger:      log.Default(),
+			ReportError: func(err error) {},
+		}
+
+		// when
+		errorGiven := fmt.Errorf("client.Search: %w",
+			status.Error(codeGiven, "test status error"))
+		c.BackendError(errorGiven, ginContextGiven)
+
+		// then
+		assert.Equal(t, statusExpected, writerGiven.Code, codeGiven)
+	}
+}
+
+func TestBackendError_withDetails(t *testing.T) {
+	// given
+	writerGiven := httptest.NewRecorder()
+	ginContextGiven, _ := gin.CreateTestContext(writerGiven)
+
+	reportedGiven := false
+	c := &controller.Controller{
+		Logger:      log.Default(),
+		ReportError: func(err error) { reportedGiven = true },
+	}
+
+	// when
+	errorGiven := fmt.Errorf("client.Search: %w",
+		status.Error(codes.InvalidArgument, "limit must be positive"))
+	c.BackendError(errorGiven, ginContextGiven)
+
+	// then
+	assert.Equal(t, http.StatusBadRequest, writerGiven.Code)
+	assert.False(t, reportedGiven)
+
+	var body map[string]interface{}
+	err := json.Unmarshal(writerGiven.Body.Bytes(), &body)
+	assert.Nil(t, err)
+	assert.Equal(t, "limit must be positive", body["detail"])
+	assert.Equal(t, string(controller.CodeInvalidParameters), body["code"])
+}
+
+func TestBackendError_withServerFault_shouldReport(t *testing.T) {
+	// given
+	writerGiven := httptest.NewRecorder()
+	ginContextGiven, _ := gin.CreateTestContext(writerGiven)
+
+	reportedGiven := false
+	c := &controller.Controller{
+		Logger:      log.Default(),
+		ReportError: func(err error) { reportedGiven = true },
+	}
+
+	// when
+	errorGiven := status.Error(codes.Internal, "secret stack trace")
+	c.BackendError(errorGiven, ginContextGiven)
+
+	// then
+	assert.Equal(t, http.StatusInternalServerError, writerGiven.Code)
+	assert.True(t, reportedGiven)
+	assert.NotContains(t, writerGiven.Body.String(), "secret")
+}
+
+func TestBackendError_withUnavailable_shouldNotReport(t *testing.T) {
+	// given
+	writerGiven := httptest.NewRecorder()
+	ginContextGiven, _ := gin.CreateTestContext(writerGiven)
+
+	reportedGiven := false
+	c := &controller.Controller{
+		Logger:      log.Default(),
+		ReportError: func(err error) { reportedGiven = true },
+	}
+
+	// when
+	errorGiven := status.Error(codes.Unavailable, "connection refused")
+	c.BackendError(errorGiven, ginContextGiven)
+
+	// then
+	assert.Equal(t, http.StatusServiceUnavailable, writerGiven.Code)
+	assert.False(t, reportedGiven)
+	assert.NotContains(t, writerGiven.Body.String(), "refused")
+}
+
+func TestBackendError_withNonStatusError(t *testing.T) {
+	// given
+	writerGiven := httptest.NewRecorder()
+	ginContextGiven, _ := gin.CreateTestContext(writerGiven)
+
+	reportedGiven := false
+	c := &controller.Controller{
+		Logger:      log.Default(),
+		ReportError: func(err error) { reportedGiven = true },
+	}
+
+	// when
+	c.BackendError(fmt.Errorf("test error"), ginContextGiven)
+
+	// then
+	assert.Equal(t, http.StatusInternalServerError, writerGiven.Code)
+	assert.True(t, reportedGiven)
+}
+
+func TestBackendError_withBreakerOpen(t *testing.T) {
+	// given
+	writerGiven := httptest.NewRecorder()
+	ginContextGiven, _ := gin.CreateTestContext(writerGiven)
+
+	c := &controller.Controller{
+		Logger:      log.Default(),
+		ReportError: func(err error) {},
+	}
+
+	breaker := connection.NewBreaker(connection.BreakerOptions{
+		FailureThreshold: 1,
+		OpenTimeout:      90 * time.Second,
+	})
+	done, _ := breaker.Allow()
+	done(status.Error(codes.Unavailable, "test unavailable"))
+	_, errBreaker := breaker.Allow()
+
+	// when
+	c.BackendError(fmt.Errorf("client.Search: %w", errBreaker), ginContextGiven)
+
+	// then
+	assert.Equal(t, http.StatusServiceUnavailable, writerGiven.Code)
+	assert.Equal(t, "90", writerGiven.Header().Get("Retry-After"))
+}
+
+func TestBackendItemError(t *testing.T) {
+	// given
+	writerGiven := httptest.NewRecorder()
+	ginContextGiven, _ := gin.CreateTestContext(writerGiven)
+
+	reportedGiven := 0
+	c := &controller.Controller{
+		Logger:      log.Default(),
+		ReportError: func(err error) { reportedGiven++ },
+	}
+
+	// when
+	invalidActual := c.BackendItemError(fmt.Errorf("client.Search: %w",
+		status.Error(codes.InvalidArgument, "limit must be positive")),
+		ginContextGiven)
+	internalActual := c.BackendItemError(
+		status.Error(codes.Internal, "secret stack trace"), ginContextGiven)
+
+	// then
+	assert.Equal(t, &controller.ItemError{
+		Status: http.StatusBadRequest,
+		Title:  "Wrong parameters supplied",
+		Detail: "limit must be positive",
+		Code:   controller.CodeInvalidParameters,
+	}, invalidActual)
+	assert.Equal(t, http.StatusInternalServerError, internalActual.Status)
+	assert.Empty(t, internalActual.Detail)
+	assert.Equal(t, 1, reportedGiven)
+
+	// nothing is sent back
+	assert.Empty(t, writerGiven.Body.String())
+}
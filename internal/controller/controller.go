@@ -4,13 +4,25 @@ package controller
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"strconv"
 	"time"
+
+	"github.com/gin-gonic/gin"
 )
 
 // The defaut context timeout
 const DefaultTimeout = 10 * time.Second
 
+// The default upper bound of a client supplied timeout
+const DefaultMaxTimeout = 30 * time.Second
+
+// TimeoutHeader is the request header a client can use to set its own
+// deadline. It holds a duration, such as "1.5s" or "500ms", or a count of
+// milliseconds.
+const TimeoutHeader = "X-Request-Timeout"
+
 // Controller is a base type for actual controllers.
 // It is a common base and holds some behavior like error handling and
 // context management
@@ -28,6 +40,17 @@ type Controller struct {
 	// The logger to use for the controller. Having a logger per controller
 	// allows to split and easily filters the console output.
 	Logger *log.Logger
+
+	// Timeout is the request context timeout, when neither the client nor
+	// the route set one.
+	Timeout time.Duration
+
+	// MaxTimeout bounds the timeout a client can ask for.
+	MaxTimeout time.Duration
+
+	// RouteTimeouts holds the timeouts of specific routes, using the route
+	// full path as key.
+	RouteTimeouts map[string]time.Duration
 }
 
 // ControllerOptions holds the base parameters needed to build a Controller
@@ -43,6 +66,15 @@ type ControllerOptions struct {
 
 	// Logger builder parameter
 	Logger *log.Logger
+
+	// Timeout builder parameter (optional)
+	Timeout time.Duration
+
+	// MaxTimeout builder parameter (optional)
+	MaxTimeout time.Duration
+
+	// RouteTimeouts builder parameter (optional)
+	RouteTimeouts map[string]time.Duration
 }
 
 // NewController builds a new controller. It setup a new logger using the
@@ -50,10 +82,13 @@ type ControllerOptions struct {
 func NewController(opt ControllerOptions) Controller {
 
 	return Controller{
-		name:        opt.Name,
-		Target:      opt.Target,
-		ReportError: opt.ReportError,
-		Logger:      opt.Logger,
+		name:          opt.Name,
+		Target:        opt.Target,
+		ReportError:   opt.ReportError,
+		Logger:        opt.Logger,
+		Timeout:       opt.Timeout,
+		MaxTimeout:    opt.MaxTimeout,
+		RouteTimeouts: opt.RouteTimeouts,
 	}
 }
 
@@ -61,6 +96,13 @@ func (c *Controller) Name() string {
 	return c.name
 }
 
+// RequestLogger provides a logger tagging each line with the correlation ID
+// of the request, so the lines of a request can be told apart.
+func (c *Controller) RequestLogger(g *gin.Context) *log.Logger {
+	prefix := fmt.Sprintf("%s[%s] ", c.Logger.Prefix(), CorrelationID(g))
+	return log.New(c.Logger.Writer(), prefix, c.Logger.Flags())
+}
+
 // GetContext is a wrapper around context.WithTimeout, with a default timeout
 // value. An optional custom timeout value can be provided. Only the first
 // custom timeout value will be used. If more than one parameter is given, it
@@ -74,3 +116,67 @@ func (c *Controller) GetContext(
 	}
 	return context.WithTimeout(context.Background(), t)
 }
+
+// RouteTimeout provides the timeout of the request route, regardless of the
+// client: the route timeout from RouteTimeouts, else the controller Timeout,
+// or the DefaultTimeout.
+func (c *Controller) RouteTimeout(g *gin.Context) time.Duration {
+	if routeTimeout, exists := c.RouteTimeouts[g.FullPath()]; exists {
+		return routeTimeout
+	}
+
+	if c.Timeout <= 0 {
+		return DefaultTimeout
+	}
+
+	return c.Timeout
+}
+
+// RequestContext derives a context from the incoming request, so it is
+// canceled when the client goes away. Its timeout is, by priority:
+//   - the client TimeoutHeader value, bounded by the MaxTimeout
+//   - the route timeout from RouteTimeouts
+//   - the controller Timeout, or the DefaultTimeout
+//
+// An error is returned if the TimeoutHeader value cannot be parsed.
+func (c *Controller) RequestContext(
+	g *gin.Context) (context.Context, context.CancelFunc, error) {
+
+	t := c.RouteTimeout(g)
+
+	if header := g.GetHeader(TimeoutHeader); header != "" {
+		clientTimeout, err := parseTimeout(header)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid %s header: %v",
+				TimeoutHeader, err)
+		}
+
+		maxTimeout := c.MaxTimeout
+		if maxTimeout <= 0 {
+			maxTimeout = DefaultMaxTimeout
+		}
+		t = min(clientTimeout, maxTimeout)
+	}
+
+	ctx, cancel := context.WithTimeout(g.Request.Context(), t)
+	return ctx, cancel, nil
+}
+
+// parseTimeout reads a timeout, given either as a duration, or as a count of
+// milliseconds.
+func parseTimeout(value string) (time.Duration, error) {
+	t, err := time.ParseDuration(value)
+	if err != nil {
+		ms, errMs := strconv.ParseUint(value, 10, 32)
+		if errMs != nil {
+			return 0, fmt.Errorf("time.ParseDuration: %v", err)
+		}
+		t = time.Duration(ms) * time.Millisecond
+	}
+
+	if t <= 0 {
+		return 0, fmt.Errorf("timeout must be positive, got %v", t)
+	}
+
+	return t, nil
+}
@@ -1,12 +1,16 @@
 package controller_test
 
 import (
+	"bytes"
 	"context"
 	"log"
 	"math"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/planetfall/gateway/internal/controller"
 	"github.com/stretchr/testify/assert"
 )
@@ -76,3 +80,158 @@ func TestGetContextAndWait_withCustomTimeout(t *testing.T) {
 	time.Sleep(waitTime)
 	assert.Equal(t, context.DeadlineExceeded, ctx.Err())
 }
+
+// serveRequestContext serves the request through an engine, so the route
+// full path is set, and returns the context built by RequestContext.
+func serveRequestContext(t *testing.T, c *controller.Controller,
+	req *http.Request) (context.Context, context.CancelFunc, error) {
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	var err error
+
+	w := httptest.NewRecorder()
+	_, engine := gin.CreateTestContext(w)
+	engine.GET("/controller/route", func(g *gin.Context) {
+		ctx, cancel, err = c.RequestContext(g)
+	})
+	engine.ServeHTTP(w, req)
+
+	return ctx, cancel, err
+}
+
+func TestRequestContext(t *testing.T) {
+	// given
+	c := &controller.Controller{}
+	req := httptest.NewRequest(http.MethodGet, "/controller/route", nil)
+
+	// when
+	ctx, cancel, err := serveRequestContext(t, c, req)
+	assert.Nil(t, err)
+	defer cancel()
+
+	// then
+	deadline, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.WithinDuration(t,
+		time.Now().Add(controller.DefaultTimeout), deadline, time.Second)
+}
+
+func TestRequestContext_withClientCancel(t *testing.T) {
+	// given
+	c := &controller.Controller{}
+	reqCtx, reqCancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/controller/route", nil).
+		WithContext(reqCtx)
+
+	// when
+	ctx, cancel, err := serveRequestContext(t, c, req)
+	assert.Nil(t, err)
+	defer cancel()
+	reqCancel()
+
+	// then
+	assert.Equal(t, context.Canceled, ctx.Err())
+}
+
+func TestRequestContext_withRouteTimeout(t *testing.T) {
+	// given
+	c := &controller.Controller{
+		Timeout: 20 * time.Second,
+		RouteTimeouts: map[string]time.Duration{
+			"/controller/route": 2 * time.Second,
+		},
+	}
+	req := httptest.NewRequest(http.MethodGet, "/controller/route", nil)
+
+	// when
+	ctx, cancel, err := serveRequestContext(t, c, req)
+	assert.Nil(t, err)
+	defer cancel()
+
+	// then
+	deadline, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(2*time.Second), deadline,
+		500*time.Millisecond)
+}
+
+func TestRequestContext_withTimeoutHeader(t *testing.T) {
+	// given
+	c := &controller.Controller{}
+
+	headersGiven := map[string]time.Duration{
+		"1500ms": 1500 * time.Millisecond,
+		"2s":     2 * time.Second,
+		"3000":   3 * time.Second,
+	}
+
+	for headerGiven, timeoutExpected := range headersGiven {
+		req := httptest.NewRequest(http.MethodGet, "/controller/route", nil)
+		req.Header.Set(controller.TimeoutHeader, headerGiven)
+
+		// when
+		ctx, cancel, err := serveRequestContext(t, c, req)
+		assert.Nil(t, err)
+
+		// then
+		deadline, ok := ctx.Deadline()
+		assert.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(timeoutExpected), deadline,
+			500*time.Millisecond)
+		cancel()
+	}
+}
+
+func TestRequestContext_withTimeoutHeaderOverMax(t *testing.T) {
+	// given
+	c := &controller.Controller{
+		MaxTimeout: 5 * time.Second,
+	}
+	req := httptest.NewRequest(http.MethodGet, "/controller/route", nil)
+	req.Header.Set(controller.TimeoutHeader, "1h")
+
+	// when
+	ctx, cancel, err := serveRequestContext(t, c, req)
+	assert.Nil(t, err)
+	defer cancel()
+
+	// then
+	deadline, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(5*time.Second), deadline,
+		500*time.Millisecond)
+}
+
+func TestRequestContext_withInvalidTimeoutHeader_shouldFail(t *testing.T) {
+	// given
+	c := &controller.Controller{}
+
+	for _, headerGiven := range []string{"soon", "-2s", "0"} {
+		req := httptest.NewRequest(http.MethodGet, "/controller/route", nil)
+		req.Header.Set(controller.TimeoutHeader, headerGiven)
+
+		// when
+		_, _, err := serveRequestContext(t, c, req)
+
+		// then
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), controller.TimeoutHeader)
+	}
+}
+
+func TestRequestLogger(t *testing.T) {
+	// given
+	var buf bytes.Buffer
+	c := controller.NewController(controller.ControllerOptions{
+		Logger: log.New(&buf, "[NAME] ", 0),
+	})
+	ginContextGiven, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ginContextGiven.Set(controller.CorrelationIDKey, "request-id")
+
+	// when
+	c.RequestLogger(ginContextGiven).Println("message")
+
+	// then
+	assert.Equal(t, "[NAME] [request-id] message\n", buf.String())
+}
@@ -25,6 +25,11 @@ type DownloadController struct {
 	// The subscriber helper to pull Pub/Sub messages
 	sub subscriber.Subscriber
 
+	// Closed when the subscriber stops listening, listenErr then holds the
+	// reason
+	listenDone chan struct{}
+	listenErr  error
+
 	// The upgrader to upgrade HTTP request to websocket
 	websocket websocket.Websocket
 
@@ -56,6 +61,13 @@ type DownloadControllerOptions struct {
 	// websockets
 	Origins []string
 
+	// The I/O buffer sizes of the websocket upgrader
+	ReadBufferSize  int
+	WriteBufferSize int
+
+	// The options for the upgraded websocket connections
+	ConnOptions websocket.ConnOptions
+
 	// Custom provider
 	Provider Provider
 }
@@ -69,7 +81,8 @@ func (opt DownloadControllerOptions) getProvider() Provider {
 }
 
 // NewDownloadController builds a new DownloadController.
-// It setup the task client and the Pub/Sub helper.
+// It setup the websocket upgrader, the task client and the Pub/Sub helper.
+// If one of them fails, the ones already set up are closed.
 func NewDownloadController(
 	opt DownloadControllerOptions) (*DownloadController, error) {
 
@@ -79,11 +92,28 @@ func NewDownloadController(
 	// setup the download controller
 	downloadCtrl := &DownloadController{
 		Controller: ctrl,
+		listenDone: make(chan struct{}),
 	}
 
 	// retrieve the provider
 	provider := opt.getProvider()
 
+	// setup the websocket upgrader, first as it only checks the options
+	ws, err := provider.NewWebsocket(websocket.WebsocketOptions{
+		Origins:         opt.Origins,
+		ReadBufferSize:  opt.ReadBufferSize,
+		WriteBufferSize: opt.WriteBufferSize,
+		ConnOptions:     opt.ConnOptions,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("provider.NewWebsocket: %v", err)
+	}
+	downloadCtrl.websocket = ws
+
+	// setup the websocket store
+	store := provider.NewWebsocketStore()
+	downloadCtrl.websocketStore = store
+
 	// setup the task client
 
 	// builds the task queue path
@@ -106,31 +136,45 @@ func NewDownloadController(
 		opt.ControllerOptions.Logger,
 	)
 	if err != nil {
+		if err := taskClient.Close(); err != nil {
+			ctrl.Logger.Println(fmt.Errorf("cloudtasks.Close: %v", err))
+		}
 		return nil, fmt.Errorf("provider.NewSubscriber: %v", err)
 	}
 
 	// starts listening for pubsub messages
 	go func() {
-		if err := sub.Listen(); err != nil {
+		defer close(downloadCtrl.listenDone)
+
+		err := sub.Listen()
+		if err != nil {
 			ctrl.Logger.Println(fmt.Errorf("subscriber.Listen: %v", err))
 		}
+		downloadCtrl.listenErr = err
 	}()
 	downloadCtrl.sub = sub
 
-	// setup the websocket store
-	store := provider.NewWebsocketStore()
-	downloadCtrl.websocketStore = store
+	return downloadCtrl, nil
+}
 
-	// setup the websocket upgrader
-	ws, err := provider.NewWebsocket(
-		opt.Origins,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("provider.NewWebsocket: %v", err)
+// CheckHealth reports whether the subscriber is still listening for job
+// status, and whether the task client is usable.
+func (c *DownloadController) CheckHealth() controller.Health {
+	select {
+	case <-c.listenDone:
+		if c.listenErr != nil {
+			return controller.Down(
+				"subscriber stopped listening: %v", c.listenErr)
+		}
+		return controller.Down("subscriber stopped listening")
+	default:
 	}
-	downloadCtrl.websocket = ws
 
-	return downloadCtrl, nil
+	if err := c.taskClient.Check(); err != nil {
+		return controller.Down("task client unusable: %v", err)
+	}
+
+	return controller.Up("subscriber listening")
 }
 
 // Close closes the task client and the Pub/Sub helper
@@ -1,12 +1,17 @@
 package download_test
 
 import (
+	"fmt"
 	"log"
 	"testing"
+	"time"
 
 	"github.com/planetfall/gateway/internal/controller"
 	"github.com/planetfall/gateway/internal/controller/download"
+	"github.com/planetfall/gateway/internal/controller/download/mocks"
+	"github.com/planetfall/gateway/internal/controller/download/websocket"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestNewDownloadController(t *testing.T) {
@@ -45,3 +50,120 @@ func TestClose(t *testing.T) {
 	err = c.Close()
 	assert.Nil(t, err)
 }
+
+func TestNewDownloadController_withWebsocketError_shouldFail(t *testing.T) {
+	// given
+	providerGiven := &mocks.ProviderMock{}
+	providerGiven.On("NewWebsocket").
+		Return((*mocks.WebsocketMock)(nil), fmt.Errorf("test websocket error"))
+
+	// when
+	c, err := download.NewDownloadController(download.DownloadControllerOptions{
+		Provider: providerGiven,
+		ControllerOptions: controller.ControllerOptions{
+			Logger: log.Default(),
+		},
+	})
+
+	// then
+	assert.Nil(t, c)
+	assert.Contains(t, err.Error(), "test websocket error")
+	providerGiven.AssertNotCalled(t, "NewTaskClient")
+	providerGiven.AssertNotCalled(t, "NewSubscriber")
+}
+
+func TestNewDownloadController_withSubscriberError_shouldClose(t *testing.T) {
+	// given
+	taskClientGiven := mocks.NewTaskClientMock().(*mocks.TaskClientMock)
+	taskClientGiven.On("Close").Return(nil)
+	providerGiven := &mocks.ProviderMock{}
+	providerGiven.On("NewWebsocket").Return(mocks.NewWebsocketMock(), nil)
+	providerGiven.On("NewWebsocketStore").Return(websocket.NewStore())
+	providerGiven.On("NewTaskClient").Return(taskClientGiven, nil)
+	providerGiven.On("NewSubscriber").
+		Return((*mocks.SubscriberMock)(nil), fmt.Errorf("test subscriber error"))
+
+	// when
+	c, err := download.NewDownloadController(download.DownloadControllerOptions{
+		Provider: providerGiven,
+		ControllerOptions: controller.ControllerOptions{
+			Logger: log.Default(),
+		},
+	})
+
+	// then
+	assert.Nil(t, c)
+	assert.Contains(t, err.Error(), "test subscriber error")
+	taskClientGiven.AssertCalled(t, "Close")
+}
+
+// newHealthController builds a controller whose subscriber listens until
+// the returned channel is closed, then fails with listenErr.
+func newHealthController(t *testing.T, listenErr error) (
+	*download.DownloadController, *mocks.TaskClientMock, chan struct{}) {
+
+	taskClientGiven := mocks.NewTaskClientMock().(*mocks.TaskClientMock)
+	subscriberGiven := mocks.NewSubscriberMock().(*mocks.SubscriberMock)
+	websocketGiven := mocks.NewWebsocketMock().(*mocks.WebsocketMock)
+	providerGiven := mocks.NewProviderMock(
+		taskClientGiven,
+		subscriberGiven,
+		websocketGiven,
+		websocket.NewStore()).(*mocks.ProviderMock)
+
+	stopListen := make(chan struct{})
+	subscriberGiven.On("Listen").
+		Run(func(mock.Arguments) { <-stopListen }).
+		Return(listenErr)
+
+	c, err := download.NewDownloadController(download.DownloadControllerOptions{
+		Provider: providerGiven,
+		ControllerOptions: controller.ControllerOptions{
+			Logger: log.Default(),
+		},
+	})
+	assert.Nil(t, err)
+
+	return c, taskClientGiven, stopListen
+}
+
+func TestCheckHealth(t *testing.T) {
+	// given
+	c, taskClientGiven, stopListen := newHealthController(t, nil)
+	defer close(stopListen)
+	taskClientGiven.On("Check").Return(nil)
+
+	// when
+	healthActual := c.CheckHealth()
+
+	// then
+	assert.True(t, healthActual.IsUp())
+}
+
+func TestCheckHealth_withListenStopped(t *testing.T) {
+	// given
+	c, _, stopListen := newHealthController(t, fmt.Errorf("test listen error"))
+
+	// when
+	close(stopListen)
+
+	// then
+	assert.Eventually(t, func() bool {
+		return !c.CheckHealth().IsUp()
+	}, time.Second, 10*time.Millisecond)
+	assert.Contains(t, c.CheckHealth().Reason, "test listen error")
+}
+
+func TestCheckHealth_withTaskClientClosed(t *testing.T) {
+	// given
+	c, taskClientGiven, stopListen := newHealthController(t, nil)
+	defer close(stopListen)
+	taskClientGiven.On("Check").Return(fmt.Errorf("task client closed"))
+
+	// when
+	healthActual := c.CheckHealth()
+
+	// then
+	assert.Equal(t, controller.HealthDown, healthActual.Status)
+	assert.Contains(t, healthActual.Reason, "task client closed")
+}
@@ -8,8 +8,18 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/planetfall/gateway/internal/controller/download/task"
 	"github.com/planetfall/gateway/internal/controller/download/websocket"
+	"github.com/planetfall/gateway/internal/metrics"
+	"github.com/planetfall/gateway/internal/requestid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// instrumentationName names the tracer of the download controller.
+const instrumentationName = "github.com/planetfall/gateway/internal/controller/download"
+
 // Download upgrades HTTP request to a websocket
 //
 //	@Summary		Download and save a new music file
@@ -27,7 +37,11 @@ func (c *DownloadController) Download(g *gin.Context) {
 		return
 	}
 
-	c.Logger.Println("upgraded to websocket")
+	// the request ID carried by this context is forwarded to the jobs
+	ctx := g.Request.Context()
+	logger := c.RequestLogger(g)
+
+	logger.Println("upgraded to websocket")
 
 	// register websocket
 	if err := c.websocketStore.Register(conn); err != nil {
@@ -39,29 +53,29 @@ func (c *DownloadController) Download(g *gin.Context) {
 
 		// unregister websocket
 		if err := c.websocketStore.Unregister(conn); err != nil {
-			c.Logger.Printf("store.Unregister: %v", err)
+			logger.Printf("store.Unregister: %v", err)
 		}
 
 		// close websocket
 		if err := conn.Close(); err != nil {
-			c.Logger.Printf("websocket.Close: %v", err)
+			logger.Printf("websocket.Close: %v", err)
 		}
 	}()
 
 	for {
 		// main loop
-		err := c.NewJob(conn)
+		err := c.NewJob(ctx, conn)
 
-		// check if ws closed
+		// check if ws closed, or evicted because it stopped answering
 		if c.websocket.IsClosed(err) {
-			c.Logger.Println("closed websocket")
+			logger.Printf("closed websocket: %v", err)
 			break
 		}
 
 		if err != nil {
-			c.Logger.Printf("download.Loop: %v", err)
+			logger.Printf("download.Loop: %v", err)
 			if err := websocket.WriteStatus(conn, websocket.StatusError, "failed to create new job", err.Error()); err != nil {
-				c.Logger.Println(fmt.Errorf("websocket.WriteStatus: %v", err))
+				logger.Println(fmt.Errorf("websocket.WriteStatus: %v", err))
 				return
 			}
 			continue
@@ -69,12 +83,16 @@ func (c *DownloadController) Download(g *gin.Context) {
 	}
 }
 
-func (c *DownloadController) NewJob(conn websocket.Conn) error {
+// NewJob reads a payload from the websocket, and creates its download task.
+// The request ID carried by the context is forwarded to the task.
+func (c *DownloadController) NewJob(
+	ctx context.Context, conn websocket.Conn) error {
 
 	// read current JSON
 	var payload task.Payload
 	if err := conn.ReadJSON(&payload); err != nil {
-		return fmt.Errorf("websocket.ReadJSON: %v", err)
+		// wrapped, so the handler can tell if the connection is closed
+		return fmt.Errorf("websocket.ReadJSON: %w", err)
 	}
 
 	jKey, err := c.websocketStore.AddNewJob(conn)
@@ -87,7 +105,7 @@ func (c *DownloadController) NewJob(conn websocket.Conn) error {
 		Payload: payload,
 		JobKey:  string(jKey),
 	}
-	createdTask, err := c.taskClient.CreateTask(taskPayload)
+	createdTask, err := c.taskClient.CreateTask(ctx, taskPayload)
 	if err != nil {
 		return fmt.Errorf("download.createTask: %v", err)
 	}
@@ -99,7 +117,9 @@ func (c *DownloadController) NewJob(conn websocket.Conn) error {
 		return fmt.Errorf("websocket.WriteStatus: %v", err)
 	}
 
-	c.Logger.Printf("created task %s", createdTask.Name)
+	// ties the job key to the request ID
+	id, _ := requestid.FromContext(ctx)
+	c.Logger.Printf("[%s] created task %s for job %s", id, createdTask.Name, jKey)
 	return nil
 }
 
@@ -108,34 +128,64 @@ func (c *DownloadController) NewJob(conn websocket.Conn) error {
 // The received message is parsed. Then, the calling websocket is retrieved in
 // the store using the job ordering key. The parsed message is written on this
 // websocket.
+//
+// The handling is traced within a consumer span, continuing the trace context
+// the job sets in the message attributes.
 func (c *DownloadController) OnReceive(
 	ctx context.Context, message *pubsub.Message) {
 
 	defer message.Ack()
+	metrics.MessagesReceived.Inc()
+
+	ctx = otel.GetTextMapPropagator().Extract(
+		ctx, propagation.MapCarrier(message.Attributes))
+	_, span := otel.Tracer(instrumentationName).Start(ctx, "pubsub.Receive",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(semconv.MessagingMessageID(message.ID)))
+	defer span.End()
+
+	if err := c.onReceive(span, message); err != nil {
+		c.Logger.Println(err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+func (c *DownloadController) onReceive(
+	span trace.Span, message *pubsub.Message) error {
 
 	// parse pMsg content
 	jobStatus, err := c.sub.NewJobStatus(message)
 	if err != nil {
-		c.Logger.Println(fmt.Errorf("subscriber.NewJobStatus: %v", err))
-		return
+		return fmt.Errorf("subscriber.NewJobStatus: %v", err)
 	}
+	metrics.MessagesParsed.Inc()
 
 	c.Logger.Printf("Received job status with key: %s | code: %d",
 		jobStatus.OrderingKey, jobStatus.Code)
+	span.SetAttributes(task.JobKeyAttribute.String(jobStatus.OrderingKey))
 
 	// retrieve the websocket using the message ordering key
 	orderingKey := websocket.Key(jobStatus.OrderingKey)
 	conn, err := c.websocketStore.GetWebsocket(orderingKey)
 	if err != nil {
-		c.Logger.Println(fmt.Errorf("store.GetWebsocket: %v", err))
-		return
+		metrics.MessagesUndeliverable.Inc()
+		return fmt.Errorf("store.GetWebsocket: %v", err)
 	}
 
 	// notify to ws
-	if err := websocket.WriteStatus(conn, websocket.StatusOK,
-		"job status update", jobStatus); err != nil {
-
-		c.Logger.Println(fmt.Errorf("websocket.WriteStatus: %v", err))
-		return
+	// in progress updates can be dropped if the client is too slow, the final
+	// status is always sent
+	if jobStatus.Finished() {
+		err = websocket.WriteStatus(conn, websocket.StatusOK,
+			"job status update", jobStatus)
+	} else {
+		err = websocket.WriteProgress(conn, "job status update", jobStatus)
 	}
+	if err != nil {
+		metrics.MessagesUndeliverable.Inc()
+		return fmt.Errorf("websocket.WriteStatus: %v", err)
+	}
+
+	return nil
 }
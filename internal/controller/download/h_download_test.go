@@ -67,6 +67,7 @@ func TestDownload(t *testing.T) {
 
 	wGiven := httptest.NewRecorder()
 	gGiven, _ := gin.CreateTestContext(wGiven)
+	gGiven.Request = httptest.NewRequest(http.MethodGet, "/download/url", nil)
 	c.Download(gGiven)
 
 	c.Close()
@@ -157,3 +158,55 @@ func TestDownload_withUpgradeError(t *testing.T) {
 
 	c.Download(gGiven)
 }
+
+func TestDownload_OnReceive_withFinishedJob_shouldKeepJob(t *testing.T) {
+	// given
+	taskClientGiven := mocks.NewTaskClientMock().(*mocks.TaskClientMock)
+	subscriberGiven := mocks.NewSubscriberMock().(*mocks.SubscriberMock)
+	websocketGiven := mocks.NewWebsocketMock().(*mocks.WebsocketMock)
+	storeGiven := websocket.NewStore()
+
+	providerGiven := mocks.NewProviderMock(
+		taskClientGiven,
+		subscriberGiven,
+		websocketGiven,
+		storeGiven).(*mocks.ProviderMock)
+
+	connGiven := mocks.NewConnMock().(*mocks.ConnMock)
+	addr := mocks.NewAddrMock("192.168.0.1")
+	connGiven.On("RemoteAddr").Return(addr)
+	connGiven.On("WriteJSON").Return(nil)
+	err := storeGiven.Register(connGiven)
+	assert.Nil(t, err)
+
+	key, err := storeGiven.AddNewJob(connGiven)
+	assert.Nil(t, err)
+
+	messageGiven := &pubsub.Message{}
+	jobStatusGiven := &subscriber.JobStatus{
+		OrderingKey: string(key),
+		Code:        200,
+	}
+	jobStatusGiven.Body.Progress = 100
+	subscriberGiven.On("NewJobStatus", messageGiven).Return(jobStatusGiven, nil)
+	subscriberGiven.On("Listen").Return(nil)
+
+	opt := download.DownloadControllerOptions{
+		Provider: providerGiven,
+		ControllerOptions: controller.ControllerOptions{
+			Logger: log.Default(),
+		},
+	}
+	c, err := download.NewDownloadController(opt)
+	assert.Nil(t, err)
+
+	// when
+	c.OnReceive(context.Background(), messageGiven)
+
+	// then
+	// the job key is kept until the websocket is unregistered
+	connGiven.AssertCalled(t, "WriteJSON")
+	ws, err := storeGiven.GetWebsocket(key)
+	assert.Nil(t, err)
+	assert.Equal(t, connGiven, ws)
+}
@@ -47,7 +47,7 @@ func (m *ProviderMock) NewSubscriber(
 }
 
 func (m *ProviderMock) NewWebsocket(
-	origins []string) (websocket.Websocket, error) {
+	opt websocket.WebsocketOptions) (websocket.Websocket, error) {
 
 	args := m.Called()
 	return args.Get(0).(websocket.Websocket), args.Error(1)
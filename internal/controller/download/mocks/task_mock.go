@@ -1,6 +1,8 @@
 package mocks
 
 import (
+	"context"
+
 	taskspb "cloud.google.com/go/cloudtasks/apiv2/cloudtaskspb"
 	"github.com/planetfall/gateway/internal/controller/download/task"
 	"github.com/stretchr/testify/mock"
@@ -15,12 +17,17 @@ type TaskClientMock struct {
 }
 
 func (m *TaskClientMock) CreateTask(
-	tPayload task.Task) (*taskspb.Task, error) {
+	ctx context.Context, tPayload task.Task) (*taskspb.Task, error) {
 
 	args := m.Called()
 	return args.Get(0).(*taskspb.Task), args.Error(1)
 }
 
+func (m *TaskClientMock) Check() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
 func (m *TaskClientMock) Close() error {
 	args := m.Called()
 	return args.Error(0)
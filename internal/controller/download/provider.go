@@ -29,9 +29,10 @@ type Provider interface {
 		logger *log.Logger) (subscriber.Subscriber, error)
 
 	// Builds a new websocket upgrader.
-	// It also set the authorized origins for upgrades.
+	// It also set the authorized origins for upgrades, and the options of the
+	// upgraded connections.
 	NewWebsocket(
-		origins []string) (websocket.Websocket, error)
+		opt websocket.WebsocketOptions) (websocket.Websocket, error)
 
 	// Builds a new websocket store.
 	NewWebsocketStore() websocket.Store
@@ -78,11 +79,8 @@ func (p *providerImpl) NewSubscriber(
 }
 
 func (p *providerImpl) NewWebsocket(
-	origins []string) (websocket.Websocket, error) {
+	opt websocket.WebsocketOptions) (websocket.Websocket, error) {
 
-	opt := websocket.WebsocketOptions{
-		Origins: origins,
-	}
 	return websocket.NewWebsocket(opt)
 }
 
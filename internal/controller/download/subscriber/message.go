@@ -3,6 +3,7 @@ package subscriber
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"strconv"
 
 	"cloud.google.com/go/pubsub"
@@ -31,6 +32,12 @@ type JobStatus struct {
 	OrderingKey string `json:"ordering_key"`
 }
 
+// Finished tells if the job reached a final state: either it is fully
+// progressed, or it failed.
+func (s *JobStatus) Finished() bool {
+	return s.Body.Progress >= 100 || s.Code >= http.StatusBadRequest
+}
+
 func (*subscriberImpl) NewJobStatus(
 	pMsg *pubsub.Message) (*JobStatus, error) {
 
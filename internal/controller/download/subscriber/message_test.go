@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"cloud.google.com/go/pubsub"
+	"github.com/planetfall/gateway/internal/controller/download/subscriber"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -98,3 +99,23 @@ func TestNewJobStatus_withNoStatus(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "message.Attributes: 'status' not found")
 }
+
+func TestFinished(t *testing.T) {
+	inProgressGiven := &subscriber.JobStatus{
+		Code: 200,
+		Body: subscriber.JobBody{Progress: 35},
+	}
+	assert.False(t, inProgressGiven.Finished())
+
+	doneGiven := &subscriber.JobStatus{
+		Code: 200,
+		Body: subscriber.JobBody{Progress: 100},
+	}
+	assert.True(t, doneGiven.Finished())
+
+	failedGiven := &subscriber.JobStatus{
+		Code: 500,
+		Body: subscriber.JobBody{Progress: 35},
+	}
+	assert.True(t, failedGiven.Finished())
+}
@@ -4,15 +4,32 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync/atomic"
 
 	taskspb "cloud.google.com/go/cloudtasks/apiv2/cloudtaskspb"
+	"github.com/planetfall/gateway/internal/metrics"
+	"github.com/planetfall/gateway/internal/requestid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// instrumentationName names the tracer of the task client.
+const instrumentationName = "github.com/planetfall/gateway/internal/controller/download/task"
+
+// JobKeyAttribute is the span attribute holding the job key.
+const JobKeyAttribute = attribute.Key("job.key")
+
 // taskClientImpl is the default implementation of the TaskClient
 type taskClientImpl struct {
 	client    Client
 	queuePath string
 	target    string
+
+	// set once the client is closed
+	closed atomic.Bool
 }
 
 // TaskClientOptions are the options for the TaskClient builder.
@@ -50,8 +67,31 @@ func NewTaskClient(opt TaskClientOptions) (TaskClient, error) {
 	}, nil
 }
 
+// CreateTask creates the task within a producer span. The span context is
+// forwarded to the job with the task headers.
 func (t *taskClientImpl) CreateTask(
-	tPayload Task) (*taskspb.Task, error) {
+	ctx context.Context, tPayload Task) (*taskspb.Task, error) {
+
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx,
+		"cloudtasks.CreateTask",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(JobKeyAttribute.String(tPayload.JobKey)))
+	defer span.End()
+
+	createdTask, err := t.createTask(ctx, tPayload)
+	if err != nil {
+		metrics.TasksCreated.WithLabelValues(metrics.ResultError).Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	metrics.TasksCreated.WithLabelValues(metrics.ResultSuccess).Inc()
+	return createdTask, nil
+}
+
+func (t *taskClientImpl) createTask(
+	ctx context.Context, tPayload Task) (*taskspb.Task, error) {
 
 	// json encode
 	body, err := json.Marshal(&tPayload)
@@ -59,9 +99,8 @@ func (t *taskClientImpl) CreateTask(
 		return nil, fmt.Errorf("json.Marshal: %v", err)
 	}
 
-	req := t.newCreateTaskRequest(body)
+	req := t.newCreateTaskRequest(ctx, body)
 
-	ctx := context.Background()
 	createdTask, err := t.client.CreateTask(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("cloudtasks.CreateTask: %v", err)
@@ -70,7 +109,18 @@ func (t *taskClientImpl) CreateTask(
 	return createdTask, nil
 }
 
-func (t *taskClientImpl) newCreateTaskRequest(body []byte) *taskspb.CreateTaskRequest {
+// newCreateTaskRequest builds the task request. The request ID and the trace
+// context carried by the context, if any, are forwarded to the job as headers.
+func (t *taskClientImpl) newCreateTaskRequest(
+	ctx context.Context, body []byte) *taskspb.CreateTaskRequest {
+
+	headers := map[string]string{
+		"Content-Type": "application/json",
+	}
+	if id, ok := requestid.FromContext(ctx); ok {
+		headers[requestid.Header] = id
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(headers))
 
 	return &taskspb.CreateTaskRequest{
 		Parent: t.queuePath,
@@ -80,15 +130,23 @@ func (t *taskClientImpl) newCreateTaskRequest(body []byte) *taskspb.CreateTaskRe
 					HttpMethod: taskspb.HttpMethod_POST,
 					Url:        t.target,
 					Body:       body,
-					Headers: map[string]string{
-						"Content-Type": "application/json",
-					},
+					Headers:    headers,
 				},
 			},
 		},
 	}
 }
 
+// Check returns an error once the client is closed.
+func (t *taskClientImpl) Check() error {
+	if t.closed.Load() {
+		return fmt.Errorf("task client closed")
+	}
+
+	return nil
+}
+
 func (t *taskClientImpl) Close() error {
+	t.closed.Store(true)
 	return t.client.Close()
 }
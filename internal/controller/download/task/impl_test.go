@@ -1,13 +1,19 @@
 package task_test
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
 	taskspb "cloud.google.com/go/cloudtasks/apiv2/cloudtaskspb"
 	"github.com/planetfall/gateway/internal/controller/download/task"
 	"github.com/planetfall/gateway/internal/controller/download/task/mocks"
+	"github.com/planetfall/gateway/internal/requestid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestCreateTask_withClientError(t *testing.T) {
@@ -23,7 +29,7 @@ func TestCreateTask_withClientError(t *testing.T) {
 
 	errorGiven := fmt.Errorf("failed to create task")
 	clientGiven := mocks.NewClientMock().(*mocks.ClientMock)
-	clientGiven.On("CreateTask").Return(&taskspb.Task{}, errorGiven)
+	clientGiven.On("CreateTask", mock.Anything).Return(&taskspb.Task{}, errorGiven)
 
 	providerGiven := mocks.NewProviderMock(clientGiven).(*mocks.ProviderMock)
 	queuePathGiven := "queue-path"
@@ -36,7 +42,7 @@ func TestCreateTask_withClientError(t *testing.T) {
 	})
 	assert.Nil(t, err)
 
-	_, err = taskClient.CreateTask(taskGiven)
+	_, err = taskClient.CreateTask(context.Background(), taskGiven)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "cloudtasks.CreateTask")
 }
@@ -57,7 +63,7 @@ func TestCreateTask(t *testing.T) {
 	}
 
 	clientGiven := mocks.NewClientMock().(*mocks.ClientMock)
-	clientGiven.On("CreateTask").Return(taskCreatedGiven, nil)
+	clientGiven.On("CreateTask", mock.Anything).Return(taskCreatedGiven, nil)
 
 	providerGiven := mocks.NewProviderMock(clientGiven).(*mocks.ProviderMock)
 	queuePathGiven := "queue-path"
@@ -70,8 +76,86 @@ func TestCreateTask(t *testing.T) {
 	})
 	assert.Nil(t, err)
 
-	taskCreatedActual, err := taskClient.CreateTask(taskGiven)
+	taskCreatedActual, err := taskClient.CreateTask(context.Background(), taskGiven)
 	assert.Nil(t, err)
 
 	assert.Equal(t, taskCreatedGiven.Name, taskCreatedActual.Name)
 }
+
+func TestCreateTask_withRequestID(t *testing.T) {
+	taskGiven := task.Task{
+		JobKey: "key",
+	}
+
+	clientGiven := mocks.NewClientMock().(*mocks.ClientMock)
+	clientGiven.On("CreateTask", mock.Anything).
+		Return(&taskspb.Task{Name: "task-name"}, nil)
+
+	providerGiven := mocks.NewProviderMock(clientGiven).(*mocks.ProviderMock)
+
+	taskClient, err := task.NewTaskClient(task.TaskClientOptions{
+		QueuePath: "queue-path",
+		Target:    "target",
+		Provider:  providerGiven,
+	})
+	assert.Nil(t, err)
+
+	ctxGiven := requestid.NewContext(context.Background(), "request-id")
+	_, err = taskClient.CreateTask(ctxGiven, taskGiven)
+	assert.Nil(t, err)
+
+	req := clientGiven.Calls[0].Arguments.Get(0).(*taskspb.CreateTaskRequest)
+	headers := req.GetTask().GetHttpRequest().GetHeaders()
+	assert.Equal(t, "request-id", headers[requestid.Header])
+	assert.Equal(t, "application/json", headers["Content-Type"])
+}
+
+func TestCreateTask_withTraceContext(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	clientGiven := mocks.NewClientMock().(*mocks.ClientMock)
+	clientGiven.On("CreateTask", mock.Anything).
+		Return(&taskspb.Task{Name: "task-name"}, nil)
+
+	providerGiven := mocks.NewProviderMock(clientGiven).(*mocks.ProviderMock)
+
+	taskClient, err := task.NewTaskClient(task.TaskClientOptions{
+		QueuePath: "queue-path",
+		Target:    "target",
+		Provider:  providerGiven,
+	})
+	assert.Nil(t, err)
+
+	traceIDGiven, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanIDGiven, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctxGiven := trace.ContextWithSpanContext(context.Background(),
+		trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    traceIDGiven,
+			SpanID:     spanIDGiven,
+			TraceFlags: trace.FlagsSampled,
+		}))
+	_, err = taskClient.CreateTask(ctxGiven, task.Task{JobKey: "key"})
+	assert.Nil(t, err)
+
+	req := clientGiven.Calls[0].Arguments.Get(0).(*taskspb.CreateTaskRequest)
+	headers := req.GetTask().GetHttpRequest().GetHeaders()
+	assert.Contains(t, headers["traceparent"], traceIDGiven.String())
+}
+
+func TestCheck(t *testing.T) {
+	clientGiven := mocks.NewClientMock().(*mocks.ClientMock)
+	clientGiven.On("Close").Return(nil)
+	providerGiven := mocks.NewProviderMock(clientGiven).(*mocks.ProviderMock)
+
+	taskClient, err := task.NewTaskClient(task.TaskClientOptions{
+		Provider: providerGiven,
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, taskClient.Check())
+
+	assert.Nil(t, taskClient.Close())
+
+	err = taskClient.Check()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "closed")
+}
@@ -20,7 +20,7 @@ func NewClientMock() task.Client {
 func (m *ClientMock) CreateTask(ctx context.Context,
 	req *taskspb.CreateTaskRequest, opts ...gax.CallOption) (*taskspb.Task, error) {
 
-	args := m.Called()
+	args := m.Called(req)
 	return args.Get(0).(*taskspb.Task), args.Error(1)
 }
 
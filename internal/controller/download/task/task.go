@@ -30,8 +30,12 @@ type Client interface {
 type TaskClient interface {
 
 	// CreateTask creates a new task from the given payload.
-	// It returns the created task.
-	CreateTask(tPayload Task) (*taskspb.Task, error)
+	// It returns the created task. The request ID carried by the context is
+	// forwarded to the job.
+	CreateTask(ctx context.Context, tPayload Task) (*taskspb.Task, error)
+
+	// Check returns an error if the client can no longer create tasks.
+	Check() error
 
 	// Close closes the client
 	Close() error
@@ -30,6 +30,19 @@ type StatusBody struct {
 	Status  Status      `json:"status"`
 	Message string      `json:"message"`
 	Body    interface{} `json:"body"`
+
+	// progress updates can be dropped when the client is too slow
+	progress bool
+}
+
+// droppable is implemented by the payloads which can be dropped from an
+// outbound queue.
+type droppable interface {
+	isDroppable() bool
+}
+
+func (s *StatusBody) isDroppable() bool {
+	return s.progress
 }
 
 func WriteStatus(conn Conn, status Status, message string, body interface{}) error {
@@ -45,3 +58,20 @@ func WriteStatus(conn Conn, status Status, message string, body interface{}) err
 
 	return nil
 }
+
+// WriteProgress writes a progress update. Unlike WriteStatus, the update may
+// be dropped in favor of newer ones if the client does not keep up.
+func WriteProgress(conn Conn, message string, body interface{}) error {
+	payload := StatusBody{
+		Status:   StatusOK,
+		Message:  message,
+		Body:     body,
+		progress: true,
+	}
+
+	if err := conn.WriteJSON(&payload); err != nil {
+		return fmt.Errorf("connection.WriteJSON: %v", err)
+	}
+
+	return nil
+}
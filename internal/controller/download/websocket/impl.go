@@ -1,22 +1,48 @@
 package websocket
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 
 	ws "github.com/gorilla/websocket"
 )
 
 type WebsocketOptions struct {
+	// The origins allowed to upgrade
 	Origins []string
+
+	// The I/O buffer sizes of the upgrader, in bytes
+	ReadBufferSize  int
+	WriteBufferSize int
+
+	// The options for each upgraded connection
+	ConnOptions ConnOptions
 }
 
 type websocketImpl struct {
 	upgrader ws.Upgrader
+	connOpt  ConnOptions
 }
 
+// The default I/O buffer size of the upgrader
+const DefaultBufferSize = 1024
+
 func NewWebsocket(opt WebsocketOptions) (Websocket, error) {
 
+	connOpt := opt.ConnOptions.withDefaults()
+	if err := connOpt.validate(); err != nil {
+		return nil, fmt.Errorf("invalid connection options: %v", err)
+	}
+
+	if opt.ReadBufferSize <= 0 {
+		opt.ReadBufferSize = DefaultBufferSize
+	}
+	if opt.WriteBufferSize <= 0 {
+		opt.WriteBufferSize = DefaultBufferSize
+	}
+
 	checkOrigins := func(r *http.Request) bool {
 		origin := r.Header.Get("Origin")
 		// fixme
@@ -34,13 +60,14 @@ func NewWebsocket(opt WebsocketOptions) (Websocket, error) {
 	}
 
 	upgrader := ws.Upgrader{
-		WriteBufferSize: 1024,
-		ReadBufferSize:  1024,
+		WriteBufferSize: opt.WriteBufferSize,
+		ReadBufferSize:  opt.ReadBufferSize,
 		CheckOrigin:     checkOrigins,
 	}
 
 	return &websocketImpl{
 		upgrader: upgrader,
+		connOpt:  connOpt,
 	}, nil
 }
 
@@ -52,12 +79,26 @@ func (w *websocketImpl) Upgrade(writer http.ResponseWriter, r *http.Request,
 		return nil, fmt.Errorf("upgrader.Upgrade: %v", err)
 	}
 
-	return conn, nil
+	// every write goes through the connection outbound queue
+	return NewConn(conn, w.connOpt), nil
 }
 
+// IsClosed checks if the error ends the connection: a close frame from the
+// client, an expired read deadline, a message over the read limit, or a
+// connection closed on our side.
 func (w *websocketImpl) IsClosed(err error) bool {
 
-	return ws.IsCloseError(err,
-		ws.CloseNormalClosure,
-		ws.CloseAbnormalClosure)
+	var closeErr *ws.CloseError
+	if errors.As(err, &closeErr) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, ws.ErrReadLimit) ||
+		errors.Is(err, ws.ErrCloseSent)
 }
@@ -0,0 +1,74 @@
+package websocket_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+	"github.com/planetfall/gateway/internal/controller/download/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWebsocket(t *testing.T) {
+	// given
+	optGiven := websocket.WebsocketOptions{
+		Origins: []string{"http://localhost:3000"},
+	}
+
+	// when
+	w, err := websocket.NewWebsocket(optGiven)
+
+	// then
+	assert.Nil(t, err)
+	assert.NotNil(t, w)
+}
+
+func TestNewWebsocket_withPingIntervalOverReadTimeout_shouldFail(t *testing.T) {
+	// given
+	optGiven := websocket.WebsocketOptions{
+		ConnOptions: websocket.ConnOptions{
+			PingInterval: 30 * time.Second,
+			ReadTimeout:  10 * time.Second,
+		},
+	}
+
+	// when
+	_, err := websocket.NewWebsocket(optGiven)
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "ping interval")
+}
+
+func TestIsClosed(t *testing.T) {
+	// given
+	w, err := websocket.NewWebsocket(websocket.WebsocketOptions{})
+	assert.Nil(t, err)
+
+	closedErrs := []error{
+		&ws.CloseError{Code: ws.CloseNormalClosure},
+		&ws.CloseError{Code: ws.CloseGoingAway},
+		fmt.Errorf("websocket.ReadJSON: %w",
+			&ws.CloseError{Code: ws.CloseAbnormalClosure}),
+		fmt.Errorf("websocket.ReadJSON: %w", os.ErrDeadlineExceeded),
+		fmt.Errorf("websocket.ReadJSON: %w", net.ErrClosed),
+		fmt.Errorf("websocket.ReadJSON: %w", ws.ErrReadLimit),
+	}
+	openErrs := []error{
+		nil,
+		&json.SyntaxError{},
+		fmt.Errorf("download.createTask: test error"),
+	}
+
+	// then
+	for _, errGiven := range closedErrs {
+		assert.True(t, w.IsClosed(errGiven), errGiven)
+	}
+	for _, errGiven := range openErrs {
+		assert.False(t, w.IsClosed(errGiven), errGiven)
+	}
+}
@@ -0,0 +1,358 @@
+package websocket
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+)
+
+// Socket is the low level websocket connection wrapped by a Conn.
+// The gorilla [ws.Conn] is an example of implementation. It does not support
+// concurrent writers.
+type Socket interface {
+	ReadJSON(v interface{}) error
+	WriteJSON(v interface{}) error
+	RemoteAddr() net.Addr
+	SetWriteDeadline(t time.Time) error
+	SetReadDeadline(t time.Time) error
+	SetReadLimit(limit int64)
+	SetPongHandler(h func(appData string) error)
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	Close() error
+}
+
+// SlowConsumerPolicy tells what to do when the outbound queue of a connection
+// is full.
+type SlowConsumerPolicy string
+
+const (
+	// DropOldest drops the oldest queued progress update to make room for the
+	// new message. If no progress update is queued, the connection is closed.
+	DropOldest SlowConsumerPolicy = "drop-oldest"
+
+	// CloseSlow closes the connection.
+	CloseSlow SlowConsumerPolicy = "close"
+)
+
+const (
+	// The default count of messages queued for a connection
+	DefaultQueueSize = 16
+
+	// The default time allowed to write a message to the client
+	DefaultWriteTimeout = 10 * time.Second
+
+	// The default time between two pings sent to the client
+	DefaultPingInterval = 30 * time.Second
+
+	// The default time allowed to the client to answer a ping
+	DefaultPongWait = 10 * time.Second
+
+	// The default time allowed between two frames received from the client
+	DefaultReadTimeout = 60 * time.Second
+
+	// The default maximum size of a message read from the client, in bytes
+	DefaultMaxMessageSize = 8192
+)
+
+// ConnOptions holds the parameters for the Conn builder.
+type ConnOptions struct {
+	// The maximum count of messages waiting to be written
+	QueueSize int
+
+	// The time allowed to write a message to the client
+	WriteTimeout time.Duration
+
+	// What to do when the queue is full
+	SlowConsumer SlowConsumerPolicy
+
+	// The period between two pings sent to the client
+	PingInterval time.Duration
+
+	// The time allowed to the client to answer a ping
+	PongWait time.Duration
+
+	// The time allowed between two frames received from the client, either
+	// messages or pongs
+	ReadTimeout time.Duration
+
+	// The maximum size in bytes of a message received from the client
+	MaxMessageSize int64
+}
+
+func (opt ConnOptions) withDefaults() ConnOptions {
+	if opt.QueueSize <= 0 {
+		opt.QueueSize = DefaultQueueSize
+	}
+	if opt.WriteTimeout <= 0 {
+		opt.WriteTimeout = DefaultWriteTimeout
+	}
+	if opt.SlowConsumer == "" {
+		opt.SlowConsumer = DropOldest
+	}
+	if opt.PingInterval <= 0 {
+		opt.PingInterval = DefaultPingInterval
+	}
+	if opt.PongWait <= 0 {
+		opt.PongWait = DefaultPongWait
+	}
+	if opt.ReadTimeout <= 0 {
+		opt.ReadTimeout = DefaultReadTimeout
+	}
+	if opt.MaxMessageSize <= 0 {
+		opt.MaxMessageSize = DefaultMaxMessageSize
+	}
+	return opt
+}
+
+// validate checks that the heartbeat can keep a healthy connection alive.
+func (opt ConnOptions) validate() error {
+	if opt.PingInterval >= opt.ReadTimeout {
+		return fmt.Errorf("ping interval %v must be lower than read timeout %v",
+			opt.PingInterval, opt.ReadTimeout)
+	}
+	if opt.PongWait >= opt.ReadTimeout {
+		return fmt.Errorf("pong wait %v must be lower than read timeout %v",
+			opt.PongWait, opt.ReadTimeout)
+	}
+	return nil
+}
+
+// outbound is a message waiting in the queue
+type outbound struct {
+	payload   interface{}
+	droppable bool
+}
+
+// pumpConn is a Conn which owns an outbound queue. The queue is drained by a
+// single writer goroutine, so writes from the HTTP handlers and from the
+// Pub/Sub receivers can never interleave on the socket.
+//
+// The writer goroutine also sends the pings. A client which does not answer
+// them, or stays silent longer than the read timeout, hits the read deadline:
+// its pending read fails, and the connection is evicted by its handler.
+type pumpConn struct {
+	socket Socket
+	opt    ConnOptions
+
+	mu           sync.Mutex
+	queue        []outbound
+	closed       bool
+	readDeadline time.Time
+
+	// wakes up the writer goroutine when a message is queued
+	wake chan struct{}
+
+	// stops the writer goroutine
+	done chan struct{}
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewConn wraps a socket into a Conn, sets up its read limit and deadline,
+// and starts its writer goroutine.
+// The writer goroutine stops when the connection is closed.
+func NewConn(socket Socket, opt ConnOptions) Conn {
+	c := &pumpConn{
+		socket: socket,
+		opt:    opt.withDefaults(),
+		queue:  make([]outbound, 0),
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+
+	c.socket.SetReadLimit(c.opt.MaxMessageSize)
+	c.socket.SetPongHandler(func(string) error {
+		return c.extendReadDeadline()
+	})
+	// an error here is reported again by the next read
+	_ = c.extendReadDeadline()
+
+	go c.writeLoop()
+
+	return c
+}
+
+// ReadJSON reads the next message. Receiving it extends the read deadline.
+func (c *pumpConn) ReadJSON(p interface{}) error {
+	if err := c.socket.ReadJSON(p); err != nil {
+		return err
+	}
+
+	return c.extendReadDeadline()
+}
+
+// extendReadDeadline pushes the read deadline by the read timeout, as the
+// client has just shown it is alive.
+func (c *pumpConn) extendReadDeadline() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.readDeadline = time.Now().Add(c.opt.ReadTimeout)
+	if err := c.socket.SetReadDeadline(c.readDeadline); err != nil {
+		return fmt.Errorf("socket.SetReadDeadline: %v", err)
+	}
+
+	return nil
+}
+
+// awaitPong brings the read deadline closer, so the client has to answer the
+// ping within the pong wait.
+func (c *pumpConn) awaitPong() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pongDeadline := time.Now().Add(c.opt.PongWait)
+	if !pongDeadline.Before(c.readDeadline) {
+		return nil
+	}
+
+	c.readDeadline = pongDeadline
+	if err := c.socket.SetReadDeadline(c.readDeadline); err != nil {
+		return fmt.Errorf("socket.SetReadDeadline: %v", err)
+	}
+
+	return nil
+}
+
+// WriteJSON queues the payload. It does not wait for the payload to be
+// written: an error is only returned if the connection is closed, or if the
+// slow consumer policy closes it.
+func (c *pumpConn) WriteJSON(p interface{}) error {
+	msg := outbound{payload: p}
+	if d, ok := p.(droppable); ok {
+		msg.droppable = d.isDroppable()
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return fmt.Errorf("connection closed")
+	}
+
+	if len(c.queue) >= c.opt.QueueSize && !c.dropOldest() {
+		c.mu.Unlock()
+		c.Close()
+		return fmt.Errorf("slow consumer: %d messages queued", c.opt.QueueSize)
+	}
+
+	c.queue = append(c.queue, msg)
+	c.mu.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// dropOldest removes the oldest droppable message from the queue, if the
+// policy allows it. It returns false if nothing could be dropped.
+// The lock must be held.
+func (c *pumpConn) dropOldest() bool {
+	if c.opt.SlowConsumer != DropOldest {
+		return false
+	}
+
+	for i, msg := range c.queue {
+		if msg.droppable {
+			c.queue = append(c.queue[:i], c.queue[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *pumpConn) RemoteAddr() net.Addr {
+	return c.socket.RemoteAddr()
+}
+
+// Close stops the writer goroutine and closes the socket. The messages still
+// queued are discarded. It is safe to call it more than once.
+func (c *pumpConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.closed = true
+		c.queue = nil
+		c.mu.Unlock()
+
+		close(c.done)
+		c.closeErr = c.socket.Close()
+	})
+
+	return c.closeErr
+}
+
+// pop removes and returns the first queued message.
+func (c *pumpConn) pop() (outbound, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.queue) == 0 {
+		return outbound{}, false
+	}
+
+	msg := c.queue[0]
+	c.queue = c.queue[1:]
+	return msg, true
+}
+
+// writeLoop is the only goroutine writing on the socket, messages and
+// pings. A failed write closes the connection.
+func (c *pumpConn) writeLoop() {
+	ticker := time.NewTicker(c.opt.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.ping(); err != nil {
+				c.Close()
+				return
+			}
+			continue
+		case <-c.wake:
+		}
+
+		for {
+			msg, ok := c.pop()
+			if !ok {
+				break
+			}
+
+			if err := c.write(msg.payload); err != nil {
+				c.Close()
+				return
+			}
+		}
+	}
+}
+
+func (c *pumpConn) write(p interface{}) error {
+	deadline := time.Now().Add(c.opt.WriteTimeout)
+	if err := c.socket.SetWriteDeadline(deadline); err != nil {
+		return fmt.Errorf("socket.SetWriteDeadline: %v", err)
+	}
+
+	if err := c.socket.WriteJSON(p); err != nil {
+		return fmt.Errorf("socket.WriteJSON: %v", err)
+	}
+
+	return nil
+}
+
+func (c *pumpConn) ping() error {
+	deadline := time.Now().Add(c.opt.WriteTimeout)
+	if err := c.socket.WriteControl(ws.PingMessage, nil, deadline); err != nil {
+		return fmt.Errorf("socket.WriteControl: %v", err)
+	}
+
+	return c.awaitPong()
+}
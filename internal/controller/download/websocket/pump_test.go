@@ -0,0 +1,354 @@
+package websocket_test
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/planetfall/gateway/internal/controller/download/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// socketFake records the written payloads. If block is set, every write
+// waits until a value is sent on it.
+type socketFake struct {
+	mu           sync.Mutex
+	written      []string
+	closed       bool
+	deadline     time.Time
+	readDeadline time.Time
+	readLimit    int64
+	pongHandler  func(string) error
+	pings        int
+	pingErr      error
+
+	block    chan struct{}
+	writeErr error
+
+	writers    int32
+	maxWriters int32
+}
+
+func (s *socketFake) ReadJSON(v interface{}) error { return nil }
+func (s *socketFake) RemoteAddr() net.Addr         { return addrFake("10.0.0.1") }
+
+func (s *socketFake) WriteJSON(v interface{}) error {
+	writers := atomic.AddInt32(&s.writers, 1)
+	defer atomic.AddInt32(&s.writers, -1)
+	for {
+		maxWriters := atomic.LoadInt32(&s.maxWriters)
+		if writers <= maxWriters ||
+			atomic.CompareAndSwapInt32(&s.maxWriters, maxWriters, writers) {
+			break
+		}
+	}
+
+	if s.block != nil {
+		<-s.block
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writeErr != nil {
+		return s.writeErr
+	}
+	s.written = append(s.written, v.(*websocket.StatusBody).Message)
+	return nil
+}
+
+func (s *socketFake) SetWriteDeadline(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deadline = t
+	return nil
+}
+
+func (s *socketFake) SetReadDeadline(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readDeadline = t
+	return nil
+}
+
+func (s *socketFake) SetReadLimit(limit int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readLimit = limit
+}
+
+func (s *socketFake) SetPongHandler(h func(appData string) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pongHandler = h
+}
+
+func (s *socketFake) WriteControl(
+	messageType int, data []byte, deadline time.Time) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pingErr != nil {
+		return s.pingErr
+	}
+	s.pings++
+	return nil
+}
+
+func (s *socketFake) getReadDeadline() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readDeadline
+}
+
+func (s *socketFake) getPings() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pings
+}
+
+func (s *socketFake) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *socketFake) getWritten() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.written...)
+}
+
+func (s *socketFake) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func TestNewConn_withConcurrentWriters(t *testing.T) {
+	// given
+	socketGiven := &socketFake{}
+	conn := websocket.NewConn(socketGiven, websocket.ConnOptions{
+		QueueSize: 1000,
+	})
+
+	// when
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				err := websocket.WriteStatus(conn, websocket.StatusOK,
+					fmt.Sprintf("%d-%d", i, j), nil)
+				assert.Nil(t, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// then
+	assert.Eventually(t, func() bool {
+		return len(socketGiven.getWritten()) == 500
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&socketGiven.maxWriters))
+	assert.Nil(t, conn.Close())
+}
+
+func TestNewConn_withWriteTimeout(t *testing.T) {
+	// given
+	socketGiven := &socketFake{}
+	timeoutGiven := 3 * time.Second
+	conn := websocket.NewConn(socketGiven, websocket.ConnOptions{
+		WriteTimeout: timeoutGiven,
+	})
+
+	// when
+	before := time.Now()
+	err := websocket.WriteStatus(conn, websocket.StatusOK, "message", nil)
+	assert.Nil(t, err)
+
+	// then
+	assert.Eventually(t, func() bool {
+		return len(socketGiven.getWritten()) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	socketGiven.mu.Lock()
+	deadlineActual := socketGiven.deadline
+	socketGiven.mu.Unlock()
+	assert.WithinDuration(t, before.Add(timeoutGiven), deadlineActual,
+		time.Second)
+}
+
+func TestNewConn_withDropOldest(t *testing.T) {
+	// given
+	socketGiven := &socketFake{block: make(chan struct{})}
+	conn := websocket.NewConn(socketGiven, websocket.ConnOptions{
+		QueueSize:    2,
+		SlowConsumer: websocket.DropOldest,
+	})
+
+	// the first message is blocked in the writer, the queue is empty
+	assert.Nil(t, websocket.WriteStatus(conn, websocket.StatusOK, "first", nil))
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&socketGiven.writers) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// when
+	assert.Nil(t, websocket.WriteProgress(conn, "progress-1", nil))
+	assert.Nil(t, websocket.WriteStatus(conn, websocket.StatusOK, "status", nil))
+	assert.Nil(t, websocket.WriteProgress(conn, "progress-2", nil))
+
+	// then
+	for i := 0; i < 3; i++ {
+		socketGiven.block <- struct{}{}
+	}
+	assert.Eventually(t, func() bool {
+		return len(socketGiven.getWritten()) == 3
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t,
+		[]string{"first", "status", "progress-2"}, socketGiven.getWritten())
+	assert.False(t, socketGiven.isClosed())
+}
+
+func TestNewConn_withDropOldestAndNothingDroppable_shouldClose(t *testing.T) {
+	// given
+	socketGiven := &socketFake{block: make(chan struct{})}
+	conn := websocket.NewConn(socketGiven, websocket.ConnOptions{
+		QueueSize:    1,
+		SlowConsumer: websocket.DropOldest,
+	})
+
+	assert.Nil(t, websocket.WriteStatus(conn, websocket.StatusOK, "first", nil))
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&socketGiven.writers) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Nil(t, websocket.WriteStatus(conn, websocket.StatusOK, "second", nil))
+
+	// when
+	err := websocket.WriteStatus(conn, websocket.StatusOK, "third", nil)
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "slow consumer")
+	assert.True(t, socketGiven.isClosed())
+	close(socketGiven.block)
+}
+
+func TestNewConn_withCloseSlow(t *testing.T) {
+	// given
+	socketGiven := &socketFake{block: make(chan struct{})}
+	conn := websocket.NewConn(socketGiven, websocket.ConnOptions{
+		QueueSize:    1,
+		SlowConsumer: websocket.CloseSlow,
+	})
+
+	assert.Nil(t, websocket.WriteStatus(conn, websocket.StatusOK, "first", nil))
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&socketGiven.writers) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Nil(t, websocket.WriteProgress(conn, "progress-1", nil))
+
+	// when
+	err := websocket.WriteProgress(conn, "progress-2", nil)
+
+	// then
+	assert.NotNil(t, err)
+	assert.True(t, socketGiven.isClosed())
+	close(socketGiven.block)
+
+	err = websocket.WriteStatus(conn, websocket.StatusOK, "closed", nil)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "connection closed")
+}
+
+func TestNewConn_withWriteError_shouldClose(t *testing.T) {
+	// given
+	socketGiven := &socketFake{writeErr: fmt.Errorf("test write error")}
+	conn := websocket.NewConn(socketGiven, websocket.ConnOptions{})
+
+	// when
+	err := websocket.WriteStatus(conn, websocket.StatusOK, "message", nil)
+
+	// then
+	assert.Nil(t, err)
+	assert.Eventually(t, socketGiven.isClosed,
+		time.Second, 10*time.Millisecond)
+}
+
+func TestNewConn_withReadLimitAndDeadline(t *testing.T) {
+	// given
+	socketGiven := &socketFake{}
+	readTimeoutGiven := 5 * time.Second
+
+	// when
+	before := time.Now()
+	conn := websocket.NewConn(socketGiven, websocket.ConnOptions{
+		ReadTimeout:    readTimeoutGiven,
+		MaxMessageSize: 512,
+	})
+
+	// then
+	assert.Equal(t, int64(512), socketGiven.readLimit)
+	assert.NotNil(t, socketGiven.pongHandler)
+	assert.WithinDuration(t, before.Add(readTimeoutGiven),
+		socketGiven.getReadDeadline(), time.Second)
+
+	// a message from the client extends the deadline
+	time.Sleep(50 * time.Millisecond)
+	var p interface{}
+	assert.Nil(t, conn.ReadJSON(&p))
+	assert.True(t, socketGiven.getReadDeadline().After(
+		before.Add(readTimeoutGiven)))
+	assert.Nil(t, conn.Close())
+}
+
+func TestNewConn_withHeartbeat(t *testing.T) {
+	// given
+	socketGiven := &socketFake{}
+	readTimeoutGiven := 5 * time.Second
+	pongWaitGiven := 1 * time.Second
+
+	// when
+	conn := websocket.NewConn(socketGiven, websocket.ConnOptions{
+		PingInterval: 20 * time.Millisecond,
+		PongWait:     pongWaitGiven,
+		ReadTimeout:  readTimeoutGiven,
+	})
+
+	// then
+	// the ping brings the deadline closer, waiting for the pong
+	assert.Eventually(t, func() bool {
+		return socketGiven.getPings() > 0
+	}, time.Second, 5*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return time.Until(socketGiven.getReadDeadline()) <= pongWaitGiven
+	}, time.Second, 5*time.Millisecond)
+
+	// the pong pushes it back
+	socketGiven.mu.Lock()
+	pongHandler := socketGiven.pongHandler
+	socketGiven.mu.Unlock()
+	assert.Nil(t, pongHandler(""))
+	assert.True(t,
+		time.Until(socketGiven.getReadDeadline()) > pongWaitGiven)
+
+	assert.Nil(t, conn.Close())
+}
+
+func TestNewConn_withPingError_shouldClose(t *testing.T) {
+	// given
+	socketGiven := &socketFake{pingErr: fmt.Errorf("test ping error")}
+
+	// when
+	websocket.NewConn(socketGiven, websocket.ConnOptions{
+		PingInterval: 10 * time.Millisecond,
+	})
+
+	// then
+	assert.Eventually(t, socketGiven.isClosed,
+		time.Second, 5*time.Millisecond)
+}
@@ -3,23 +3,65 @@ package websocket
 import (
 	"crypto/sha256"
 	"fmt"
+	"sync"
 	"time"
+
+	"github.com/planetfall/gateway/internal/metrics"
 )
 
 // Key is a key representing a job for a connection.
 type Key string
 
-// Store stores the map between connections and its job keys.
-type Store map[Conn][]Key
+// Store stores the map between connections and their job keys.
+// It is safe for concurrent use: the HTTP handlers register connections and
+// jobs while the Pub/Sub receive goroutines resolve job keys.
+type Store interface {
+
+	// GetWebsocket provides the websocket associated with the provided job
+	// key.
+	GetWebsocket(key Key) (Conn, error)
+
+	// Register adds a new websocket in the store.
+	Register(ws Conn) error
+
+	// AddNewJob generates a new job key and adds it to a registered
+	// websocket.
+	AddNewJob(ws Conn) (Key, error)
+
+	// Unregister removes a registered websocket from the store, and all its
+	// job keys.
+	Unregister(ws Conn) error
+}
+
+// storeImpl is the default Store implementation.
+//
+// It holds the connection to job keys map, alongside a reverse index from a
+// job key to its connection, so a key lookup does not have to scan every
+// registered connection.
+//
+// The count of open websockets and of held job keys are tracked by the
+// metrics gauges.
+type storeImpl struct {
+	mu sync.RWMutex
+
+	// The job keys set of each registered connection
+	conns map[Conn]map[Key]struct{}
+
+	// The reverse index, from a job key to its connection
+	keys map[Key]Conn
+}
 
 // NewStore builds a new store.
 func NewStore() Store {
-	return Store{}
+	return &storeImpl{
+		conns: make(map[Conn]map[Key]struct{}),
+		keys:  make(map[Key]Conn),
+	}
 }
 
-// Generate a new job key from a websocket, using the client addr and
-// the current timestamp
-func (w Store) newWebsocketKey(ws Conn) Key {
+// newWebsocketKey generates a new job key from a websocket, using the client
+// addr and the current timestamp
+func newWebsocketKey(ws Conn) Key {
 	addr := ws.RemoteAddr().String()
 	now := fmt.Sprintf("%v", time.Now())
 
@@ -30,60 +72,74 @@ func (w Store) newWebsocketKey(ws Conn) Key {
 	return Key(key[:8])
 }
 
-// GetWebsocket provides the websocket associated with the provided job
-// key
-func (s Store) GetWebsocket(key Key) (Conn, error) {
-
-	// loop over ws
-	for ws, wsKeys := range s {
+func (s *storeImpl) GetWebsocket(key Key) (Conn, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-		// for each ws, check if it contains the filtered ordering key
-		for _, wsKey := range wsKeys {
-			if wsKey == key {
-				return ws, nil
-			}
-		}
+	ws, exists := s.keys[key]
+	if !exists {
+		return nil, fmt.Errorf("key %s not found", key)
 	}
 
-	return nil, fmt.Errorf("key %s not found", key)
+	return ws, nil
 }
 
-// RegisterWebsocket adds a new websocket in the store.
-// It initialize its job key slice.
-func (s Store) Register(ws Conn) error {
+func (s *storeImpl) Register(ws Conn) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if _, exists := s[ws]; exists {
+	if _, exists := s.conns[ws]; exists {
 		return fmt.Errorf("websocket already registered")
 	}
 
-	// initialize with empty array
-	s[ws] = make([]Key, 0)
+	// initialize with an empty key set
+	s.conns[ws] = make(map[Key]struct{})
+	metrics.OpenWebsockets.Inc()
 
 	return nil
 }
 
-// AddNewJob adds a new job key to a registered websocket.
-func (s Store) AddNewJob(ws Conn) (Key, error) {
+func (s *storeImpl) AddNewJob(ws Conn) (Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if _, exists := s[ws]; !exists {
+	wsKeys, exists := s.conns[ws]
+	if !exists {
 		return "", fmt.Errorf("websocket not registered")
 	}
 
-	newKey := s.newWebsocketKey(ws)
-	s[ws] = append(s[ws], newKey)
+	// the key is truncated, so it may collide with an active one:
+	// generate a new one until it is unique
+	newKey := newWebsocketKey(ws)
+	for {
+		if _, taken := s.keys[newKey]; !taken {
+			break
+		}
+		newKey = newWebsocketKey(ws)
+	}
+
+	wsKeys[newKey] = struct{}{}
+	s.keys[newKey] = ws
+	metrics.TrackedJobs.Inc()
 
 	return newKey, nil
 }
 
-// UnregisterWebsocket removes a registered websocket from the store and removes
-// all its job keys
-func (s Store) Unregister(ws Conn) error {
+func (s *storeImpl) Unregister(ws Conn) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if _, exists := s[ws]; !exists {
+	wsKeys, exists := s.conns[ws]
+	if !exists {
 		return fmt.Errorf("websocket not registered")
 	}
 
-	delete(s, ws)
+	for key := range wsKeys {
+		delete(s.keys, key)
+	}
+	delete(s.conns, ws)
+	metrics.TrackedJobs.Sub(float64(len(wsKeys)))
+	metrics.OpenWebsockets.Dec()
 
 	return nil
 }
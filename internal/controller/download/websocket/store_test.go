@@ -0,0 +1,207 @@
+package websocket_test
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/planetfall/gateway/internal/controller/download/websocket"
+	"github.com/planetfall/gateway/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type addrFake string
+
+func (a addrFake) Network() string { return "tcp" }
+func (a addrFake) String() string  { return string(a) }
+
+type connFake struct {
+	addr string
+}
+
+func (c *connFake) ReadJSON(p interface{}) error  { return nil }
+func (c *connFake) WriteJSON(p interface{}) error { return nil }
+func (c *connFake) RemoteAddr() net.Addr          { return addrFake(c.addr) }
+func (c *connFake) Close() error                  { return nil }
+
+func TestStore(t *testing.T) {
+	// given
+	s := websocket.NewStore()
+	connGiven := &connFake{addr: "192.168.0.1"}
+
+	// when
+	err := s.Register(connGiven)
+	assert.Nil(t, err)
+
+	keyActual, err := s.AddNewJob(connGiven)
+	assert.Nil(t, err)
+
+	// then
+	connActual, err := s.GetWebsocket(keyActual)
+	assert.Nil(t, err)
+	assert.Equal(t, connGiven, connActual)
+}
+
+func TestStore_withMultipleJobs(t *testing.T) {
+	// given
+	s := websocket.NewStore()
+	connGiven := &connFake{addr: "192.168.0.1"}
+	otherConnGiven := &connFake{addr: "192.168.0.2"}
+	assert.Nil(t, s.Register(connGiven))
+	assert.Nil(t, s.Register(otherConnGiven))
+
+	// when
+	keys := make(map[websocket.Key]struct{})
+	for i := 0; i < 100; i++ {
+		key, err := s.AddNewJob(connGiven)
+		assert.Nil(t, err)
+		keys[key] = struct{}{}
+	}
+	otherKey, err := s.AddNewJob(otherConnGiven)
+	assert.Nil(t, err)
+
+	// then
+	assert.Len(t, keys, 100)
+	for key := range keys {
+		connActual, err := s.GetWebsocket(key)
+		assert.Nil(t, err)
+		assert.Equal(t, connGiven, connActual)
+	}
+
+	connActual, err := s.GetWebsocket(otherKey)
+	assert.Nil(t, err)
+	assert.Equal(t, otherConnGiven, connActual)
+}
+
+func TestRegister_withAlreadyRegistered_shouldFail(t *testing.T) {
+	// given
+	s := websocket.NewStore()
+	connGiven := &connFake{addr: "192.168.0.1"}
+	assert.Nil(t, s.Register(connGiven))
+
+	// when
+	err := s.Register(connGiven)
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "already registered")
+}
+
+func TestAddNewJob_withNotRegistered_shouldFail(t *testing.T) {
+	// given
+	s := websocket.NewStore()
+	connGiven := &connFake{addr: "192.168.0.1"}
+
+	// when
+	_, err := s.AddNewJob(connGiven)
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "not registered")
+}
+
+func TestGetWebsocket_withUnknownKey_shouldFail(t *testing.T) {
+	// given
+	s := websocket.NewStore()
+
+	// when
+	_, err := s.GetWebsocket("unknown")
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "not found")
+}
+
+func TestUnregister(t *testing.T) {
+	// given
+	s := websocket.NewStore()
+	connGiven := &connFake{addr: "192.168.0.1"}
+	assert.Nil(t, s.Register(connGiven))
+	keyGiven, err := s.AddNewJob(connGiven)
+	assert.Nil(t, err)
+
+	// when
+	err = s.Unregister(connGiven)
+
+	// then
+	assert.Nil(t, err)
+
+	_, err = s.GetWebsocket(keyGiven)
+	assert.NotNil(t, err)
+
+	err = s.Unregister(connGiven)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "not registered")
+}
+
+func TestStore_withConcurrentAccess(t *testing.T) {
+	// given
+	s := websocket.NewStore()
+	connCount := 50
+	jobCount := 20
+
+	// when
+	var wg sync.WaitGroup
+	keysChan := make(chan websocket.Key, connCount*jobCount)
+	for i := 0; i < connCount; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			connGiven := &connFake{addr: fmt.Sprintf("10.0.0.%d", i)}
+			assert.Nil(t, s.Register(connGiven))
+
+			for j := 0; j < jobCount; j++ {
+				key, err := s.AddNewJob(connGiven)
+				assert.Nil(t, err)
+				keysChan <- key
+
+				// resolve the key as the Pub/Sub receiver would
+				connActual, err := s.GetWebsocket(key)
+				assert.Nil(t, err)
+				assert.Equal(t, connGiven, connActual)
+			}
+
+			// half of the connections leave
+			if i%2 == 0 {
+				assert.Nil(t, s.Unregister(connGiven))
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(keysChan)
+
+	// then
+	found := 0
+	for key := range keysChan {
+		if _, err := s.GetWebsocket(key); err == nil {
+			found++
+		}
+	}
+	assert.Equal(t, connCount/2*jobCount, found)
+}
+
+func TestStore_withGauges(t *testing.T) {
+	// given
+	s := websocket.NewStore()
+	connGiven := &connFake{addr: "192.168.0.1"}
+	connsBefore := testutil.ToFloat64(metrics.OpenWebsockets)
+	jobsBefore := testutil.ToFloat64(metrics.TrackedJobs)
+
+	// when
+	assert.Nil(t, s.Register(connGiven))
+	for i := 0; i < 3; i++ {
+		_, err := s.AddNewJob(connGiven)
+		assert.Nil(t, err)
+	}
+
+	// then
+	assert.Equal(t, connsBefore+1, testutil.ToFloat64(metrics.OpenWebsockets))
+	assert.Equal(t, jobsBefore+3, testutil.ToFloat64(metrics.TrackedJobs))
+
+	assert.Nil(t, s.Unregister(connGiven))
+	assert.Equal(t, connsBefore, testutil.ToFloat64(metrics.OpenWebsockets))
+	assert.Equal(t, jobsBefore, testutil.ToFloat64(metrics.TrackedJobs))
+}
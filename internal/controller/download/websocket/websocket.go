@@ -12,5 +12,6 @@ type Websocket interface {
 		h http.Header) (Conn, error)
 
 	// IsClosed checks if the given error is related to a connection closure.
+	// A closed connection cannot be read anymore.
 	IsClosed(err error) bool
 }
@@ -1,53 +1,240 @@
 package controller
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/planetfall/gateway/internal/requestid"
 )
 
-// errorMessage is the standard error response body sent back by a Controller
-// in case of error. This standard format can be useful for frontend
-// application in order to report back this kind of error to the user.
-type errorMessage struct {
-	Status  int    `json:"status"`
-	Message string `json:"message"`
+// ProblemContentType is the content type of the error responses, as defined
+// by the [RFC 7807].
+//
+// [RFC 7807]: https://datatracker.ietf.org/doc/html/rfc7807
+const ProblemContentType = "application/problem+json"
+
+// ProblemTypeBase is the base of the problem type URIs. The error code is
+// appended to it.
+const ProblemTypeBase = "https://api.dadard.fr/problems/"
+
+// CorrelationIDKey is the gin context key holding the correlation ID of the
+// request.
+const CorrelationIDKey = "correlation_id"
+
+// CorrelationIDHeader is the response header holding the correlation ID, when
+// an error is sent back.
+const CorrelationIDHeader = "X-Correlation-ID"
+
+// ErrorCode is a stable and machine readable error identifier.
+type ErrorCode string
+
+// The error codes catalog.
+const (
+	CodeInvalidParameters  ErrorCode = "invalid-parameters"
+	CodeNotFound           ErrorCode = "not-found"
+	CodeConflict           ErrorCode = "conflict"
+	CodeRateLimited        ErrorCode = "rate-limited"
+	CodeRequestCanceled    ErrorCode = "request-canceled"
+	CodeInternal           ErrorCode = "internal-error"
+	CodeNotImplemented     ErrorCode = "not-implemented"
+	CodeBackendFailure     ErrorCode = "backend-failure"
+	CodeBackendUnavailable ErrorCode = "backend-unavailable"
+	CodeBackendTimeout     ErrorCode = "backend-timeout"
+)
+
+// errorTitles holds the human readable title of each error code. It does not
+// change from occurrence to occurrence of the error.
+var errorTitles = map[ErrorCode]string{
+	CodeInvalidParameters:  "Wrong parameters supplied",
+	CodeNotFound:           "Resource not found",
+	CodeConflict:           "Request conflicted, try again",
+	CodeRateLimited:        "Too many requests, try again later",
+	CodeRequestCanceled:    "Request canceled",
+	CodeInternal:           "Something went wrong on my side",
+	CodeNotImplemented:     "Not implemented",
+	CodeBackendFailure:     "Something went wrong on my side",
+	CodeBackendUnavailable: "The service is unavailable, try again later",
+	CodeBackendTimeout:     "The service took too long to answer",
 }
 
-// logAndReport process the provided error with some steps:
+// problem is the standard error response body sent back by a Controller
+// in case of error, following the [RFC 7807] format. This standard format can
+// be useful for frontend application in order to report back this kind of
+// error to the user. The correlation ID ties the response to the logs and the
+// reported error.
 //
-//  1. Logs the error in the console
-//  2. Sends it as a HTTP response using the errorMessage format
-//  3. Use the controller ReportError callback
+// [RFC 7807]: https://datatracker.ietf.org/doc/html/rfc7807
+type problem struct {
+	Type          string    `json:"type"`
+	Title         string    `json:"title"`
+	Status        int       `json:"status"`
+	Detail        string    `json:"detail,omitempty"`
+	Instance      string    `json:"instance,omitempty"`
+	Code          ErrorCode `json:"code"`
+	CorrelationID string    `json:"correlation_id"`
+}
+
+// ItemError is the error of an item of a batch request. It is sent back in
+// place of the item result, the batch itself succeeding. It holds the fields
+// of the problem the item would have been answered with on its own.
+type ItemError struct {
+	Status int       `json:"status"`
+	Title  string    `json:"title"`
+	Detail string    `json:"detail,omitempty"`
+	Code   ErrorCode `json:"code"`
+}
+
+// ReportedError is the error given to the ReportError callback. It holds the
+// details needed to tie the report to the response and the logs.
+type ReportedError struct {
+	// The reported error
+	Err error
+
+	// The error code sent back
+	Code ErrorCode
+
+	// The correlation ID sent back
+	CorrelationID string
+
+	// The request which failed
+	Request *http.Request
+}
+
+func (e *ReportedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ReportedError) Unwrap() error {
+	return e.Err
+}
+
+// CorrelationID provides the correlation ID of the request. The request ID
+// carried by the request context is used if any. Otherwise, if none is set
+// yet, a new one is generated and kept in the gin context.
+func CorrelationID(g *gin.Context) string {
+	if id := g.GetString(CorrelationIDKey); id != "" {
+		return id
+	}
+
+	if g.Request != nil {
+		if id, ok := requestid.FromContext(g.Request.Context()); ok {
+			g.Set(CorrelationIDKey, id)
+			return id
+		}
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	id := hex.EncodeToString(b)
+	g.Set(CorrelationIDKey, id)
+
+	return id
+}
+
+// log process the provided error with some steps:
 //
-// This is a common workflow used by all controllers when encountering an error.
-// It avoid exposing sensitive error message in the HTTP response.
-func (c *Controller) logAndReport(
-	err error, g *gin.Context, status int, message string) {
+//  1. Logs the error in the console, with the request correlation ID
+//  2. Sends it as a HTTP response using the problem format
+//
+// It avoid exposing sensitive error message in the HTTP response: only the
+// error code title, and the detail if any, are sent back.
+func (c *Controller) log(
+	err error, g *gin.Context, status int, code ErrorCode, detail string) {
+
+	correlationID := CorrelationID(g)
 
 	// log the error in the console
-	c.Logger.Println(err)
+	c.Logger.Printf("[%s] %s: %v", correlationID, code, err)
+
+	instance := ""
+	if g.Request != nil {
+		instance = g.Request.URL.Path
+	}
 
-	// respond as HTTP with a general message
-	g.JSON(status, errorMessage{
-		Status:  status,
-		Message: message,
+	// respond as HTTP with a general message, the content type set here is
+	// kept by the JSON renderer
+	g.Header(CorrelationIDHeader, correlationID)
+	g.Header("Content-Type", ProblemContentType)
+	g.JSON(status, problem{
+		Type:          ProblemTypeBase + string(code),
+		Title:         errorTitles[code],
+		Status:        status,
+		Detail:        detail,
+		Instance:      instance,
+		Code:          code,
+		CorrelationID: correlationID,
 	})
+}
+
+// report uses the controller ReportError callback. The reported error is a
+// ReportedError.
+func (c *Controller) report(err error, g *gin.Context, code ErrorCode) {
+	c.ReportError(&ReportedError{
+		Err:           err,
+		Code:          code,
+		CorrelationID: CorrelationID(g),
+		Request:       g.Request,
+	})
+}
+
+// logAndReport process the provided error with the log steps, then uses the
+// controller ReportError callback. The reported error is a ReportedError.
+//
+// This is a common workflow used by all controllers when encountering an error.
+func (c *Controller) logAndReport(
+	err error, g *gin.Context, status int, code ErrorCode, detail string) {
+
+	c.log(err, g, status, code, detail)
 
 	// report the error to the server
-	c.ReportError(err)
+	c.report(err, g, code)
+}
+
+// logItem logs the error of a batch item with the request correlation ID,
+// and provides its ItemError. Nothing is sent back.
+func (c *Controller) logItem(err error, g *gin.Context,
+	status int, code ErrorCode, detail string) *ItemError {
+
+	c.Logger.Printf("[%s] %s: %v", CorrelationID(g), code, err)
+
+	return &ItemError{
+		Status: status,
+		Title:  errorTitles[code],
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// InvalidItem provides the ItemError of an invalid batch item, with the
+// detail telling what is wrong with it. The error is logged, not reported.
+func (c *Controller) InvalidItem(
+	err error, detail string, g *gin.Context) *ItemError {
+
+	return c.logItem(err, g, http.StatusBadRequest, CodeInvalidParameters, detail)
 }
 
 // BadRequest uses logAndReport with a http.StatusBadRequest status and a proper
 // bad request message
 func (c *Controller) BadRequest(err error, g *gin.Context) {
 	c.logAndReport(err, g,
-		http.StatusBadRequest, "Wrong parameters supplied")
+		http.StatusBadRequest, CodeInvalidParameters, "")
+}
+
+// BadRequestDetail uses log with a http.StatusBadRequest status, and sends
+// back the detail telling the client what is wrong with the request. The
+// detail must not hold sensitive information. As a client fault, the error is
+// not reported.
+func (c *Controller) BadRequestDetail(err error, detail string, g *gin.Context) {
+	c.log(err, g, http.StatusBadRequest, CodeInvalidParameters, detail)
 }
 
 // InternalError uses logAndReport with a http.StatusInternalServerError and a
 // proper internal error message
 func (c *Controller) InternalError(err error, g *gin.Context) {
 	c.logAndReport(err, g,
-		http.StatusInternalServerError, "Something went wrong on my side")
+		http.StatusInternalServerError, CodeInternal, "")
 }
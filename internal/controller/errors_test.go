@@ -1,6 +1,8 @@
 package controller_test
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,6 +11,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/planetfall/gateway/internal/controller"
+	"github.com/planetfall/gateway/internal/requestid"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -40,6 +43,32 @@ func TestBadRequest(t *testing.T) {
 	assert.True(t, reportedGiven)
 }
 
+func TestBadRequestDetail(t *testing.T) {
+	// given
+	writerGiven := httptest.NewRecorder()
+	ginContextGiven, _ := gin.CreateTestContext(writerGiven)
+
+	reportedGiven := false
+	c := &controller.Controller{
+		Logger:      log.Default(),
+		ReportError: func(err error) { reportedGiven = true },
+	}
+
+	// when
+	c.BadRequestDetail(fmt.Errorf("test error"),
+		"unterminated quote at position 3", ginContextGiven)
+
+	// then
+	assert.Equal(t, http.StatusBadRequest, writerGiven.Code)
+	assert.False(t, reportedGiven)
+
+	var body map[string]interface{}
+	err := json.Unmarshal(writerGiven.Body.Bytes(), &body)
+	assert.Nil(t, err)
+	assert.Equal(t, "unterminated quote at position 3", body["detail"])
+	assert.Equal(t, string(controller.CodeInvalidParameters), body["code"])
+}
+
 func TestInternalError(t *testing.T) {
 	// given
 	writerGiven := httptest.NewRecorder()
@@ -67,3 +96,112 @@ func TestInternalError(t *testing.T) {
 		http.StatusInternalServerError, writerGiven.Result().StatusCode)
 	assert.True(t, reportedGiven)
 }
+
+func TestInternalError_withProblemBody(t *testing.T) {
+	// given
+	writerGiven := httptest.NewRecorder()
+	ginContextGiven, _ := gin.CreateTestContext(writerGiven)
+	req, err := http.NewRequest(http.MethodGet, "/controller/route", nil)
+	assert.Nil(t, err)
+	ginContextGiven.Request = req
+
+	var reportedActual error
+	c := &controller.Controller{
+		Logger:      log.Default(),
+		ReportError: func(err error) { reportedActual = err },
+	}
+
+	// when
+	c.InternalError(fmt.Errorf("test error"), ginContextGiven)
+
+	// then
+	assert.Equal(t, controller.ProblemContentType,
+		writerGiven.Header().Get("Content-Type"))
+
+	var body map[string]interface{}
+	err = json.Unmarshal(writerGiven.Body.Bytes(), &body)
+	assert.Nil(t, err)
+
+	assert.Equal(t, float64(http.StatusInternalServerError), body["status"])
+	assert.Equal(t, string(controller.CodeInternal), body["code"])
+	assert.Equal(t,
+		controller.ProblemTypeBase+string(controller.CodeInternal), body["type"])
+	assert.Equal(t, "/controller/route", body["instance"])
+	assert.NotEmpty(t, body["title"])
+	assert.NotContains(t, writerGiven.Body.String(), "test error")
+
+	correlationID := body["correlation_id"]
+	assert.NotEmpty(t, correlationID)
+	assert.Equal(t, correlationID,
+		writerGiven.Header().Get(controller.CorrelationIDHeader))
+
+	var reportedErr *controller.ReportedError
+	assert.True(t, errors.As(reportedActual, &reportedErr))
+	assert.Equal(t, correlationID, reportedErr.CorrelationID)
+	assert.Equal(t, controller.CodeInternal, reportedErr.Code)
+	assert.Equal(t, req, reportedErr.Request)
+}
+
+func TestCorrelationID(t *testing.T) {
+	// given
+	ginContextGiven, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+	// when
+	idActual := controller.CorrelationID(ginContextGiven)
+
+	// then
+	assert.Len(t, idActual, 16)
+	assert.Equal(t, idActual, controller.CorrelationID(ginContextGiven))
+
+	otherContextGiven, _ := gin.CreateTestContext(httptest.NewRecorder())
+	assert.NotEqual(t, idActual, controller.CorrelationID(otherContextGiven))
+}
+
+func TestCorrelationID_withExistingID(t *testing.T) {
+	// given
+	ginContextGiven, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ginContextGiven.Set(controller.CorrelationIDKey, "existing-id")
+
+	// when
+	idActual := controller.CorrelationID(ginContextGiven)
+
+	// then
+	assert.Equal(t, "existing-id", idActual)
+}
+
+func TestCorrelationID_withRequestID(t *testing.T) {
+	// given
+	ginContextGiven, _ := gin.CreateTestContext(httptest.NewRecorder())
+	req := httptest.NewRequest(http.MethodGet, "/route", nil)
+	ginContextGiven.Request = req.WithContext(
+		requestid.NewContext(req.Context(), "request-id"))
+
+	// when
+	idActual := controller.CorrelationID(ginContextGiven)
+
+	// then
+	assert.Equal(t, "request-id", idActual)
+}
+
+func TestInvalidItem(t *testing.T) {
+	// given
+	writerGiven := httptest.NewRecorder()
+	ginContextGiven, _ := gin.CreateTestContext(writerGiven)
+
+	reportedGiven := false
+	c := &controller.Controller{
+		Logger:      log.Default(),
+		ReportError: func(err error) { reportedGiven = true },
+	}
+
+	// when
+	itemActual := c.InvalidItem(fmt.Errorf("test error"),
+		"missing query", ginContextGiven)
+
+	// then
+	assert.Equal(t, http.StatusBadRequest, itemActual.Status)
+	assert.Equal(t, controller.CodeInvalidParameters, itemActual.Code)
+	assert.Equal(t, "missing query", itemActual.Detail)
+	assert.False(t, reportedGiven)
+	assert.Empty(t, writerGiven.Body.String())
+}
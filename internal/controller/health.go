@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/planetfall/gateway/internal/connection/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// The health status values
+const (
+	HealthUp   = "up"
+	HealthDown = "down"
+)
+
+// Health is the state reported by a controller health check. The reason
+// explains the status, so a failed readiness check can be told apart.
+type Health struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Up builds a healthy state.
+func Up(reason string) Health {
+	return Health{Status: HealthUp, Reason: reason}
+}
+
+// Down builds an unhealthy state, with the formatted reason.
+func Down(format string, a ...interface{}) Health {
+	return Health{Status: HealthDown, Reason: fmt.Sprintf(format, a...)}
+}
+
+// IsUp tells if the state is healthy.
+func (h Health) IsUp() bool {
+	return h.Status == HealthUp
+}
+
+// ConnectionHealth reports the state of a GRPC connection. The connection is
+// down if it failed to connect, is shut down, or if its circuit breaker is
+// open. An idle connection is up, it reconnects on the next call.
+func ConnectionHealth(conn grpc.Connection) Health {
+	state := conn.State()
+	breaker := conn.BreakerState()
+
+	switch {
+	case breaker == grpc.BreakerOpen:
+		return Down("connection state is %s, circuit breaker is %s",
+			state, breaker)
+	case state == connectivity.TransientFailure,
+		state == connectivity.Shutdown:
+		return Down("connection state is %s, circuit breaker is %s",
+			state, breaker)
+	default:
+		return Up(fmt.Sprintf("connection state is %s, circuit breaker is %s",
+			state, breaker))
+	}
+}
@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// loadDescriptorSet reads a FileDescriptorSet, as generated by
+// `protoc --include_imports --descriptor_set_out`.
+func loadDescriptorSet(path string) (*protoregistry.Files, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile: %v", err)
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("proto.Unmarshal: %v", err)
+	}
+
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("protodesc.NewFiles: %v", err)
+	}
+
+	return files, nil
+}
+
+// loadFromReflection retrieves the files defining the services from the
+// server reflection, alongside their dependencies.
+func loadFromReflection(ctx context.Context,
+	cc grpc.ClientConnInterface, services []string) (*protoregistry.Files, error) {
+
+	stream, err := rpb.NewServerReflectionClient(cc).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reflection.ServerReflectionInfo: %v", err)
+	}
+	defer stream.CloseSend()
+
+	protos := make(map[string]*descriptorpb.FileDescriptorProto)
+
+	// request sends a reflection request, and keeps the received files
+	request := func(req *rpb.ServerReflectionRequest) error {
+		if err := stream.Send(req); err != nil {
+			return fmt.Errorf("stream.Send: %v", err)
+		}
+		res, err := stream.Recv()
+		if err != nil {
+			return fmt.Errorf("stream.Recv: %v", err)
+		}
+		if errRes := res.GetErrorResponse(); errRes != nil {
+			return fmt.Errorf("reflection error %d: %s",
+				errRes.GetErrorCode(), errRes.GetErrorMessage())
+		}
+
+		for _, b := range res.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			var fd descriptorpb.FileDescriptorProto
+			if err := proto.Unmarshal(b, &fd); err != nil {
+				return fmt.Errorf("proto.Unmarshal: %v", err)
+			}
+			protos[fd.GetName()] = &fd
+		}
+		return nil
+	}
+
+	for _, service := range services {
+		err := request(&rpb.ServerReflectionRequest{
+			MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{
+				FileContainingSymbol: service,
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %v", service, err)
+		}
+	}
+
+	// the server may skip the dependencies, fetch the missing ones
+	for {
+		missing := missingDependencies(protos)
+		if len(missing) == 0 {
+			break
+		}
+
+		for _, name := range missing {
+			if _, found := protos[name]; found {
+				continue
+			}
+
+			err := request(&rpb.ServerReflectionRequest{
+				MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{
+					FileByFilename: name,
+				},
+			})
+			if err != nil {
+				return nil, fmt.Errorf("file %s: %v", name, err)
+			}
+			if _, found := protos[name]; !found {
+				return nil, fmt.Errorf("file %s: not returned", name)
+			}
+		}
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, fd := range protos {
+		set.File = append(set.File, fd)
+	}
+
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("protodesc.NewFiles: %v", err)
+	}
+
+	return files, nil
+}
+
+// missingDependencies lists the dependencies not retrieved yet.
+func missingDependencies(
+	protos map[string]*descriptorpb.FileDescriptorProto) []string {
+
+	var missing []string
+	for _, fd := range protos {
+		for _, dep := range fd.GetDependency() {
+			if _, found := protos[dep]; !found {
+				missing = append(missing, dep)
+			}
+		}
+	}
+
+	return missing
+}
@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// findField finds a field by its proto name, or by its JSON name.
+func findField(
+	fields protoreflect.FieldDescriptors, name string) protoreflect.FieldDescriptor {
+
+	if fd := fields.ByName(protoreflect.Name(name)); fd != nil {
+		return fd
+	}
+
+	return fields.ByJSONName(name)
+}
+
+// setField sets the values of a parameter to the request field it names. The
+// name can be a dotted path to a nested field, such as "page.size". Only the
+// repeated fields accept more than one value.
+func setField(msg protoreflect.Message, name string, values []string) error {
+	parts := strings.Split(name, ".")
+
+	// walk down to the message holding the field
+	for _, part := range parts[:len(parts)-1] {
+		fd := findField(msg.Descriptor().Fields(), part)
+		if fd == nil {
+			return fmt.Errorf("unknown field %s", name)
+		}
+		if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+			return fmt.Errorf("field %s is not a message", part)
+		}
+		msg = msg.Mutable(fd).Message()
+	}
+
+	fd := findField(msg.Descriptor().Fields(), parts[len(parts)-1])
+	if fd == nil {
+		return fmt.Errorf("unknown field %s", name)
+	}
+	if fd.IsMap() || fd.Kind() == protoreflect.MessageKind ||
+		fd.Kind() == protoreflect.GroupKind {
+
+		return fmt.Errorf("field %s cannot be set from a parameter", name)
+	}
+
+	if fd.IsList() {
+		list := msg.Mutable(fd).List()
+		for _, value := range values {
+			v, err := parseValue(fd, value)
+			if err != nil {
+				return fmt.Errorf("field %s: %v", name, err)
+			}
+			list.Append(v)
+		}
+		return nil
+	}
+
+	if len(values) != 1 {
+		return fmt.Errorf("field %s expects a single value, got %d",
+			name, len(values))
+	}
+
+	v, err := parseValue(fd, values[0])
+	if err != nil {
+		return fmt.Errorf("field %s: %v", name, err)
+	}
+	msg.Set(fd, v)
+
+	return nil
+}
+
+// parseValue parses a parameter value according to the field kind.
+func parseValue(
+	fd protoreflect.FieldDescriptor, value string) (protoreflect.Value, error) {
+
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(value), nil
+
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid bool %q", value)
+		}
+		return protoreflect.ValueOfBool(b), nil
+
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind,
+		protoreflect.Sfixed32Kind:
+		i, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid int32 %q", value)
+		}
+		return protoreflect.ValueOfInt32(int32(i)), nil
+
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind,
+		protoreflect.Sfixed64Kind:
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid int64 %q", value)
+		}
+		return protoreflect.ValueOfInt64(i), nil
+
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		u, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid uint32 %q", value)
+		}
+		return protoreflect.ValueOfUint32(uint32(u)), nil
+
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		u, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid uint64 %q", value)
+		}
+		return protoreflect.ValueOfUint64(u), nil
+
+	case protoreflect.FloatKind:
+		f, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid float %q", value)
+		}
+		return protoreflect.ValueOfFloat32(float32(f)), nil
+
+	case protoreflect.DoubleKind:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid double %q", value)
+		}
+		return protoreflect.ValueOfFloat64(f), nil
+
+	case protoreflect.BytesKind:
+		b, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			b, err = base64.URLEncoding.DecodeString(value)
+		}
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid base64 %q", value)
+		}
+		return protoreflect.ValueOfBytes(b), nil
+
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(value)); ev != nil {
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		}
+		n, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid enum %q", value)
+		}
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(n)), nil
+	}
+
+	return protoreflect.Value{}, fmt.Errorf("unsupported kind %s", fd.Kind())
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// proxy builds the handler of a route. The request message is filled from,
+// by priority:
+//   - the path parameters
+//   - the query parameters, which cannot set the path parameters
+//   - the JSON body, if the route maps it, within the maximum body size
+//
+// The method is then invoked, and the response sent back as JSON.
+func (c *ProxyController) proxy(r route) gin.HandlerFunc {
+	return func(g *gin.Context) {
+
+		req, err := c.newRequest(r, g)
+		if err != nil {
+			c.BadRequest(fmt.Errorf("proxy.newRequest: %v", err), g)
+			return
+		}
+
+		// get the request context, canceled if the client goes away
+		ctx, cancel, err := c.RequestContext(g)
+		if err != nil {
+			c.BadRequest(fmt.Errorf("controller.RequestContext: %v", err), g)
+			return
+		}
+		defer cancel()
+
+		res := dynamicpb.NewMessage(r.method.Output())
+		if err := c.conn.Client().Invoke(ctx, r.fullMethod, req, res); err != nil {
+			c.BackendError(fmt.Errorf("client.Invoke %s: %w", r.fullMethod, err), g)
+			return
+		}
+
+		body, err := protojson.Marshal(res)
+		if err != nil {
+			c.InternalError(fmt.Errorf("protojson.Marshal: %v", err), g)
+			return
+		}
+
+		g.Data(http.StatusOK, "application/json; charset=utf-8", body)
+	}
+}
+
+// newRequest builds the request message of the route method from the HTTP
+// request parameters.
+func (c *ProxyController) newRequest(
+	r route, g *gin.Context) (*dynamicpb.Message, error) {
+
+	req := dynamicpb.NewMessage(r.method.Input())
+
+	if r.Body != "" {
+		body, err := io.ReadAll(
+			http.MaxBytesReader(g.Writer, g.Request.Body, c.maxBodyBytes))
+		if err != nil {
+			return nil, fmt.Errorf("io.ReadAll: %v", err)
+		}
+
+		if len(body) > 0 {
+			var target proto.Message = req
+			if r.bodyField != nil {
+				target = req.Mutable(r.bodyField).Message().Interface()
+			}
+			if err := protojson.Unmarshal(body, target); err != nil {
+				return nil, fmt.Errorf("protojson.Unmarshal: %v", err)
+			}
+		}
+	}
+
+	for name, values := range g.Request.URL.Query() {
+		if _, bound := g.Params.Get(name); bound {
+			return nil, fmt.Errorf(
+				"query parameter: %q is bound to the path", name)
+		}
+		if err := setField(req, name, values); err != nil {
+			return nil, fmt.Errorf("query parameter: %v", err)
+		}
+	}
+
+	for _, param := range g.Params {
+		if err := setField(req, param.Key, []string{param.Value}); err != nil {
+			return nil, fmt.Errorf("path parameter: %v", err)
+		}
+	}
+
+	return req, nil
+}
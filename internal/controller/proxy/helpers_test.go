@@ -0,0 +1,122 @@
+package proxy_test
+
+import (
+	"context"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	connection "github.com/planetfall/gateway/internal/connection/grpc"
+	"github.com/planetfall/gateway/internal/controller"
+	"github.com/planetfall/gateway/internal/controller/proxy"
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// researcherFake is a music researcher backend, it echoes the parameters.
+type researcherFake struct {
+	pb.UnimplementedMusicResearcherServer
+
+	received *pb.Parameters
+}
+
+func (s *researcherFake) Search(
+	ctx context.Context, p *pb.Parameters) (*pb.Results, error) {
+
+	s.received = p
+	if p.Query == "unavailable" {
+		return nil, status.Error(codes.Unavailable, "test unavailable")
+	}
+
+	return &pb.Results{
+		Tracks: []*pb.Track{{ID: "track-" + p.Query, Name: p.Query}},
+	}, nil
+}
+
+func (s *researcherFake) GetGenreList(
+	ctx context.Context, e *pb.Empty) (*pb.GenreList, error) {
+
+	return &pb.GenreList{Genres: []string{"rock", "jazz"}}, nil
+}
+
+// connectionFake is a grpc.Connection over an in-memory listener.
+type connectionFake struct {
+	client *grpc.ClientConn
+}
+
+func (c *connectionFake) Client() *grpc.ClientConn { return c.client }
+func (c *connectionFake) Close() error             { return c.client.Close() }
+func (c *connectionFake) State() connectivity.State {
+	return c.client.GetState()
+}
+func (c *connectionFake) BreakerState() connection.BreakerState {
+	return connection.BreakerClosed
+}
+
+// newBackend starts an in-memory music researcher backend, with the server
+// reflection, and provides a connection to it.
+func newBackend(t *testing.T) (*researcherFake, *connectionFake) {
+	lis := bufconn.Listen(1024 * 1024)
+
+	backend := &researcherFake{}
+	srv := grpc.NewServer()
+	pb.RegisterMusicResearcherServer(srv, backend)
+	reflection.Register(srv)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	client, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(
+			func(ctx context.Context, s string) (net.Conn, error) {
+				return lis.DialContext(ctx)
+			}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+
+	return backend, &connectionFake{client: client}
+}
+
+// writeDescriptorSet writes the music researcher descriptor set.
+func writeDescriptorSet(t *testing.T) string {
+	set := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{
+			protodesc.ToFileDescriptorProto(pb.File_api_music_researcher_proto),
+		},
+	}
+	b, err := proto.Marshal(set)
+	assert.Nil(t, err)
+
+	path := filepath.Join(t.TempDir(), "descriptor.pb")
+	assert.Nil(t, os.WriteFile(path, b, 0644))
+
+	return path
+}
+
+func getOptions(
+	conn *connectionFake, descriptorSet string,
+	routes ...proxy.Route) proxy.ProxyControllerOptions {
+
+	return proxy.ProxyControllerOptions{
+		ControllerOptions: controller.ControllerOptions{
+			Name:        "proxy",
+			Target:      "target",
+			Logger:      log.Default(),
+			ReportError: func(err error) {},
+		},
+		DescriptorSet: descriptorSet,
+		Routes:        routes,
+		Conn:          conn,
+	}
+}
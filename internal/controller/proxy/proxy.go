@@ -0,0 +1,286 @@
+// Package proxy contains a generic controller, exposing unary gRPC methods
+// as HTTP routes without handwritten code.
+//
+// The methods are resolved from a protobuf FileDescriptorSet, or from the
+// backend server reflection. The requests are built with [dynamicpb] from the
+// path, query and body parameters, and the responses are sent back as JSON
+// using [protojson].
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/planetfall/gateway/internal/connection/grpc"
+	"github.com/planetfall/gateway/internal/controller"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// BodyAll maps the whole request body to the gRPC request message.
+const BodyAll = "*"
+
+// DefaultMaxBodyBytes is the maximum size of a request body, when unset.
+const DefaultMaxBodyBytes = 1 << 20
+
+// Route exposes a unary gRPC method as an HTTP route.
+type Route struct {
+	// The HTTP method, http.MethodGet if empty
+	Method string
+
+	// The route path relative to the controller, such as "/tracks/:id".
+	// The path parameters are mapped to the request fields with the same
+	// name.
+	Path string
+
+	// The gRPC method, such as "package.Service/Method"
+	RPC string
+
+	// The request field the JSON body is mapped to, BodyAll for the whole
+	// request. The body is ignored if empty.
+	Body string
+}
+
+// route is a Route resolved against the descriptors.
+type route struct {
+	Route
+
+	// The full method name used to invoke it, such as
+	// "/package.Service/Method"
+	fullMethod string
+
+	// The resolved method
+	method protoreflect.MethodDescriptor
+
+	// The field the body is mapped to, nil if the whole request or no body
+	bodyField protoreflect.FieldDescriptor
+}
+
+// ProxyController exposes the configured gRPC methods of a backend as HTTP
+// routes.
+type ProxyController struct {
+	// Reference to the base controller type
+	controller.Controller
+
+	// The connection to invoke the methods, it authenticates the calls
+	conn grpc.Connection
+
+	// The resolved routes
+	routes []route
+
+	// The maximum size of a request body in bytes
+	maxBodyBytes int64
+}
+
+// ProxyControllerOptions holds the parameters for the ProxyController
+// builder
+type ProxyControllerOptions struct {
+	// The [controller] builder parameters
+	ControllerOptions controller.ControllerOptions
+
+	// Insecure for [grpc] connection builder parameters
+	Insecure bool
+
+	// Interceptors for [grpc] connection builder parameters
+	Interceptors grpc.InterceptorOptions
+
+	// Auth for [grpc] connection builder parameters
+	Auth grpc.AuthOptions
+
+	// TLS for [grpc] connection builder parameters
+	TLS grpc.TLSOptions
+
+	// Endpoints for [grpc] connection builder parameters
+	Endpoints []grpc.Endpoint
+
+	// Balancing for [grpc] connection builder parameters
+	Balancing grpc.BalancingOptions
+
+	// Keepalive for [grpc] connection builder parameters
+	Keepalive grpc.KeepaliveOptions
+
+	// The path of the FileDescriptorSet describing the backend services. If
+	// empty, the descriptors are retrieved using the server reflection.
+	DescriptorSet string
+
+	// The exposed routes
+	Routes []Route
+
+	// The maximum size of a request body in bytes, DefaultMaxBodyBytes if
+	// zero
+	MaxBodyBytes int64
+
+	// GRPC custom connection (optional)
+	Conn grpc.Connection
+}
+
+func (opt ProxyControllerOptions) getMaxBodyBytes() int64 {
+	if opt.MaxBodyBytes <= 0 {
+		return DefaultMaxBodyBytes
+	}
+
+	return opt.MaxBodyBytes
+}
+
+// getConn provides a grpc.Connection from the option if provided.
+// Else, it builds a new one from the default implementation.
+func getConn(opt ProxyControllerOptions) (grpc.Connection, error) {
+
+	if opt.Conn != nil {
+		return opt.Conn, nil
+	}
+
+	return grpc.NewConnection(grpc.ConnectionOptions{
+		Target:       opt.ControllerOptions.Target,
+		Insecure:     opt.Insecure,
+		Interceptors: opt.Interceptors,
+		Auth:         opt.Auth,
+		TLS:          opt.TLS,
+		Endpoints:    opt.Endpoints,
+		Balancing:    opt.Balancing,
+		Keepalive:    opt.Keepalive,
+	})
+}
+
+// NewProxyController builds a new ProxyController.
+// It setup the GRPC connection, loads the descriptors and resolves the
+// routes. It fails if a route method does not exist, or is not unary.
+func NewProxyController(
+	opt ProxyControllerOptions) (*ProxyController, error) {
+
+	// initialize the base type
+	ctrl := controller.NewController(opt.ControllerOptions)
+
+	// setup the connection
+	conn, err := getConn(opt)
+	if err != nil {
+		return nil, fmt.Errorf("connection.NewConnection: %v", err)
+	}
+
+	c := &ProxyController{
+		Controller:   ctrl,
+		conn:         conn,
+		maxBodyBytes: opt.getMaxBodyBytes(),
+	}
+
+	files, err := c.loadFiles(opt)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	for _, r := range opt.Routes {
+		resolved, err := resolveRoute(files, r)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("route %s %s: %v", r.Method, r.Path, err)
+		}
+		c.routes = append(c.routes, resolved)
+	}
+
+	return c, nil
+}
+
+// loadFiles loads the descriptors from the descriptor set file if
+// configured, else from the server reflection.
+func (c *ProxyController) loadFiles(
+	opt ProxyControllerOptions) (*protoregistry.Files, error) {
+
+	if opt.DescriptorSet != "" {
+		files, err := loadDescriptorSet(opt.DescriptorSet)
+		if err != nil {
+			return nil, fmt.Errorf("proxy.loadDescriptorSet: %v", err)
+		}
+		return files, nil
+	}
+
+	ctx, cancel := c.GetContext()
+	defer cancel()
+
+	services := make([]string, 0, len(opt.Routes))
+	for _, r := range opt.Routes {
+		service, _, _ := strings.Cut(strings.TrimPrefix(r.RPC, "/"), "/")
+		services = append(services, service)
+	}
+
+	files, err := loadFromReflection(ctx, c.conn.Client(), services)
+	if err != nil {
+		return nil, fmt.Errorf("proxy.loadFromReflection: %v", err)
+	}
+
+	return files, nil
+}
+
+// resolveRoute finds the route method in the descriptors, and checks it can
+// be exposed.
+func resolveRoute(files *protoregistry.Files, r Route) (route, error) {
+	if r.Method == "" {
+		r.Method = http.MethodGet
+	}
+	r.Method = strings.ToUpper(r.Method)
+
+	service, method, found := strings.Cut(strings.TrimPrefix(r.RPC, "/"), "/")
+	if !found || service == "" || method == "" {
+		return route{}, fmt.Errorf(
+			"invalid rpc %q, expected package.Service/Method", r.RPC)
+	}
+
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return route{}, fmt.Errorf("service %s not found: %v", service, err)
+	}
+	serviceDesc, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return route{}, fmt.Errorf("%s is not a service", service)
+	}
+
+	methodDesc := serviceDesc.Methods().ByName(protoreflect.Name(method))
+	if methodDesc == nil {
+		return route{}, fmt.Errorf("method %s not found in %s", method, service)
+	}
+	if methodDesc.IsStreamingClient() || methodDesc.IsStreamingServer() {
+		return route{}, fmt.Errorf("method %s is not unary", method)
+	}
+
+	resolved := route{
+		Route:      r,
+		fullMethod: fmt.Sprintf("/%s/%s", service, method),
+		method:     methodDesc,
+	}
+
+	if r.Body != "" && r.Body != BodyAll {
+		fd := findField(methodDesc.Input().Fields(), r.Body)
+		if fd == nil || fd.Kind() != protoreflect.MessageKind || fd.IsList() ||
+			fd.IsMap() {
+			return route{}, fmt.Errorf(
+				"body field %s is not a message field of %s",
+				r.Body, methodDesc.Input().FullName())
+		}
+		resolved.bodyField = fd
+	}
+
+	return resolved, nil
+}
+
+// Handle registers the resolved routes on the controller router group, in the
+// configuration order.
+func (c *ProxyController) Handle(group gin.IRoutes) {
+	for _, r := range c.routes {
+		group.Handle(r.Method, r.Path, c.proxy(r))
+	}
+}
+
+// CheckHealth reports the connectivity state of the GRPC connection.
+func (c *ProxyController) CheckHealth() controller.Health {
+	return controller.ConnectionHealth(c.conn)
+}
+
+// Close terminates the inner GRPC connection
+func (c *ProxyController) Close() error {
+	if err := c.conn.Close(); err != nil {
+		return fmt.Errorf("connection.Close: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package proxy_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/planetfall/gateway/internal/controller"
+	"github.com/planetfall/gateway/internal/controller/proxy"
+	"github.com/stretchr/testify/assert"
+)
+
+var searchRoute = proxy.Route{
+	Path: "/search/:query",
+	RPC:  "musicresearcher.MusicResearcher/Search",
+}
+
+// serve registers the controller routes on an engine, and serves the
+// request.
+func serve(c *proxy.ProxyController,
+	req *http.Request) *httptest.ResponseRecorder {
+
+	w := httptest.NewRecorder()
+	_, engine := gin.CreateTestContext(w)
+	c.Handle(engine.Group("/proxy"))
+	engine.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestNewProxyController_withDescriptorSet(t *testing.T) {
+	// given
+	backend, conn := newBackend(t)
+	c, err := proxy.NewProxyController(
+		getOptions(conn, writeDescriptorSet(t), searchRoute))
+	assert.Nil(t, err)
+
+	// when
+	req := httptest.NewRequest(http.MethodGet,
+		"/proxy/search/queen?limit=5&genreFilters=rock&genreFilters=pop", nil)
+	w := serve(c, req)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "queen", backend.received.Query)
+	assert.Equal(t, int32(5), backend.received.Limit)
+	assert.Equal(t, []string{"rock", "pop"}, backend.received.GenreFilters)
+
+	var body map[string][]map[string]string
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "track-queen", body["tracks"][0]["ID"])
+	assert.Nil(t, c.Close())
+}
+
+func TestNewProxyController_withReflection(t *testing.T) {
+	// given
+	_, conn := newBackend(t)
+	routeGiven := proxy.Route{
+		Path: "/genres",
+		RPC:  "musicresearcher.MusicResearcher/GetGenreList",
+	}
+	c, err := proxy.NewProxyController(getOptions(conn, "", routeGiven))
+	assert.Nil(t, err)
+
+	// when
+	req := httptest.NewRequest(http.MethodGet, "/proxy/genres", nil)
+	w := serve(c, req)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"Genres":["rock","jazz"]}`, w.Body.String())
+}
+
+func TestProxy_withBody(t *testing.T) {
+	// given
+	backend, conn := newBackend(t)
+	routeGiven := proxy.Route{
+		Method: http.MethodPost,
+		Path:   "/search",
+		RPC:    "musicresearcher.MusicResearcher/Search",
+		Body:   proxy.BodyAll,
+	}
+	c, err := proxy.NewProxyController(
+		getOptions(conn, writeDescriptorSet(t), routeGiven))
+	assert.Nil(t, err)
+
+	// when
+	req := httptest.NewRequest(http.MethodPost, "/proxy/search?limit=3",
+		strings.NewReader(`{"query": "abba", "genreFilters": ["pop"]}`))
+	w := serve(c, req)
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "abba", backend.received.Query)
+	assert.Equal(t, int32(3), backend.received.Limit)
+	assert.Equal(t, []string{"pop"}, backend.received.GenreFilters)
+}
+
+func TestProxy_withBodyTooLarge_shouldFail(t *testing.T) {
+	// given
+	backend, conn := newBackend(t)
+	routeGiven := proxy.Route{
+		Method: http.MethodPost,
+		Path:   "/search",
+		RPC:    "musicresearcher.MusicResearcher/Search",
+		Body:   proxy.BodyAll,
+	}
+	opt := getOptions(conn, writeDescriptorSet(t), routeGiven)
+	opt.MaxBodyBytes = 16
+	c, err := proxy.NewProxyController(opt)
+	assert.Nil(t, err)
+
+	// when
+	req := httptest.NewRequest(http.MethodPost, "/proxy/search",
+		strings.NewReader(`{"query": "abba", "genreFilters": ["pop"]}`))
+	w := serve(c, req)
+
+	// then
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Nil(t, backend.received)
+}
+
+func TestProxy_withInvalidParameters(t *testing.T) {
+	// given
+	_, conn := newBackend(t)
+	c, err := proxy.NewProxyController(
+		getOptions(conn, writeDescriptorSet(t), searchRoute))
+	assert.Nil(t, err)
+
+	urls := []string{
+		"/proxy/search/queen?limit=ten",
+		"/proxy/search/queen?unknown=1",
+		"/proxy/search/queen?limit=1&limit=2",
+		"/proxy/search/queen?query=abba",
+	}
+
+	for _, url := range urls {
+		// when
+		w := serve(c, httptest.NewRequest(http.MethodGet, url, nil))
+
+		// then
+		assert.Equal(t, http.StatusBadRequest, w.Code, url)
+		assert.Contains(t, w.Body.String(),
+			string(controller.CodeInvalidParameters), url)
+	}
+}
+
+func TestProxy_withBackendError(t *testing.T) {
+	// given
+	_, conn := newBackend(t)
+	c, err := proxy.NewProxyController(
+		getOptions(conn, writeDescriptorSet(t), searchRoute))
+	assert.Nil(t, err)
+
+	// when
+	req := httptest.NewRequest(http.MethodGet, "/proxy/search/unavailable", nil)
+	w := serve(c, req)
+
+	// then
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(),
+		string(controller.CodeBackendUnavailable))
+}
+
+func TestNewProxyController_withInvalidRoutes_shouldFail(t *testing.T) {
+	routes := map[string]proxy.Route{
+		"invalid rpc": {Path: "/a", RPC: "Search"},
+		"service musicresearcher.Unknown not found": {
+			Path: "/a", RPC: "musicresearcher.Unknown/Search"},
+		"method Unknown not found": {
+			Path: "/a", RPC: "musicresearcher.MusicResearcher/Unknown"},
+		"body field query is not a message": {
+			Path: "/a", RPC: "musicresearcher.MusicResearcher/Search",
+			Body: "query"},
+	}
+
+	for errExpected, routeGiven := range routes {
+		// given
+		_, conn := newBackend(t)
+
+		// when
+		_, err := proxy.NewProxyController(
+			getOptions(conn, writeDescriptorSet(t), routeGiven))
+
+		// then
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), errExpected)
+	}
+}
+
+func TestNewProxyController_withMissingDescriptorSet_shouldFail(t *testing.T) {
+	// given
+	_, conn := newBackend(t)
+
+	// when
+	_, err := proxy.NewProxyController(
+		getOptions(conn, "missing.pb", searchRoute))
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "loadDescriptorSet")
+}
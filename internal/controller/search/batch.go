@@ -0,0 +1,73 @@
+package search
+
+import (
+	"time"
+
+	"github.com/planetfall/gateway/internal/controller"
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+)
+
+const (
+	// The default maximum count of queries of a batch
+	DefaultBatchMaxItems = 500
+
+	// The default count of queries of a batch searched at the same time
+	DefaultBatchConcurrency = 8
+
+	// The default timeout of the search of a query of a batch
+	DefaultBatchItemTimeout = 5 * time.Second
+)
+
+// BatchOptions holds the parameters of the batch search.
+type BatchOptions struct {
+	// The maximum count of queries of a batch, DefaultBatchMaxItems if zero
+	MaxItems int
+
+	// The maximum count of queries of a batch searched at the same time,
+	// DefaultBatchConcurrency if zero
+	Concurrency int
+
+	// The timeout of the search of a query, within the request deadline.
+	// DefaultBatchItemTimeout if zero.
+	ItemTimeout time.Duration
+}
+
+func (opt BatchOptions) withDefaults() BatchOptions {
+	if opt.MaxItems <= 0 {
+		opt.MaxItems = DefaultBatchMaxItems
+	}
+	if opt.Concurrency <= 0 {
+		opt.Concurrency = DefaultBatchConcurrency
+	}
+	if opt.ItemTimeout <= 0 {
+		opt.ItemTimeout = DefaultBatchItemTimeout
+	}
+	return opt
+}
+
+// batchItem holds the arguments of a query of the batch, as the ones passed
+// to the Search endpoint.
+type batchItem struct {
+	Query     string   `json:"q"`
+	GenreList []string `json:"genre"`
+	Limit     int      `json:"limit"`
+}
+
+// batchRequest is the body of the SearchBatch endpoint.
+type batchRequest struct {
+	Items []batchItem `json:"items"`
+}
+
+// batchResult is the outcome of a query of the batch: its results and the
+// interpretation of the query, or its error.
+type batchResult struct {
+	Results *pb.Results           `json:"results,omitempty"`
+	Query   *parsedQuery          `json:"query,omitempty"`
+	Error   *controller.ItemError `json:"error,omitempty"`
+}
+
+// batchResponse is the response of the SearchBatch endpoint. The results
+// are in the order of the queries.
+type batchResponse struct {
+	Items []batchResult `json:"items"`
+}
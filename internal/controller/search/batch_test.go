@@ -0,0 +1,225 @@
+package search_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/planetfall/gateway/internal/controller"
+	"github.com/planetfall/gateway/internal/controller/search"
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// batchActual is the decoded batch response.
+type batchActual struct {
+	Items []struct {
+		Results *pb.Results           `json:"results"`
+		Query   *queryActual          `json:"query"`
+		Error   *controller.ItemError `json:"error"`
+	} `json:"items"`
+}
+
+// slowClient answers the searches after the delay, unless their context is
+// done first. It records the highest count of searches in flight.
+type slowClient struct {
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+	delay       time.Duration
+}
+
+func (c *slowClient) Search(ctx context.Context, p *pb.Parameters,
+	opts ...grpc.CallOption) (*pb.Results, error) {
+
+	n := c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
+	for {
+		highest := c.maxInFlight.Load()
+		if n <= highest || c.maxInFlight.CompareAndSwap(highest, n) {
+			break
+		}
+	}
+
+	select {
+	case <-time.After(c.delay):
+		return resultsOf(p.Query), nil
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+func (c *slowClient) GetGenreList(context.Context, *pb.Empty,
+	...grpc.CallOption) (*pb.GenreList, error) {
+
+	return &pb.GenreList{}, nil
+}
+
+// searchBatch posts the body to the batch endpoint.
+func searchBatch(t *testing.T, c *search.SearchController,
+	body interface{}) (*httptest.ResponseRecorder, batchActual) {
+
+	payload, err := json.Marshal(body)
+	assert.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	gGiven, _ := gin.CreateTestContext(w)
+	gGiven.Request, err = http.NewRequest(http.MethodPost,
+		"/music-researcher/search/batch", bytes.NewReader(payload))
+	assert.Nil(t, err)
+	gGiven.Request.Header.Set("Content-Type", "application/json")
+
+	c.SearchBatch(gGiven)
+
+	var res batchActual
+	if w.Code == http.StatusOK {
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &res))
+	}
+
+	return w, res
+}
+
+// batchOf builds a batch body of the queries.
+func batchOf(queries ...string) map[string]interface{} {
+	items := make([]map[string]interface{}, 0, len(queries))
+	for _, query := range queries {
+		items = append(items, map[string]interface{}{"q": query})
+	}
+	return map[string]interface{}{"items": items}
+}
+
+func TestSearchBatch(t *testing.T) {
+	// given
+	clientGiven := &clientMock{}
+	clientGiven.On("Search", "artist:daft", int32(2), []string{"house"}).
+		Return(resultsOf("a", "b"), nil)
+	clientGiven.On("Search", "unknown", mock.Anything, mock.Anything).
+		Return(&pb.Results{}, status.Error(codes.InvalidArgument, "invalid"))
+	c := getController(t, clientGiven, newConnectionMock())
+
+	// when
+	w, res := searchBatch(t, c, map[string]interface{}{
+		"items": []map[string]interface{}{
+			{"q": "artist:daft genre:house", "limit": 2},
+			{"q": "unknown"},
+			{"q": `daft "punk`},
+			{"q": "daft", "limit": 99},
+		},
+	})
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, res.Items, 4)
+
+	assert.Nil(t, res.Items[0].Error)
+	assert.Len(t, res.Items[0].Results.Tracks, 2)
+	assert.Equal(t, "artist:daft", res.Items[0].Query.BackendQuery)
+
+	assert.Equal(t, http.StatusBadRequest, res.Items[1].Error.Status)
+	assert.Equal(t, "invalid", res.Items[1].Error.Detail)
+
+	assert.Equal(t, http.StatusBadRequest, res.Items[2].Error.Status)
+	assert.Equal(t, "malformed query: unterminated quote at position 5",
+		res.Items[2].Error.Detail)
+
+	assert.Equal(t, http.StatusBadRequest, res.Items[3].Error.Status)
+	assert.Contains(t, res.Items[3].Error.Detail, "limit 99")
+	clientGiven.AssertNumberOfCalls(t, "Search", 2)
+}
+
+func TestSearchBatch_withArtistTitleLines(t *testing.T) {
+	// given
+	clientGiven := searchReturning(resultsOf("a"), nil)
+	c := getController(t, clientGiven, newConnectionMock())
+
+	// when
+	w, res := searchBatch(t, c,
+		batchOf("Daft Punk - One More Time", "AC/DC - Back in Black"))
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	for _, item := range res.Items {
+		assert.Nil(t, item.Error)
+	}
+	clientGiven.AssertCalled(t, "Search",
+		"Daft Punk - One More Time", mock.Anything, mock.Anything)
+	clientGiven.AssertCalled(t, "Search",
+		"AC/DC - Back in Black", mock.Anything, mock.Anything)
+}
+
+func TestSearchBatch_withConcurrencyLimit(t *testing.T) {
+	// given
+	clientGiven := &slowClient{delay: 10 * time.Millisecond}
+	c := getController(t, clientGiven, newConnectionMock(),
+		func(opt *search.SearchControllerOptions) {
+			opt.Batch.Concurrency = 3
+		})
+	queriesGiven := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}
+
+	// when
+	w, res := searchBatch(t, c, batchOf(queriesGiven...))
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.LessOrEqual(t, clientGiven.maxInFlight.Load(), int32(3))
+	for i, item := range res.Items {
+		assert.Nil(t, item.Error)
+		assert.Equal(t, queriesGiven[i], item.Results.Tracks[0].ID)
+	}
+}
+
+func TestSearchBatch_withItemTimeout(t *testing.T) {
+	// given
+	clientGiven := &slowClient{delay: time.Hour}
+	c := getController(t, clientGiven, newConnectionMock(),
+		func(opt *search.SearchControllerOptions) {
+			opt.Batch.ItemTimeout = 20 * time.Millisecond
+		})
+
+	// when
+	start := time.Now()
+	w, res := searchBatch(t, c, batchOf("a", "b"))
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Less(t, time.Since(start), time.Second)
+	for _, item := range res.Items {
+		assert.Equal(t, http.StatusGatewayTimeout, item.Error.Status)
+		assert.Equal(t, controller.CodeBackendTimeout, item.Error.Code)
+	}
+}
+
+func TestSearchBatch_withInvalidBatch_shouldFail(t *testing.T) {
+	// given
+	clientGiven := &clientMock{}
+	c := getController(t, clientGiven, newConnectionMock(),
+		func(opt *search.SearchControllerOptions) {
+			opt.Batch.MaxItems = 2
+		})
+
+	casesGiven := map[string]interface{}{
+		"no item":        batchOf(),
+		"too many items": batchOf("a", "b", "c"),
+		"invalid body":   []string{"a"},
+	}
+
+	for name, bodyGiven := range casesGiven {
+		t.Run(name, func(t *testing.T) {
+			// when
+			w, _ := searchBatch(t, c, bodyGiven)
+
+			// then
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+	clientGiven.AssertNotCalled(t, "Search")
+}
@@ -0,0 +1,254 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/planetfall/gateway/internal/cache"
+	"github.com/planetfall/gateway/internal/metrics"
+)
+
+// CacheHeader is the response header telling if the response was served
+// from the cache.
+const CacheHeader = "X-Cache"
+
+// The CacheHeader values, also used as metric label
+const (
+	CacheHit   = "hit"
+	CacheMiss  = "miss"
+	CacheStale = "stale"
+)
+
+// The routes which can be cached
+const (
+	RouteSearch = "search"
+	RouteGenres = "genres"
+)
+
+// CacheOptions holds the parameters of the response cache. A route is only
+// cached if its TTL is set.
+type CacheOptions struct {
+	// The time the genre list is cached
+	GenresTTL time.Duration
+
+	// The time the search results are cached
+	SearchTTL time.Duration
+
+	// The time an expired response is still served, while a single
+	// background call refreshes it
+	StaleWhileRevalidate time.Duration
+
+	// The time an expired response is still served when the backend fails,
+	// or its circuit breaker is open
+	StaleIfError time.Duration
+
+	// Identical requests in flight are collapsed into one backend call, the
+	// route being cached or not
+	Coalesce bool
+
+	// The maximum count of cached responses, cache.DefaultMaxEntries if zero
+	MaxEntries int
+
+	// The maximum size of the cached responses in bytes,
+	// cache.DefaultMaxBytes if zero
+	MaxBytes int
+
+	// Custom cache (optional)
+	Cache cache.Cache
+}
+
+func (opt CacheOptions) enabled() bool {
+	return opt.GenresTTL > 0 || opt.SearchTTL > 0
+}
+
+// getCache provides a cache.Cache from the option if provided. Else, it
+// builds a new LRU one. It is nil if no route is cached.
+func getCache(opt CacheOptions) cache.Cache {
+
+	if !opt.enabled() {
+		return nil
+	}
+
+	if opt.Cache != nil {
+		return opt.Cache
+	}
+
+	return cache.NewLRU(cache.LRUOptions{
+		MaxEntries: opt.MaxEntries,
+		MaxBytes:   opt.MaxBytes,
+	})
+}
+
+// normalizeQuery lowers the query and collapses its spaces, so the queries
+// differing by their case or spacing share their cache entry.
+func normalizeQuery(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
+
+// normalizeGenres lowers, deduplicates and sorts the genres.
+func normalizeGenres(genres []string) []string {
+	seen := make(map[string]bool, len(genres))
+	normalized := make([]string, 0, len(genres))
+	for _, genre := range genres {
+		genre = strings.ToLower(strings.TrimSpace(genre))
+		if genre == "" || seen[genre] {
+			continue
+		}
+		seen[genre] = true
+		normalized = append(normalized, genre)
+	}
+
+	sort.Strings(normalized)
+	return normalized
+}
+
+// searchKey derives the cache key of the search parameters, for the variant
+// serving them.
+func searchKey(variant string, sp searchParameters) string {
+	values := url.Values{}
+	values.Set("q", normalizeQuery(sp.Query))
+	values["genre"] = normalizeGenres(sp.GenreList)
+	values.Set("limit", strconv.Itoa(sp.Limit))
+	values.Set("offset", strconv.Itoa(sp.Offset))
+
+	return fmt.Sprintf("%s/%s?%s", variant, RouteSearch, values.Encode())
+}
+
+// genresKey provides the cache key of the genre list, for the variant
+// serving it.
+func genresKey(variant string) string {
+	return fmt.Sprintf("%s/%s", variant, RouteGenres)
+}
+
+// ttl provides the cache TTL of the route, zero if it is not cached.
+func (c *SearchController) ttl(route string) time.Duration {
+	if c.responses == nil {
+		return 0
+	}
+
+	switch route {
+	case RouteSearch:
+		return c.cacheOpt.SearchTTL
+	case RouteGenres:
+		return c.cacheOpt.GenresTTL
+	default:
+		return 0
+	}
+}
+
+// staleWindow provides the time an expired response is kept.
+func (c *SearchController) staleWindow() time.Duration {
+	if c.cacheOpt.StaleIfError > c.cacheOpt.StaleWhileRevalidate {
+		return c.cacheOpt.StaleIfError
+	}
+
+	return c.cacheOpt.StaleWhileRevalidate
+}
+
+// cached provides the fresh cached response of the key, if the route is
+// cached.
+func (c *SearchController) cached(route string, key string) (cache.Entry, bool) {
+	if c.ttl(route) <= 0 {
+		return cache.Entry{}, false
+	}
+
+	return c.responses.Get(key)
+}
+
+// stale provides the cached response of the key, even expired, if the route
+// is cached.
+func (c *SearchController) stale(route string, key string) (cache.Entry, bool) {
+	if c.ttl(route) <= 0 {
+		return cache.Entry{}, false
+	}
+
+	return c.responses.GetStale(key)
+}
+
+// count observes the cache lookup result of the route, if it is cached.
+func (c *SearchController) count(route string, result string) {
+	if c.ttl(route) <= 0 {
+		return
+	}
+
+	metrics.CacheRequests.WithLabelValues(c.Name(), route, result).Inc()
+}
+
+// store encodes the response as JSON, and caches it if the route is cached.
+func (c *SearchController) store(
+	route string, key string, response interface{}) (cache.Entry, error) {
+
+	body, err := json.Marshal(response)
+	if err != nil {
+		return cache.Entry{}, fmt.Errorf("json.Marshal: %v", err)
+	}
+
+	ttl := c.ttl(route)
+	entry := cache.NewEntry(body, ttl)
+	if ttl > 0 {
+		entry.StaleUntil = entry.Expires.Add(c.staleWindow())
+		c.responses.Set(key, entry)
+	}
+
+	return entry, nil
+}
+
+// matchETag tells if the If-None-Match header value matches the ETag. The
+// header holds a list of ETags, weak or strong, or *.
+func matchETag(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// serve sends back the entry as a JSON response, with its ETag, its cache
+// control and its cache lookup result. If the client already holds the
+// entry, as told by the If-None-Match header, only a 304 Not Modified is
+// sent back.
+//
+// The body is completed by the decorator, if any, the ETag then being the
+// one of the completed body.
+func (c *SearchController) serve(g *gin.Context,
+	route string, entry cache.Entry, result string, decorate decorator) {
+
+	c.count(route, result)
+
+	if decorate != nil {
+		body, err := decorate(entry.Body)
+		if err != nil {
+			c.InternalError(fmt.Errorf("search.decorate: %v", err), g)
+			return
+		}
+		entry.Body = body
+		entry.ETag = cache.ETag(body)
+	}
+
+	if c.ttl(route) > 0 {
+		g.Header(CacheHeader, result)
+		g.Header("Cache-Control", fmt.Sprintf("max-age=%d", entry.MaxAge()))
+	} else {
+		g.Header("Cache-Control", "no-cache")
+	}
+	g.Header("ETag", entry.ETag)
+
+	if match := g.GetHeader("If-None-Match"); match != "" &&
+		matchETag(match, entry.ETag) {
+
+		g.Status(http.StatusNotModified)
+		return
+	}
+
+	g.Data(http.StatusOK, "application/json; charset=utf-8", entry.Body)
+}
@@ -0,0 +1,144 @@
+package search_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/planetfall/gateway/internal/controller/search"
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// withCache caches the genre list and the search responses.
+func withCache(opt *search.SearchControllerOptions) {
+	opt.Cache = search.CacheOptions{
+		GenresTTL: time.Hour,
+		SearchTTL: time.Minute,
+	}
+}
+
+func TestGetGenreList_withCache(t *testing.T) {
+	// given
+	clientGiven := &clientMock{}
+	clientGiven.On("GetGenreList").
+		Return(&pb.GenreList{Genres: []string{"rock"}}, nil).Once()
+	c := getController(t, clientGiven, newConnectionMock(), withCache)
+
+	// when
+	wFirst := httptest.NewRecorder()
+	c.GetGenreList(getContextGenreList(t, wFirst))
+	wSecond := httptest.NewRecorder()
+	c.GetGenreList(getContextGenreList(t, wSecond))
+
+	// then
+	clientGiven.AssertNumberOfCalls(t, "GetGenreList", 1)
+	assert.Equal(t, http.StatusOK, wSecond.Code)
+	assert.Equal(t, search.CacheMiss, wFirst.Header().Get(search.CacheHeader))
+	assert.Equal(t, search.CacheHit, wSecond.Header().Get(search.CacheHeader))
+	assert.NotEmpty(t, wFirst.Header().Get("ETag"))
+	assert.Equal(t,
+		wFirst.Header().Get("ETag"), wSecond.Header().Get("ETag"))
+	assert.Regexp(t, `^max-age=\d+$`, wSecond.Header().Get("Cache-Control"))
+	assert.Equal(t, []string{"rock"}, getGenreListActual(t, wSecond).Genres)
+}
+
+func TestGetGenreList_withIfNoneMatch(t *testing.T) {
+	// given
+	clientGiven := &clientMock{}
+	clientGiven.On("GetGenreList").
+		Return(&pb.GenreList{Genres: []string{"rock"}}, nil)
+	c := getController(t, clientGiven, newConnectionMock(), withCache)
+
+	wFirst := httptest.NewRecorder()
+	c.GetGenreList(getContextGenreList(t, wFirst))
+	etagGiven := wFirst.Header().Get("ETag")
+
+	// when
+	w := httptest.NewRecorder()
+	gGiven := getContextGenreList(t, w)
+	gGiven.Request.Header.Set("If-None-Match", `"other", W/`+etagGiven)
+	c.GetGenreList(gGiven)
+	gGiven.Writer.WriteHeaderNow()
+
+	// then
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, etagGiven, w.Header().Get("ETag"))
+}
+
+func TestSearch_withCacheAndNormalizedParameters(t *testing.T) {
+	// given
+	clientGiven := &clientMock{}
+	clientGiven.On("Search", mock.Anything, mock.Anything, mock.Anything).
+		Return(resultsOf("a", "b"), nil).Once()
+	c := getController(t, clientGiven, newConnectionMock(), withCache)
+
+	// when
+	wFirst := httptest.NewRecorder()
+	c.Search(getContextSearch(t, wFirst,
+		"Daft  Punk", 2, []string{"house", "electro"}))
+	wSecond := httptest.NewRecorder()
+	c.Search(getContextSearch(t, wSecond,
+		" daft punk ", 2, []string{"Electro", "house", "electro"}))
+
+	// then
+	clientGiven.AssertNumberOfCalls(t, "Search", 1)
+	assert.Equal(t, search.CacheHit, wSecond.Header().Get(search.CacheHeader))
+	assert.Len(t, getSearchResultsActual(t, wSecond).Tracks, 2)
+}
+
+func TestSearch_withCacheAndOtherLimit(t *testing.T) {
+	// given
+	clientGiven := &clientMock{}
+	clientGiven.On("Search", mock.Anything, mock.Anything, mock.Anything).
+		Return(resultsOf("a"), nil)
+	c := getController(t, clientGiven, newConnectionMock(), withCache)
+
+	// when
+	c.Search(getContextSearch(t, httptest.NewRecorder(), "query", 1, nil))
+	c.Search(getContextSearch(t, httptest.NewRecorder(), "query", 2, nil))
+
+	// then
+	clientGiven.AssertNumberOfCalls(t, "Search", 2)
+}
+
+func TestSearch_withCacheAndError(t *testing.T) {
+	// given
+	clientGiven := &clientMock{}
+	clientGiven.On("Search", mock.Anything, mock.Anything, mock.Anything).
+		Return(&pb.Results{}, fmt.Errorf("test error"))
+	c := getController(t, clientGiven, newConnectionMock(), withCache)
+
+	// when
+	c.Search(getContextSearch(t, httptest.NewRecorder(), "query", 1, nil))
+	w := httptest.NewRecorder()
+	c.Search(getContextSearch(t, w, "query", 1, nil))
+
+	// then
+	clientGiven.AssertNumberOfCalls(t, "Search", 2)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestSearch_withoutCache(t *testing.T) {
+	// given
+	clientGiven := &clientMock{}
+	clientGiven.On("Search", mock.Anything, mock.Anything, mock.Anything).
+		Return(resultsOf("a"), nil)
+	c := getController(t, clientGiven, nil)
+
+	// when
+	c.Search(getContextSearch(t, httptest.NewRecorder(), "query", 1, nil))
+	w := httptest.NewRecorder()
+	c.Search(getContextSearch(t, w, "query", 1, nil))
+
+	// then
+	clientGiven.AssertNumberOfCalls(t, "Search", 2)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(search.CacheHeader))
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+	assert.NotEmpty(t, w.Header().Get("ETag"))
+}
@@ -0,0 +1,237 @@
+package search
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/planetfall/gateway/internal/connection/grpc"
+	"github.com/planetfall/gateway/internal/metrics"
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"google.golang.org/grpc/status"
+)
+
+// The variants a request can be routed to
+const (
+	VariantStable = "stable"
+	VariantCanary = "canary"
+)
+
+// VariantShadow is the variant the sampled requests are mirrored to, its
+// responses are never sent back.
+const VariantShadow = "shadow"
+
+// CanaryHeader is the request header overriding the variant assignment.
+const CanaryHeader = "X-Canary"
+
+// The CanaryHeader values
+const (
+	// CanaryAlways routes the request to the canary
+	CanaryAlways = "always"
+
+	// CanaryNever routes the request to the stable variant
+	CanaryNever = "never"
+)
+
+// VariantHeader is the response header naming the variant which served the
+// request, when a canary is configured.
+const VariantHeader = "X-Variant"
+
+// DefaultStickyHeader is the request header identifying the client when none
+// is configured.
+const DefaultStickyHeader = "X-Client-ID"
+
+// buckets is the count of buckets the clients are spread over, so the weight
+// can be set with a precision of 0.01%.
+const buckets = 10000
+
+// CanaryOptions holds the parameters of the canary variant. A share of the
+// clients is routed to the canary target instead of the controller target.
+//
+// The assignment is sticky: a client is identified by the sticky header, or
+// by its IP if the header is missing, and always lands on the same variant
+// for a given weight.
+type CanaryOptions struct {
+	// The target of the canary. No canary is set up if empty.
+	Target string
+
+	// The percentage of the clients routed to the canary, from 0 to 100
+	Weight float64
+
+	// The request header identifying the client, DefaultStickyHeader if
+	// empty
+	StickyHeader string
+
+	// The audience of the canary identity tokens. Built from the canary
+	// target if empty.
+	Audience string
+
+	// Protobuf custom client (optional)
+	Client Client
+
+	// GRPC custom connection (optional)
+	Conn grpc.Connection
+}
+
+func (opt CanaryOptions) enabled() bool {
+	return opt.Target != "" || opt.Conn != nil
+}
+
+func (opt CanaryOptions) getStickyHeader() string {
+	if opt.StickyHeader == "" {
+		return DefaultStickyHeader
+	}
+
+	return opt.StickyHeader
+}
+
+// variant is a backend version the requests can be routed to.
+type variant struct {
+	// The variant name, used as label
+	name string
+
+	// The connection to setup the client, it authenticates the calls
+	conn grpc.Connection
+
+	// The generate protobuf client of the variant backend
+	client Client
+}
+
+// newVariantConn builds the connection of a secondary variant, with the
+// controller parameters. The variant is a single target: the endpoints are
+// not used, and its calls are logged with the variant name.
+func newVariantConn(opt SearchControllerOptions,
+	name string, target string, audience string) (grpc.Connection, error) {
+
+	auth := opt.Auth
+	auth.Audience = audience
+
+	interceptors := opt.Interceptors
+	if interceptors.Logger != nil {
+		interceptors.Logger = variantLogger(interceptors.Logger, name)
+	}
+
+	return grpc.NewConnection(grpc.ConnectionOptions{
+		Target:       target,
+		Insecure:     opt.Insecure,
+		Interceptors: interceptors,
+		Auth:         auth,
+		TLS:          opt.TLS,
+		Keepalive:    opt.Keepalive,
+	})
+}
+
+// getCanaryConn provides the canary grpc.Connection from the option if
+// provided. Else, it builds a new one with the controller parameters.
+func getCanaryConn(opt SearchControllerOptions) (grpc.Connection, error) {
+
+	if opt.Canary.Conn != nil {
+		return opt.Canary.Conn, nil
+	}
+
+	return newVariantConn(opt,
+		VariantCanary, opt.Canary.Target, opt.Canary.Audience)
+}
+
+// newCanary builds the canary variant, nil if no canary is configured.
+func newCanary(opt SearchControllerOptions) (*variant, error) {
+
+	if !opt.Canary.enabled() {
+		return nil, nil
+	}
+
+	if opt.Canary.Weight < 0 || opt.Canary.Weight > 100 {
+		return nil, fmt.Errorf("canary weight %v is not between 0 and 100",
+			opt.Canary.Weight)
+	}
+
+	conn, err := getCanaryConn(opt)
+	if err != nil {
+		return nil, fmt.Errorf("connection.NewConnection: %v", err)
+	}
+
+	client := opt.Canary.Client
+	if client == nil {
+		client = pb.NewMusicResearcherClient(conn.Client())
+	}
+
+	return &variant{
+		name:   VariantCanary,
+		conn:   conn,
+		client: client,
+	}, nil
+}
+
+// bucket provides the bucket of a client, between 0 and buckets.
+func bucket(client string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(client))
+	return h.Sum32() % buckets
+}
+
+// isCanary tells if the request is routed to the canary. The CanaryHeader
+// overrides the sticky assignment.
+func (c *SearchController) isCanary(g *gin.Context) bool {
+
+	switch strings.ToLower(g.GetHeader(CanaryHeader)) {
+	case CanaryAlways:
+		return true
+	case CanaryNever:
+		return false
+	}
+
+	client := g.GetHeader(c.canaryOpt.getStickyHeader())
+	if client == "" {
+		client = g.ClientIP()
+	}
+
+	return float64(bucket(client)) < c.canaryOpt.Weight*buckets/100
+}
+
+// pick provides the variant serving the request. When a canary is
+// configured, the variant is sent back in the VariantHeader.
+func (c *SearchController) pick(g *gin.Context) *variant {
+
+	if c.canary == nil {
+		return &c.stable
+	}
+
+	v := &c.stable
+	if c.isCanary(g) {
+		v = c.canary
+	}
+
+	g.Header(VariantHeader, v.name)
+	return v
+}
+
+// requestLogger provides the request logger, tagged with the variant name
+// when a canary is configured.
+func (c *SearchController) requestLogger(
+	g *gin.Context, v *variant) *log.Logger {
+
+	logger := c.RequestLogger(g)
+	if c.canary == nil {
+		return logger
+	}
+
+	return variantLogger(logger, v.name)
+}
+
+// observe counts the call served by the variant, by gRPC status code.
+func (c *SearchController) observe(v *variant, err error) {
+	if c.canary == nil {
+		return
+	}
+
+	metrics.CanaryRequests.WithLabelValues(
+		c.Name(), v.name, status.Code(err).String()).Inc()
+}
+
+// variantLogger tags the lines of the logger with the variant name.
+func variantLogger(logger *log.Logger, name string) *log.Logger {
+	prefix := fmt.Sprintf("%s[%s] ", logger.Prefix(), name)
+	return log.New(logger.Writer(), prefix, logger.Flags())
+}
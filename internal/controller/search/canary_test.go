@@ -0,0 +1,158 @@
+package search_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/planetfall/gateway/internal/controller"
+	"github.com/planetfall/gateway/internal/controller/search"
+	"github.com/planetfall/gateway/internal/metrics"
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// withCanary routes the weight of the clients to the canary client.
+func withCanary(weightGiven float64,
+	canaryGiven *clientMock) func(opt *search.SearchControllerOptions) {
+
+	return func(opt *search.SearchControllerOptions) {
+		opt.Canary = search.CanaryOptions{
+			Weight: weightGiven,
+			Client: canaryGiven,
+			Conn:   opt.Conn,
+		}
+	}
+}
+
+// genreListFrom answers a genre list naming the variant.
+func genreListFrom(name string) *clientMock {
+	clientGiven := &clientMock{}
+	clientGiven.On("GetGenreList").Return(
+		&pb.GenreList{Genres: []string{name}}, nil)
+	return clientGiven
+}
+
+// getVariant calls the genre list with the given headers, and provides the
+// variant which served it.
+func getVariant(t *testing.T, c *search.SearchController,
+	headers map[string]string) string {
+
+	w := httptest.NewRecorder()
+	gGiven := getContextGenreList(t, w)
+	for key, value := range headers {
+		gGiven.Request.Header.Set(key, value)
+	}
+
+	c.GetGenreList(gGiven)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	genres := getGenreListActual(t, w).Genres
+	assert.Equal(t, []string{w.Header().Get(search.VariantHeader)}, genres)
+
+	return w.Header().Get(search.VariantHeader)
+}
+
+func TestNewSearchController_withInvalidCanaryWeight_shouldFail(t *testing.T) {
+	// given
+	optGiven := search.SearchControllerOptions{
+		ControllerOptions: controller.ControllerOptions{
+			Name:   "name",
+			Target: "target",
+		},
+		Insecure: true,
+		Canary: search.CanaryOptions{
+			Target: "canary",
+			Weight: 120,
+		},
+	}
+
+	// when
+	c, err := search.NewSearchController(optGiven)
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "canary weight")
+	assert.Nil(t, c)
+}
+
+func TestCanary_withHeaderOverride(t *testing.T) {
+	// given
+	c := getController(t, genreListFrom(search.VariantStable),
+		newConnectionMock(),
+		withCanary(0, genreListFrom(search.VariantCanary)))
+
+	// when
+	variantDefault := getVariant(t, c, nil)
+	variantAlways := getVariant(t, c,
+		map[string]string{search.CanaryHeader: search.CanaryAlways})
+
+	// then
+	assert.Equal(t, search.VariantStable, variantDefault)
+	assert.Equal(t, search.VariantCanary, variantAlways)
+}
+
+func TestCanary_withFullWeightAndNeverOverride(t *testing.T) {
+	// given
+	c := getController(t, genreListFrom(search.VariantStable),
+		newConnectionMock(),
+		withCanary(100, genreListFrom(search.VariantCanary)))
+
+	// when
+	variantDefault := getVariant(t, c, nil)
+	variantNever := getVariant(t, c,
+		map[string]string{search.CanaryHeader: search.CanaryNever})
+
+	// then
+	assert.Equal(t, search.VariantCanary, variantDefault)
+	assert.Equal(t, search.VariantStable, variantNever)
+}
+
+func TestCanary_withStickyClients(t *testing.T) {
+	// given
+	c := getController(t, genreListFrom(search.VariantStable),
+		newConnectionMock(),
+		withCanary(20, genreListFrom(search.VariantCanary)))
+	clientsGiven := 500
+
+	// when
+	canaries := 0
+	for i := 0; i < clientsGiven; i++ {
+		headers := map[string]string{
+			search.DefaultStickyHeader: fmt.Sprintf("client-%d", i),
+		}
+
+		first := getVariant(t, c, headers)
+		second := getVariant(t, c, headers)
+
+		// then
+		assert.Equal(t, first, second, headers)
+		if first == search.VariantCanary {
+			canaries++
+		}
+	}
+	assert.InDelta(t, clientsGiven/5, canaries, float64(clientsGiven)/10)
+}
+
+func TestCanary_withMetrics(t *testing.T) {
+	// given
+	canaryGiven := &clientMock{}
+	canaryGiven.On("Search", mock.Anything, mock.Anything, mock.Anything).
+		Return(&pb.Results{}, fmt.Errorf("test error"))
+	c := getController(t, &clientMock{}, newConnectionMock(),
+		withCanary(100, canaryGiven))
+	counter := metrics.CanaryRequests.WithLabelValues(
+		"name", search.VariantCanary, "Unknown")
+	before := testutil.ToFloat64(counter)
+
+	// when
+	w := httptest.NewRecorder()
+	c.Search(getContextSearch(t, w, "query", 1, nil))
+
+	// then
+	assert.Equal(t, search.VariantCanary, w.Header().Get(search.VariantHeader))
+	assert.Equal(t, before+1, testutil.ToFloat64(counter))
+}
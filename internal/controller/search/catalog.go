@@ -0,0 +1,280 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+)
+
+const (
+	// The default timeout of a refresh of the genre catalog
+	DefaultCatalogTimeout = 10 * time.Second
+
+	// The default maximum count of close matches suggested for a genre
+	DefaultMaxSuggestions = 3
+
+	// The default maximum edit distance of a close match
+	DefaultMaxDistance = 2
+)
+
+// CatalogOptions holds the parameters of the genre catalog, a copy of the
+// backend genre list the genre filters are validated against.
+type CatalogOptions struct {
+	// The time between two refreshes of the catalog. The genre filters are
+	// not validated if zero.
+	RefreshInterval time.Duration
+
+	// The timeout of a refresh, DefaultCatalogTimeout if zero
+	Timeout time.Duration
+
+	// The maximum count of close matches suggested for an unknown genre,
+	// DefaultMaxSuggestions if zero
+	MaxSuggestions int
+
+	// The maximum edit distance of a close match, DefaultMaxDistance if zero
+	MaxDistance int
+}
+
+func (opt CatalogOptions) withDefaults() CatalogOptions {
+	if opt.Timeout <= 0 {
+		opt.Timeout = DefaultCatalogTimeout
+	}
+	if opt.MaxSuggestions <= 0 {
+		opt.MaxSuggestions = DefaultMaxSuggestions
+	}
+	if opt.MaxDistance <= 0 {
+		opt.MaxDistance = DefaultMaxDistance
+	}
+	return opt
+}
+
+// normalizeGenre lowers the genre and collapses its spaces.
+func normalizeGenre(genre string) string {
+	return strings.Join(strings.Fields(strings.ToLower(genre)), " ")
+}
+
+// distance provides the Levenshtein distance between the strings: the
+// minimum count of inserted, deleted or substituted characters turning one
+// into the other.
+func distance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+// unknownGenre is a genre filter missing from the catalog, with its close
+// matches.
+type unknownGenre struct {
+	Genre       string
+	Suggestions []string
+}
+
+// UnknownGenresError is returned when genre filters are missing from the
+// catalog. Its message lists the close matches of each of them.
+type UnknownGenresError struct {
+	Unknown []unknownGenre
+}
+
+func (e *UnknownGenresError) Error() string {
+	messages := make([]string, 0, len(e.Unknown))
+	for _, u := range e.Unknown {
+		message := fmt.Sprintf("unknown genre %q", u.Genre)
+		if len(u.Suggestions) > 0 {
+			quoted := make([]string, 0, len(u.Suggestions))
+			for _, s := range u.Suggestions {
+				quoted = append(quoted, fmt.Sprintf("%q", s))
+			}
+			message += ", did you mean " + strings.Join(quoted, ", ") + "?"
+		}
+		messages = append(messages, message)
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// catalog holds a periodically refreshed copy of the backend genre list.
+type catalog struct {
+	opt    CatalogOptions
+	client Client
+	logger *log.Logger
+
+	// the catalog genres by their normalized name, nil until the first
+	// successful refresh
+	mu     sync.RWMutex
+	genres map[string]string
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newCatalog builds the catalog of the client genres, and starts refreshing
+// it in background. It is nil if no refresh interval is set.
+func newCatalog(opt CatalogOptions, client Client,
+	logger *log.Logger) *catalog {
+
+	if opt.RefreshInterval <= 0 {
+		return nil
+	}
+
+	c := &catalog{
+		opt:    opt.withDefaults(),
+		client: client,
+		logger: logger,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go c.run()
+
+	return c
+}
+
+// run refreshes the catalog right away, then at every interval, until the
+// catalog is closed.
+func (c *catalog) run() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.opt.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.refresh(); err != nil {
+			c.logger.Printf("genre catalog refresh failed: %v", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// refresh replaces the catalog with the current backend genre list.
+func (c *catalog) refresh() error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.opt.Timeout)
+	defer cancel()
+
+	list, err := c.client.GetGenreList(ctx, &pb.Empty{})
+	if err != nil {
+		return fmt.Errorf("client.GetGenreList: %w", err)
+	}
+
+	genres := make(map[string]string, len(list.Genres))
+	for _, genre := range list.Genres {
+		genres[normalizeGenre(genre)] = genre
+	}
+
+	c.mu.Lock()
+	c.genres = genres
+	c.mu.Unlock()
+
+	return nil
+}
+
+// suggest provides the catalog genres closest to the unknown genre, within
+// the maximum edit distance.
+func (c *catalog) suggest(genre string) []string {
+	type match struct {
+		genre    string
+		distance int
+	}
+
+	matches := make([]match, 0)
+	for normalized, name := range c.genres {
+		if d := distance(genre, normalized); d <= c.opt.MaxDistance {
+			matches = append(matches, match{name, d})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].genre < matches[j].genre
+	})
+
+	suggestions := make([]string, 0, c.opt.MaxSuggestions)
+	for _, m := range matches {
+		if len(suggestions) == c.opt.MaxSuggestions {
+			break
+		}
+		suggestions = append(suggestions, m.genre)
+	}
+
+	return suggestions
+}
+
+// resolve normalizes the genre filters, and replaces them by their catalog
+// name. The duplicates are removed. The genres missing from the catalog fail
+// with an UnknownGenresError. If the catalog is disabled or not loaded yet,
+// the filters are passed as is.
+func (c *catalog) resolve(genres []string) ([]string, error) {
+	if c == nil || genres == nil {
+		return genres, nil
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.genres == nil {
+		return genres, nil
+	}
+
+	resolved := make([]string, 0, len(genres))
+	seen := make(map[string]bool, len(genres))
+	unknown := make([]unknownGenre, 0)
+	for _, genre := range genres {
+		normalized := normalizeGenre(genre)
+		if normalized == "" || seen[normalized] {
+			continue
+		}
+		seen[normalized] = true
+
+		name, ok := c.genres[normalized]
+		if !ok {
+			unknown = append(unknown,
+				unknownGenre{genre, c.suggest(normalized)})
+			continue
+		}
+		resolved = append(resolved, name)
+	}
+
+	if len(unknown) > 0 {
+		return nil, &UnknownGenresError{Unknown: unknown}
+	}
+
+	return resolved, nil
+}
+
+// close stops refreshing the catalog.
+func (c *catalog) close() {
+	if c == nil {
+		return
+	}
+
+	close(c.stop)
+	<-c.done
+}
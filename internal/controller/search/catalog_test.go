@@ -0,0 +1,126 @@
+package search_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/planetfall/gateway/internal/controller/search"
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// withCatalog validates the genre filters against the catalog of the client.
+func withCatalog(opt *search.SearchControllerOptions) {
+	opt.Catalog.RefreshInterval = 10 * time.Millisecond
+}
+
+// catalogClient mocks a client with the genre catalog, answering every
+// search.
+func catalogClient(genres ...string) *clientMock {
+	clientGiven := searchReturning(resultsOf("a"), nil)
+	clientGiven.On("GetGenreList").Return(&pb.GenreList{Genres: genres}, nil)
+	return clientGiven
+}
+
+// searchGenres calls the search with the genre filters, and provides the
+// response.
+func searchGenres(t *testing.T, c *search.SearchController,
+	genres ...string) *httptest.ResponseRecorder {
+
+	w := httptest.NewRecorder()
+	c.Search(getContextPage(t, w, url.Values{"q": {"query"}, "genre": genres}))
+	return w
+}
+
+// getDetail decodes the detail of the error response.
+func getDetail(t *testing.T, w *httptest.ResponseRecorder) string {
+	var body map[string]interface{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return fmt.Sprint(body["detail"])
+}
+
+func TestSearch_withUnknownGenre_shouldFail(t *testing.T) {
+	// given
+	clientGiven := catalogClient("house", "french house", "hip hop", "horse")
+	c := getController(t, clientGiven, newConnectionMock(), withCatalog)
+	t.Cleanup(func() { c.Close() })
+
+	// when
+	var w *httptest.ResponseRecorder
+	assert.Eventually(t, func() bool {
+		w = searchGenres(t, c, "house", "hosue", "zzzzzzzz")
+		return w.Code == http.StatusBadRequest
+	}, time.Second, 5*time.Millisecond)
+
+	// then
+	assert.Equal(t, `unknown genre "hosue", did you mean "horse", "house"?; `+
+		`unknown genre "zzzzzzzz"`, getDetail(t, w))
+	clientGiven.AssertNotCalled(t,
+		"Search", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestSearch_withNormalizedGenres(t *testing.T) {
+	// given
+	clientGiven := catalogClient("Hip Hop", "house")
+	c := getController(t, clientGiven, newConnectionMock(), withCatalog)
+	t.Cleanup(func() { c.Close() })
+
+	// when
+	assert.Eventually(t, func() bool {
+		return searchGenres(t, c, "hous").Code == http.StatusBadRequest
+	}, time.Second, 5*time.Millisecond)
+	w := searchGenres(t, c, " hip  HOP ", "House", "house")
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	clientGiven.AssertCalled(t, "Search",
+		"query", mock.Anything, []string{"Hip Hop", "house"})
+}
+
+func TestSearch_withCatalogNotLoaded(t *testing.T) {
+	// given
+	clientGiven := searchReturning(resultsOf("a"), nil)
+	clientGiven.On("GetGenreList").
+		Return(&pb.GenreList{}, fmt.Errorf("test error"))
+	c := getController(t, clientGiven, newConnectionMock(), withCatalog)
+	t.Cleanup(func() { c.Close() })
+
+	// when
+	w := searchGenres(t, c, "Any  Genre")
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	clientGiven.AssertCalled(t, "Search",
+		"query", mock.Anything, []string{"Any  Genre"})
+}
+
+func TestSearch_withRefreshedCatalog(t *testing.T) {
+	// given
+	release := make(chan struct{})
+	clientGiven := searchReturning(resultsOf("a"), nil)
+	clientGiven.On("GetGenreList").
+		Return(&pb.GenreList{Genres: []string{"house"}}, nil).Once()
+	clientGiven.On("GetGenreList").
+		Run(func(mock.Arguments) { <-release }).
+		Return(&pb.GenreList{Genres: []string{"house", "techno"}}, nil)
+	c := getController(t, clientGiven, newConnectionMock(), withCatalog)
+	t.Cleanup(func() { c.Close() })
+
+	assert.Eventually(t, func() bool {
+		return searchGenres(t, c, "techno").Code == http.StatusBadRequest
+	}, time.Second, 5*time.Millisecond)
+
+	// when
+	close(release)
+
+	// then
+	assert.Eventually(t, func() bool {
+		return searchGenres(t, c, "techno").Code == http.StatusOK
+	}, time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,144 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"google.golang.org/grpc/status"
+)
+
+// searchItem searches a query of the batch, within the item timeout. The
+// query is checked as the Search endpoint does it.
+func (c *SearchController) searchItem(ctx context.Context, g *gin.Context,
+	logger *log.Logger, v *variant, item batchItem) batchResult {
+
+	sp, err := c.pagination.page(searchParameters{
+		Query:     item.Query,
+		GenreList: item.GenreList,
+		Limit:     item.Limit,
+	})
+	if err != nil {
+		return batchResult{Error: c.InvalidItem(
+			fmt.Errorf("search.page: %v", err), err.Error(), g)}
+	}
+
+	parsed, err := parseQuery(sp.Query)
+	if err != nil {
+		return batchResult{Error: c.InvalidItem(
+			fmt.Errorf("search.parseQuery: %v", err),
+			"malformed query: "+err.Error(), g)}
+	}
+
+	genres, err := c.catalog.resolve(
+		append(append([]string(nil), sp.GenreList...), parsed.Genres...))
+	if err != nil {
+		return batchResult{Error: c.InvalidItem(
+			fmt.Errorf("search.resolve: %v", err), err.Error(), g)}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.batchOpt.ItemTimeout)
+	defer cancel()
+
+	logger.Printf("searching with query: `%v` | genres: `%v` | limit: %v",
+		parsed.Query, genres, sp.Limit)
+	results, err := v.client.Search(ctx, &pb.Parameters{
+		Query:        parsed.Query,
+		GenreFilters: genres,
+		Limit:        int32(sp.Limit),
+	})
+	c.observe(v, err)
+	if err != nil {
+		return batchResult{Error: c.BackendItemError(
+			fmt.Errorf("client.Search: %w", err), g)}
+	}
+
+	return batchResult{Results: results, Query: &parsed}
+}
+
+// SearchBatch searches a batch of queries at once, using the
+// SearchController client to interact with the dedicated service.
+//
+// The queries are searched concurrently, up to the concurrency limit, each
+// within the item timeout. The batch succeeds even if queries fail: the
+// result of each query, or its error, is sent back in the order of the
+// queries.
+//
+//	@Summary		Music batch search
+//	@Description	Searches for music in Spotify API, for each query of the batch
+//	@Accept			json
+//	@Produces		json
+//	@Param			items	body	[]object	true	"Queries, with the q, genre and limit parameters of the search"
+//	@Param			X-Request-Timeout	header	string	false	"Client deadline, as a duration or milliseconds"
+//	@Param			X-Request-ID		header	string	false	"Request ID, generated if missing"
+//	@Success		200
+//	@Router			/music-researcher/search/batch [post]
+func (c *SearchController) SearchBatch(g *gin.Context) {
+
+	// parse the queries
+	var req batchRequest
+	if err := g.ShouldBindJSON(&req); err != nil {
+		c.BadRequest(fmt.Errorf("gin.ShouldBindJSON: %v", err), g)
+		return
+	}
+	if len(req.Items) == 0 || len(req.Items) > c.batchOpt.MaxItems {
+		err := fmt.Errorf("the batch holds %d queries, not between 1 and %d",
+			len(req.Items), c.batchOpt.MaxItems)
+		c.BadRequestDetail(err, err.Error(), g)
+		return
+	}
+
+	// get the request context, canceled if the client goes away
+	ctx, cancel, err := c.RequestContext(g)
+	if err != nil {
+		c.BadRequest(fmt.Errorf("controller.RequestContext: %v", err), g)
+		return
+	}
+	defer cancel()
+
+	// route the request to a variant, all the queries being searched by it
+	v := c.pick(g)
+	logger := c.requestLogger(g, v)
+	logger.Printf("searching a batch of %d queries", len(req.Items))
+
+	// search the queries, at most the concurrency limit at the same time.
+	// Once the request is done, the remaining queries fail without being
+	// searched.
+	res := batchResponse{Items: make([]batchResult, len(req.Items))}
+	slots := make(chan struct{}, c.batchOpt.Concurrency)
+	var wg sync.WaitGroup
+	for i, item := range req.Items {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			res.Items[i] = batchResult{Error: c.BackendItemError(
+				status.FromContextError(ctx.Err()).Err(), g)}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, item batchItem) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			res.Items[i] = c.searchItem(ctx, g, logger, v, item)
+		}(i, item)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, item := range res.Items {
+		if item.Error != nil {
+			failed++
+		}
+	}
+	logger.Printf("searched a batch of %d queries, %d failed",
+		len(req.Items), failed)
+
+	// send back the results
+	g.JSON(http.StatusOK, res)
+}
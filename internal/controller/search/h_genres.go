@@ -1,8 +1,8 @@
 package search
 
 import (
+	"context"
 	"fmt"
-	"net/http"
 
 	"github.com/gin-gonic/gin"
 	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
@@ -15,28 +15,38 @@ import (
 //	@Description	List available genre in Spotify API
 //	@Accept			json
 //	@Produces		json
+//	@Param			X-Request-Timeout	header	string	false	"Client deadline, as a duration or milliseconds"
+//	@Param			X-Request-ID		header	string	false	"Request ID, generated if missing"
+//	@Param			If-None-Match		header	string	false	"ETag of the genre list held by the client"
 //	@Success		200
+//	@Success		304
 //	@Router			/music-researcher/genres [get]
 func (c *SearchController) GetGenreList(g *gin.Context) {
 
-	// get authentication context
-	ctx, cancel := c.GetContext()
-	defer cancel()
-
-	ctx, err := c.conn.AuthenticateContext(ctx)
+	// get the request context, canceled if the client goes away
+	ctx, cancel, err := c.RequestContext(g)
 	if err != nil {
-		c.InternalError(
-			fmt.Errorf("connection.AuthenticateContext: %v", err), g)
+		c.BadRequest(fmt.Errorf("controller.RequestContext: %v", err), g)
 		return
 	}
+	defer cancel()
 
-	c.Logger.Printf("getting genre list")
-	results, err := c.client.GetGenreList(ctx, &pb.Empty{})
-	if err != nil {
-		c.InternalError(fmt.Errorf("client.GetGenreList: %v", err), g)
-		return
+	// route the request to a variant
+	v := c.pick(g)
+	logger := c.requestLogger(g, v)
+
+	// use the client to get the genre list, unless it is cached
+	call := func(ctx context.Context) (interface{}, error) {
+		logger.Printf("getting genre list")
+		results, err := v.client.GetGenreList(ctx, &pb.Empty{})
+		c.observe(v, err)
+		if err != nil {
+			return nil, fmt.Errorf("client.GetGenreList: %w", err)
+		}
+
+		logger.Printf("go %v genres", len(results.Genres))
+		return results, nil
 	}
 
-	c.Logger.Printf("go %v genres", len(results.Genres))
-	g.JSON(http.StatusOK, &results)
+	c.respond(g, ctx, logger, RouteGenres, genresKey(v.name), call, nil)
 }
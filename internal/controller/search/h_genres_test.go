@@ -1,7 +1,6 @@
 package search_test
 
 import (
-	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -9,7 +8,8 @@ import (
 
 	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
 	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestGetGenreList(t *testing.T) {
@@ -61,26 +61,22 @@ func TestGetGenreList_withInternalError(t *testing.T) {
 		http.StatusInternalServerError, gGiven.Writer.Status())
 }
 
-func TestGetGenreList_withAuthenticateError(t *testing.T) {
+func TestGetGenreList_withAuthenticationError(t *testing.T) {
 
 	// given
 	clientGiven := &clientMock{}
-	connGiven := &connectionMock{}
-	c := getController(t, clientGiven, connGiven)
+	c := getController(t, clientGiven, nil)
 
 	wGiven := httptest.NewRecorder()
 	gGiven := getContextGenreList(t, wGiven)
 
-	errGiven := fmt.Errorf("test authentication error")
-	connGiven.
-		On("AuthenticateContext", mock.Anything).
-		Return(context.Background(), errGiven)
-
 	// when
+	errGiven := status.Error(codes.Unauthenticated, "test authentication error")
+	clientGiven.On("GetGenreList").Return(&pb.GenreList{}, errGiven)
+
 	c.GetGenreList(gGiven)
 
 	// then
-	clientGiven.AssertNotCalled(t, "GetGenreList")
-	assert.Equal(t,
-		http.StatusInternalServerError, gGiven.Writer.Status())
+	clientGiven.AssertExpectations(t)
+	assert.Equal(t, http.StatusBadGateway, gGiven.Writer.Status())
 }
@@ -1,8 +1,9 @@
 package search
 
 import (
+	"context"
 	"fmt"
-	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
@@ -13,6 +14,8 @@ type searchParameters struct {
 	Query     string   `form:"q"`
 	GenreList []string `form:"genre"`
 	Limit     int      `form:"limit"`
+	Offset    int      `form:"offset"`
+	Cursor    string   `form:"cursor"`
 }
 
 // Search uses the SearchController client to interact with the
@@ -22,10 +25,16 @@ type searchParameters struct {
 //	@Description	Searches for music in Spotify API
 //	@Accept			json
 //	@Produces		json
-//	@Param			q		query	string		true	"Main user query"
-//	@Param			genre	query	[]string	true	"Genre list"
-//	@Param			limit	query	int			true	"Limit result count"
+//	@Param			q		query	string		true	"Main user query, with the artist:, album:, track:, year: and genre: qualifiers, the quoted phrases and the negation of the terms by a leading -, a qualifier value running up to the next qualifier"
+//	@Param			genre	query	[]string	true	"Genre list, checked against the genre catalog"
+//	@Param			limit	query	int			false	"Limit result count"
+//	@Param			offset	query	int			false	"Count of results skipped"
+//	@Param			cursor	query	string		false	"Cursor of the page, replaces the other parameters"
+//	@Param			X-Request-Timeout	header	string	false	"Client deadline, as a duration or milliseconds"
+//	@Param			X-Request-ID		header	string	false	"Request ID, generated if missing"
+//	@Param			If-None-Match		header	string	false	"ETag of the results held by the client"
 //	@Success		200
+//	@Success		304
 //	@Router			/music-researcher/search [get]
 func (c *SearchController) Search(g *gin.Context) {
 
@@ -36,35 +45,78 @@ func (c *SearchController) Search(g *gin.Context) {
 		return
 	}
 
-	// get authentication context
-	ctx, cancel := c.GetContext()
-	defer cancel()
+	// resolve the requested page
+	sp, err := c.pagination.page(sp)
+	if err != nil {
+		c.BadRequest(fmt.Errorf("search.page: %v", err), g)
+		return
+	}
+
+	// parse the query, its genre terms being added to the genre filters
+	parsed, err := parseQuery(sp.Query)
+	if err != nil {
+		c.BadRequestDetail(fmt.Errorf("search.parseQuery: %v", err),
+			"malformed query: "+err.Error(), g)
+		return
+	}
+	backend := sp
+	backend.Query = parsed.Query
 
-	ctx, err := c.conn.AuthenticateContext(ctx)
+	// check the genres against the catalog, and normalize them
+	backend.GenreList, err = c.catalog.resolve(
+		append(append([]string(nil), sp.GenreList...), parsed.Genres...))
 	if err != nil {
-		c.InternalError(
-			fmt.Errorf("connection.AuthenticateContext: %v", err), g)
+		c.BadRequestDetail(fmt.Errorf("search.resolve: %v", err),
+			err.Error(), g)
 		return
 	}
 
-	// use the client to perform the search
-	c.Logger.Printf("searching with query: `%v` | genres: `%v` | limit: %v",
-		sp.Query, sp.GenreList, sp.Limit)
-	results, err := c.client.Search(
-		ctx,
-		&pb.Parameters{
-			Query:        sp.Query,
-			GenreFilters: sp.GenreList,
-			Limit:        int32(sp.Limit),
-		},
-	)
+	// get the request context, canceled if the client goes away
+	ctx, cancel, err := c.RequestContext(g)
 	if err != nil {
-		c.InternalError(
-			fmt.Errorf("client.Search: %v", err), g)
+		c.BadRequest(fmt.Errorf("controller.RequestContext: %v", err), g)
 		return
 	}
+	defer cancel()
+
+	// route the request to a variant
+	v := c.pick(g)
+	logger := c.requestLogger(g, v)
+
+	// use the client to perform the search, unless the results are cached.
+	// The backend has no offset: the page is cut from the first results.
+	parameters := &pb.Parameters{
+		Query:        backend.Query,
+		GenreFilters: backend.GenreList,
+		Limit:        int32(sp.Offset + sp.Limit),
+	}
+	call := func(ctx context.Context) (interface{}, error) {
+		logger.Printf("searching with query: `%v` | genres: `%v` | limit: %v"+
+			" | offset: %v", backend.Query, backend.GenreList, sp.Limit,
+			sp.Offset)
+		start := time.Now()
+		results, err := v.client.Search(ctx, parameters)
+		c.observe(v, err)
+
+		// mirror the backend search to the shadow, if sampled, without
+		// waiting for it. The cached and coalesced requests are not
+		// mirrored.
+		if c.shadow != nil {
+			c.shadow.mirror(ctx, parameters, v.name, newCallResult(
+				results, err, time.Since(start), c.shadow.opt.TopN))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("client.Search: %w", err)
+		}
+
+		logger.Printf("searched and got %v tracks", len(results.Tracks))
+		return cutPage(sp, results), nil
+	}
 
-	// send back the result
-	c.Logger.Printf("searched and got %v tracks", len(results.Tracks))
-	g.JSON(http.StatusOK, &results)
+	// send back the page, with the interpretation of the query and the
+	// cursors of the request. The queries sent to the backend the same way
+	// share their cache entry.
+	c.respond(g, ctx, logger, RouteSearch, searchKey(v.name, backend), call,
+		chain(withQuery(parsed),
+			c.pagination.withPage(g.Request.URL.Path, sp)))
 }
@@ -1,15 +1,16 @@
 package search_test
 
 import (
-	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/planetfall/gateway/internal/controller"
 	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
 	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestSearch(t *testing.T) {
@@ -102,26 +103,68 @@ func TestSearch_withInvalidLimit(t *testing.T) {
 	}
 }
 
-func TestSearch_withAuthenticateError(t *testing.T) {
+func TestSearch_withAuthenticationError(t *testing.T) {
 
 	// given
-	connGiven := &connectionMock{}
 	clientGiven := &clientMock{}
-	c := getController(t, clientGiven, connGiven)
+	c := getController(t, clientGiven, nil)
 
 	wGiven := httptest.NewRecorder()
-	gGiven := getContextSearch(t, wGiven, "", "", nil)
+	gGiven := getContextSearch(t, wGiven, "query-value", 10, nil)
+
+	// when
+	errGiven := status.Error(codes.Unauthenticated, "test authentication error")
+	clientGiven.
+		On("Search", "query-value", int32(10), []string(nil)).
+		Return(&pb.Results{}, errGiven)
+
+	c.Search(gGiven)
+
+	// then
+	clientGiven.AssertExpectations(t)
+	assert.Equal(t, http.StatusBadGateway, gGiven.Writer.Status())
+}
 
-	errGiven := fmt.Errorf("test authentication error")
-	connGiven.
-		On("AuthenticateContext", mock.Anything).
-		Return(context.Background(), errGiven)
+func TestSearch_withInvalidTimeoutHeader(t *testing.T) {
+
+	// given
+	clientGiven := &clientMock{}
+	c := getController(t, clientGiven, nil)
+
+	wGiven := httptest.NewRecorder()
+	gGiven := getContextSearch(t, wGiven, "query-value", 10, nil)
+	gGiven.Request.Header.Set(controller.TimeoutHeader, "soon")
 
 	// when
 	c.Search(gGiven)
 
 	// then
 	clientGiven.AssertNotCalled(t, "Search")
-	assert.Equal(t,
-		http.StatusInternalServerError, gGiven.Writer.Status())
+	assert.Equal(t, http.StatusBadRequest, gGiven.Writer.Status())
+}
+
+func TestSearch_withUnavailable(t *testing.T) {
+
+	// given
+	clientGiven := &clientMock{}
+
+	queryGiven := "query-value"
+	limitGiven := int32(10)
+
+	wGiven := httptest.NewRecorder()
+	gGiven := getContextSearch(t, wGiven, queryGiven, limitGiven, nil)
+
+	c := getController(t, clientGiven, nil)
+
+	// when
+	errorGiven := status.Error(codes.Unavailable, "test unavailable")
+	clientGiven.
+		On("Search", queryGiven, limitGiven, []string(nil)).
+		Return(&pb.Results{}, errorGiven)
+
+	c.Search(gGiven)
+
+	// then
+	clientGiven.AssertExpectations(t)
+	assert.Equal(t, http.StatusServiceUnavailable, gGiven.Writer.Status())
 }
@@ -11,12 +11,14 @@ import (
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	connection "github.com/planetfall/gateway/internal/connection/grpc"
 	"github.com/planetfall/gateway/internal/controller"
 	"github.com/planetfall/gateway/internal/controller/search"
 	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 )
 
 type clientMock struct {
@@ -51,17 +53,32 @@ func (m *connectionMock) Close() error {
 	return args.Error(0)
 }
 
-func (m *connectionMock) AuthenticateContext(
-	ctx context.Context) (context.Context, error) {
+func (m *connectionMock) State() connectivity.State {
+	args := m.Called()
+	return args.Get(0).(connectivity.State)
+}
 
-	args := m.Called(ctx)
-	return args.Get(0).(context.Context), args.Error(1)
+func (m *connectionMock) BreakerState() connection.BreakerState {
+	args := m.Called()
+	return args.Get(0).(connection.BreakerState)
 }
 
+// newConnectionMock mocks a connection providing a client, and closing
+// without error.
+func newConnectionMock() *connectionMock {
+	connGiven := &connectionMock{}
+	connGiven.On("Client").Return(&grpc.ClientConn{})
+	connGiven.On("Close").Return(nil)
+	return connGiven
+}
+
+// getController builds a controller with the client and the connection,
+// the options being then changed by the mutators.
 func getController(
 	t *testing.T,
-	clientGiven *clientMock,
-	connGiven *connectionMock) *search.SearchController {
+	clientGiven search.Client,
+	connGiven *connectionMock,
+	mutators ...func(opt *search.SearchControllerOptions)) *search.SearchController {
 
 	loggerGiven := log.Default()
 	reportError := func(err error) {
@@ -86,6 +103,10 @@ func getController(
 		optGiven.Client = clientGiven
 	}
 
+	for _, mutate := range mutators {
+		mutate(&optGiven)
+	}
+
 	c, err := search.NewSearchController(optGiven)
 	assert.Nil(t, err)
 	assert.NotNil(t, c)
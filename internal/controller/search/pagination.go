@@ -0,0 +1,292 @@
+package search
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+)
+
+const (
+	// The default count of results of a page
+	DefaultLimit = 20
+
+	// The default maximum count of results of a page
+	DefaultMaxLimit = 50
+
+	// The default maximum count of results fetched from the backend
+	DefaultMaxFetch = 50
+)
+
+// PaginationOptions holds the parameters of the search pagination.
+//
+// The backend does not support offsets: a page is cut from the first
+// offset + limit results, fetched by the gateway. The pages can then only go
+// as far as the backend maximum count of results.
+type PaginationOptions struct {
+	// The count of results of a page when the client sets none,
+	// DefaultLimit if zero
+	DefaultLimit int
+
+	// The maximum count of results of a page, DefaultMaxLimit if zero
+	MaxLimit int
+
+	// The maximum count of results fetched from the backend, for a page
+	// and all the previous ones. DefaultMaxFetch if zero.
+	MaxFetch int
+
+	// The key signing the cursors. A random one is generated if empty: the
+	// cursors are then only valid for this instance, until it restarts.
+	Secret []byte
+}
+
+func (opt PaginationOptions) withDefaults() (PaginationOptions, error) {
+	if opt.DefaultLimit <= 0 {
+		opt.DefaultLimit = DefaultLimit
+	}
+	if opt.MaxLimit <= 0 {
+		opt.MaxLimit = DefaultMaxLimit
+	}
+	if opt.MaxFetch <= 0 {
+		opt.MaxFetch = DefaultMaxFetch
+	}
+	if len(opt.Secret) == 0 {
+		opt.Secret = make([]byte, 32)
+		if _, err := rand.Read(opt.Secret); err != nil {
+			return opt, fmt.Errorf("rand.Read: %v", err)
+		}
+	}
+
+	if opt.DefaultLimit > opt.MaxLimit {
+		return opt, fmt.Errorf("default limit %d is over the max limit %d",
+			opt.DefaultLimit, opt.MaxLimit)
+	}
+	if opt.MaxLimit > opt.MaxFetch {
+		return opt, fmt.Errorf("max limit %d is over the max fetch %d",
+			opt.MaxLimit, opt.MaxFetch)
+	}
+
+	return opt, nil
+}
+
+// cursor is the position of a page. It holds the search parameters, so the
+// next pages are the ones of the same search.
+type cursor struct {
+	Query     string   `json:"q"`
+	GenreList []string `json:"g,omitempty"`
+	Limit     int      `json:"l"`
+	Offset    int      `json:"o"`
+}
+
+// sign provides the signature of the payload.
+func (opt PaginationOptions) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, opt.Secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// encodeCursor provides the opaque cursor of a page: its JSON payload and
+// its signature, both base64 encoded.
+func (opt PaginationOptions) encodeCursor(cur cursor) (string, error) {
+	payload, err := json.Marshal(cur)
+	if err != nil {
+		return "", fmt.Errorf("json.Marshal: %v", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(opt.sign(payload)), nil
+}
+
+// decodeCursor checks the signature of the cursor and decodes it.
+func (opt PaginationOptions) decodeCursor(value string) (cursor, error) {
+	encodedPayload, encodedSignature, ok := strings.Cut(value, ".")
+	if !ok {
+		return cursor{}, fmt.Errorf("malformed cursor")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return cursor{}, fmt.Errorf("base64.DecodeString: %v", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return cursor{}, fmt.Errorf("base64.DecodeString: %v", err)
+	}
+
+	if !hmac.Equal(signature, opt.sign(payload)) {
+		return cursor{}, fmt.Errorf("invalid cursor signature")
+	}
+
+	var cur cursor
+	if err := json.Unmarshal(payload, &cur); err != nil {
+		return cursor{}, fmt.Errorf("json.Unmarshal: %v", err)
+	}
+
+	return cur, nil
+}
+
+// page resolves the parameters of the requested page. The cursor, if any,
+// replaces the other parameters. The limit defaults to the default limit,
+// and the page must be within the backend maximum count of results.
+func (opt PaginationOptions) page(sp searchParameters) (searchParameters, error) {
+	if sp.Cursor != "" {
+		cur, err := opt.decodeCursor(sp.Cursor)
+		if err != nil {
+			return sp, fmt.Errorf("search.decodeCursor: %v", err)
+		}
+
+		sp = searchParameters{
+			Query:     cur.Query,
+			GenreList: cur.GenreList,
+			Limit:     cur.Limit,
+			Offset:    cur.Offset,
+		}
+	}
+
+	if sp.Limit == 0 {
+		sp.Limit = opt.DefaultLimit
+	}
+
+	switch {
+	case sp.Limit < 0 || sp.Limit > opt.MaxLimit:
+		return sp, fmt.Errorf("limit %d is not between 1 and %d",
+			sp.Limit, opt.MaxLimit)
+	case sp.Offset < 0:
+		return sp, fmt.Errorf("offset %d is negative", sp.Offset)
+	case sp.Offset+sp.Limit > opt.MaxFetch:
+		return sp, fmt.Errorf("offset %d and limit %d are over the %d results",
+			sp.Offset, sp.Limit, opt.MaxFetch)
+	}
+
+	return sp, nil
+}
+
+// pageCursors are the cursors and links of the next and previous pages of a
+// search response, if any.
+type pageCursors struct {
+	Next  string    `json:"next,omitempty"`
+	Prev  string    `json:"prev,omitempty"`
+	Links pageLinks `json:"links"`
+}
+
+// pageLinks are the links to the next and previous pages
+type pageLinks struct {
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// window cuts the page out of a list fetched from the first result.
+func window[T any](items []T, offset int, limit int) []T {
+	if offset >= len(items) {
+		return nil
+	}
+
+	end := offset + limit
+	if end > len(items) {
+		end = len(items)
+	}
+
+	return items[offset:end]
+}
+
+// link provides the URL of the page at the path, from its cursor.
+func link(path string, cur string) string {
+	return path + "?" + url.Values{"cursor": {cur}}.Encode()
+}
+
+// cutPage cuts the page out of the results fetched from the first one.
+func cutPage(sp searchParameters, results *pb.Results) *pb.Results {
+	return &pb.Results{
+		Albums:  window(results.Albums, sp.Offset, sp.Limit),
+		Artists: window(results.Artists, sp.Offset, sp.Limit),
+		Tracks:  window(results.Tracks, sp.Offset, sp.Limit),
+	}
+}
+
+// newPageCursors provides the next and previous cursors of a page of the
+// given count of tracks. A next page is only linked if the page is full, and
+// if the backend can still provide results: the last page may then be
+// shorter.
+func (opt PaginationOptions) newPageCursors(path string,
+	sp searchParameters, tracks int) (pageCursors, error) {
+
+	var p pageCursors
+	base := cursor{
+		Query:     sp.Query,
+		GenreList: sp.GenreList,
+		Limit:     sp.Limit,
+	}
+
+	if tracks == sp.Limit && sp.Offset+sp.Limit < opt.MaxFetch {
+		next := base
+		next.Offset = sp.Offset + sp.Limit
+		if next.Offset+next.Limit > opt.MaxFetch {
+			next.Limit = opt.MaxFetch - next.Offset
+		}
+		cur, err := opt.encodeCursor(next)
+		if err != nil {
+			return p, err
+		}
+		p.Next = cur
+		p.Links.Next = link(path, cur)
+	}
+
+	if sp.Offset > 0 {
+		prev := base
+		prev.Offset = sp.Offset - sp.Limit
+		if prev.Offset < 0 {
+			prev.Offset = 0
+		}
+		cur, err := opt.encodeCursor(prev)
+		if err != nil {
+			return p, err
+		}
+		p.Prev = cur
+		p.Links.Prev = link(path, cur)
+	}
+
+	return p, nil
+}
+
+// withPage completes a page of results with its cursors and links. They are
+// built from the parameters of the request, the page being shared with the
+// requests searching the backend the same way, from another query or other
+// genres.
+func (opt PaginationOptions) withPage(path string,
+	sp searchParameters) decorator {
+
+	return func(body []byte) ([]byte, error) {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(body, &object); err != nil {
+			return nil, fmt.Errorf("json.Unmarshal: %v", err)
+		}
+
+		var page struct {
+			Tracks []json.RawMessage `json:"tracks"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("json.Unmarshal: %v", err)
+		}
+
+		cursors, err := opt.newPageCursors(path, sp, len(page.Tracks))
+		if err != nil {
+			return nil, fmt.Errorf("search.newPageCursors: %v", err)
+		}
+
+		fields, err := json.Marshal(cursors)
+		if err != nil {
+			return nil, fmt.Errorf("json.Marshal: %v", err)
+		}
+		if err := json.Unmarshal(fields, &object); err != nil {
+			return nil, fmt.Errorf("json.Unmarshal: %v", err)
+		}
+
+		return json.Marshal(object)
+	}
+}
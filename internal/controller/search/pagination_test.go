@@ -0,0 +1,237 @@
+package search_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/planetfall/gateway/internal/controller"
+	"github.com/planetfall/gateway/internal/controller/search"
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// pageActual is the decoded search page.
+type pageActual struct {
+	Tracks []*pb.Track `json:"tracks"`
+	Next   string      `json:"next"`
+	Prev   string      `json:"prev"`
+	Links  struct {
+		Next string `json:"next"`
+		Prev string `json:"prev"`
+	} `json:"links"`
+}
+
+// getContextPage builds a search request with the query parameters.
+func getContextPage(t *testing.T, wGiven *httptest.ResponseRecorder,
+	values url.Values) *gin.Context {
+
+	gGiven, _ := gin.CreateTestContext(wGiven)
+	req, err := http.NewRequest(http.MethodGet,
+		"/music-researcher/search?"+values.Encode(), nil)
+	assert.Nil(t, err)
+	gGiven.Request = req
+
+	return gGiven
+}
+
+// getPage calls the search with the query parameters, and decodes the page.
+func getPage(t *testing.T, c *search.SearchController,
+	values url.Values) (int, pageActual) {
+
+	w := httptest.NewRecorder()
+	c.Search(getContextPage(t, w, values))
+
+	var p pageActual
+	if w.Code == http.StatusOK {
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &p))
+	}
+
+	return w.Code, p
+}
+
+// trackIDs provides the IDs of the tracks.
+func trackIDs(tracks []*pb.Track) []string {
+	ids := make([]string, 0, len(tracks))
+	for _, track := range tracks {
+		ids = append(ids, track.ID)
+	}
+	return ids
+}
+
+func TestNewSearchController_withInvalidPagination_shouldFail(t *testing.T) {
+	// given
+	optGiven := search.SearchControllerOptions{
+		ControllerOptions: controller.ControllerOptions{
+			Name:   "name",
+			Target: "target",
+		},
+		Insecure: true,
+		Pagination: search.PaginationOptions{
+			DefaultLimit: 30,
+			MaxLimit:     10,
+		},
+	}
+
+	// when
+	c, err := search.NewSearchController(optGiven)
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid pagination")
+	assert.Nil(t, c)
+}
+
+func TestSearch_withPages(t *testing.T) {
+	// given
+	clientGiven := searchReturning(resultsOf("a", "b", "c", "d", "e"), nil)
+	c := getController(t, clientGiven, newConnectionMock())
+
+	// when
+	codeFirst, first := getPage(t, c, url.Values{
+		"q":     {"query"},
+		"limit": {"2"},
+	})
+	codeSecond, second := getPage(t, c, url.Values{"cursor": {first.Next}})
+	codePrev, prev := getPage(t, c, url.Values{"cursor": {second.Prev}})
+
+	// then
+	assert.Equal(t, http.StatusOK, codeFirst)
+	assert.Equal(t, []string{"a", "b"}, trackIDs(first.Tracks))
+	assert.NotEmpty(t, first.Next)
+	assert.Empty(t, first.Prev)
+	assert.Equal(t, "/music-researcher/search?cursor="+first.Next,
+		first.Links.Next)
+
+	assert.Equal(t, http.StatusOK, codeSecond)
+	assert.Equal(t, []string{"c", "d"}, trackIDs(second.Tracks))
+	assert.NotEmpty(t, second.Prev)
+
+	assert.Equal(t, http.StatusOK, codePrev)
+	assert.Equal(t, []string{"a", "b"}, trackIDs(prev.Tracks))
+
+	// the backend is asked for the results up to the end of the page
+	clientGiven.AssertCalled(t, "Search", "query", int32(2), mock.Anything)
+	clientGiven.AssertCalled(t, "Search", "query", int32(4), mock.Anything)
+}
+
+func TestSearch_withLastPage(t *testing.T) {
+	// given
+	clientGiven := searchReturning(resultsOf("a", "b", "c"), nil)
+	c := getController(t, clientGiven, newConnectionMock())
+
+	// when
+	code, p := getPage(t, c, url.Values{
+		"q":      {"query"},
+		"limit":  {"2"},
+		"offset": {"2"},
+	})
+
+	// then
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"c"}, trackIDs(p.Tracks))
+	assert.Empty(t, p.Next)
+	assert.NotEmpty(t, p.Prev)
+}
+
+func TestSearch_withMaxFetch(t *testing.T) {
+	// given
+	clientGiven := searchReturning(resultsOf("a", "b", "c", "d", "e"), nil)
+	c := getController(t, clientGiven, newConnectionMock(),
+		func(opt *search.SearchControllerOptions) {
+			opt.Pagination = search.PaginationOptions{
+				DefaultLimit: 3,
+				MaxLimit:     3,
+				MaxFetch:     5,
+			}
+		})
+
+	// when
+	_, first := getPage(t, c, url.Values{"q": {"query"}, "limit": {"3"}})
+	_, second := getPage(t, c, url.Values{"cursor": {first.Next}})
+
+	// then
+	assert.Equal(t, []string{"d", "e"}, trackIDs(second.Tracks))
+	assert.Empty(t, second.Next)
+	clientGiven.AssertCalled(t, "Search", "query", int32(5), mock.Anything)
+}
+
+func TestSearch_withCachedPage_shouldKeepRequestCursors(t *testing.T) {
+	// given
+	clientGiven := searchReturning(resultsOf("a", "b", "c"), nil)
+	c := getController(t, clientGiven, newConnectionMock(), withCache)
+
+	// when
+	_, first := getPage(t, c,
+		url.Values{"q": {"daft genre:house"}, "limit": {"1"}})
+	_, second := getPage(t, c,
+		url.Values{"q": {"daft"}, "genre": {"house"}, "limit": {"1"}})
+
+	// then
+	// the page is cached once, the cursors being the ones of each request
+	clientGiven.AssertNumberOfCalls(t, "Search", 1)
+	assert.Equal(t, trackIDs(first.Tracks), trackIDs(second.Tracks))
+
+	payload, _, _ := strings.Cut(second.Next, ".")
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"q": "daft", "g": ["house"], "l": 1, "o": 1}`,
+		string(decoded))
+	assert.Contains(t, second.Links.Next, second.Next)
+	assert.NotEqual(t, first.Next, second.Next)
+}
+
+func TestSearch_withInvalidPage_shouldFail(t *testing.T) {
+	// given
+	c := getController(t,
+		searchReturning(resultsOf("a", "b", "c"), nil), newConnectionMock())
+	_, first := getPage(t, c, url.Values{"q": {"query"}, "limit": {"1"}})
+	payload, signature, _ := strings.Cut(first.Next, ".")
+
+	casesGiven := map[string]url.Values{
+		"limit over the max": {"q": {"query"}, "limit": {"51"}},
+		"negative limit":     {"q": {"query"}, "limit": {"-1"}},
+		"negative offset":    {"q": {"query"}, "offset": {"-1"}},
+		"over the max fetch": {"q": {"query"}, "offset": {"40"}, "limit": {"20"}},
+		"malformed cursor":   {"cursor": {"cursor"}},
+		"tampered cursor":    {"cursor": {payload + "x." + signature}},
+		"forged cursor": {"cursor": {payload + "." +
+			strings.Repeat("A", len(signature))}},
+	}
+
+	for name, valuesGiven := range casesGiven {
+		t.Run(name, func(t *testing.T) {
+			// when
+			code, _ := getPage(t, c, valuesGiven)
+
+			// then
+			assert.Equal(t, http.StatusBadRequest, code)
+		})
+	}
+}
+
+func TestSearch_withCursorFromOtherSecret_shouldFail(t *testing.T) {
+	// given
+	clientGiven := searchReturning(resultsOf("a", "b"), nil)
+	c := getController(t, clientGiven, newConnectionMock(),
+		func(opt *search.SearchControllerOptions) {
+			opt.Pagination.Secret = []byte("secret")
+		})
+	other := getController(t, clientGiven, newConnectionMock(),
+		func(opt *search.SearchControllerOptions) {
+			opt.Pagination.Secret = []byte("other")
+		})
+	_, first := getPage(t, other, url.Values{"q": {"query"}, "limit": {"1"}})
+
+	// when
+	code, _ := getPage(t, c, url.Values{"cursor": {first.Next}})
+
+	// then
+	assert.Equal(t, http.StatusBadRequest, code)
+}
@@ -0,0 +1,306 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The field qualifiers understood by the query parser
+const (
+	FieldArtist = "artist"
+	FieldAlbum  = "album"
+	FieldTrack  = "track"
+	FieldYear   = "year"
+	FieldGenre  = "genre"
+)
+
+// queryFields are the known field qualifiers. A word with an unknown
+// qualifier, such as `re:zero`, is free text.
+var queryFields = map[string]bool{
+	FieldArtist: true,
+	FieldAlbum:  true,
+	FieldTrack:  true,
+	FieldYear:   true,
+	FieldGenre:  true,
+}
+
+// QueryError is a malformed query. The position is the offset of the faulty
+// term in the query, counted in characters from zero.
+type QueryError struct {
+	Position int
+	Reason   string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Reason, e.Position)
+}
+
+// queryTerm is a term of the parsed query. It spans the characters from
+// Start to End, excluded, of the query typed by the user.
+type queryTerm struct {
+	Field   string `json:"field,omitempty"`
+	Value   string `json:"value"`
+	Phrase  bool   `json:"phrase,omitempty"`
+	Negated bool   `json:"negated,omitempty"`
+	Start   int    `json:"start"`
+	End     int    `json:"end"`
+}
+
+// String provides the term in the query syntax.
+func (t queryTerm) String() string {
+	var b strings.Builder
+	if t.Negated {
+		b.WriteString("-")
+	}
+	if t.Field != "" {
+		b.WriteString(t.Field + ":")
+	}
+	if t.Phrase || strings.Contains(t.Value, " ") {
+		b.WriteString(strconv.Quote(t.Value))
+	} else {
+		b.WriteString(t.Value)
+	}
+
+	return b.String()
+}
+
+// parsedQuery is the interpretation of the query typed by the user, echoed
+// back in the search response. The genre terms are folded into the genre
+// filters, the other terms are sent to the backend as the query.
+type parsedQuery struct {
+	Terms  []queryTerm `json:"terms"`
+	Query  string      `json:"backend_query"`
+	Genres []string    `json:"genres"`
+}
+
+// isQuote tells if the character opens or closes a phrase.
+func isQuote(r rune) bool {
+	return r == '"'
+}
+
+// scanner walks through the characters of a query.
+type scanner struct {
+	runes []rune
+	pos   int
+}
+
+func (s *scanner) done() bool {
+	return s.pos >= len(s.runes)
+}
+
+func (s *scanner) atSpace() bool {
+	return s.done() || unicode.IsSpace(s.runes[s.pos])
+}
+
+func (s *scanner) skipSpaces() {
+	for !s.done() && unicode.IsSpace(s.runes[s.pos]) {
+		s.pos++
+	}
+}
+
+// word reads the characters up to the next space, or up to the first
+// stop character.
+func (s *scanner) word(stop func(rune) bool) string {
+	start := s.pos
+	for !s.atSpace() && !stop(s.runes[s.pos]) {
+		s.pos++
+	}
+
+	return string(s.runes[start:s.pos])
+}
+
+// value reads the value of a term, a phrase if it is quoted, else a word.
+func (s *scanner) value(term *queryTerm) error {
+	if s.atSpace() {
+		return &QueryError{s.pos, "missing value"}
+	}
+
+	if !isQuote(s.runes[s.pos]) {
+		start := s.pos
+		term.Value = s.word(isQuote)
+		if !s.atSpace() {
+			return &QueryError{s.pos, "unexpected quote"}
+		}
+		if term.Value == "" {
+			return &QueryError{start, "missing value"}
+		}
+		return nil
+	}
+
+	open := s.pos
+	s.pos++
+	start := s.pos
+	for !s.done() && !isQuote(s.runes[s.pos]) {
+		s.pos++
+	}
+	if s.done() {
+		return &QueryError{open, "unterminated quote"}
+	}
+
+	term.Value = strings.Join(strings.Fields(string(s.runes[start:s.pos])), " ")
+	term.Phrase = true
+	s.pos++
+
+	switch {
+	case term.Value == "":
+		return &QueryError{open, "empty phrase"}
+	case !s.atSpace():
+		return &QueryError{s.pos, "missing space after quote"}
+	}
+
+	return nil
+}
+
+// extend appends to the unquoted value of a qualifier the plain words
+// following it, up to the next qualifier, phrase, negated term or dash.
+func (s *scanner) extend(term *queryTerm) {
+	for {
+		start := s.pos
+		s.skipSpaces()
+		if s.done() || s.runes[s.pos] == '-' || isQuote(s.runes[s.pos]) {
+			s.pos = start
+			return
+		}
+
+		word := s.word(isQuote)
+		field, _, qualified := strings.Cut(word, ":")
+		if !s.atSpace() || (qualified && queryFields[strings.ToLower(field)]) {
+			s.pos = start
+			return
+		}
+		term.Value += " " + word
+	}
+}
+
+// term reads the next term: a word or a quoted phrase, optionally qualified
+// by a field, and negated by a leading dash. A dash on its own is a word.
+// The unquoted value of a qualifier spans the plain words following it,
+// except for a year.
+func (s *scanner) term() (queryTerm, error) {
+	term := queryTerm{Start: s.pos}
+
+	if s.runes[s.pos] == '-' {
+		s.pos++
+		if s.atSpace() {
+			term.Value = "-"
+			term.End = s.pos
+			return term, nil
+		}
+		term.Negated = true
+	}
+
+	// a known field qualifier, else the word is read again as free text
+	start := s.pos
+	field := strings.ToLower(s.word(func(r rune) bool {
+		return r == ':' || isQuote(r)
+	}))
+	if !s.atSpace() && s.runes[s.pos] == ':' && queryFields[field] {
+		term.Field = field
+		s.pos++
+	} else {
+		s.pos = start
+	}
+
+	if err := s.value(&term); err != nil {
+		return term, err
+	}
+	if term.Field != "" && term.Field != FieldYear && !term.Phrase {
+		s.extend(&term)
+	}
+	term.End = s.pos
+
+	return term, nil
+}
+
+// isNotDigit tells if the character is not an ASCII digit.
+func isNotDigit(r rune) bool {
+	return r < '0' || r > '9'
+}
+
+// validateYear checks the value of a year term, a year or a range of years.
+func validateYear(value string) error {
+	from, to, isRange := strings.Cut(value, "-")
+	if !isRange {
+		to = from
+	}
+
+	for _, year := range []string{from, to} {
+		if len(year) != 4 || strings.IndexFunc(year, isNotDigit) >= 0 {
+			return fmt.Errorf("invalid year %q", year)
+		}
+	}
+	if from > to {
+		return fmt.Errorf("invalid year range %q", value)
+	}
+
+	return nil
+}
+
+// parseQuery parses the query typed by the user. It understands:
+//
+//   - the free words: daft punk
+//   - the quoted phrases: "one more time"
+//   - the field qualifiers: artist:daft, album:"discovery", year:2001,
+//     year:1990-1999 or genre:house
+//   - the negation of a term: -live, -artist:"various artists"
+//
+// The unquoted value of a qualifier runs up to the next qualifier, phrase,
+// negated term or lone dash: `artist:daft punk -live` is the artist daft
+// punk, without live. A year is a single word. A dash on its own, as in
+// `AC/DC - Back in Black`, is kept as a word. The genre terms are folded into
+// the genre filters, and cannot then be negated. The malformed queries fail
+// with a QueryError.
+func parseQuery(query string) (parsedQuery, error) {
+	parsed := parsedQuery{Terms: []queryTerm{}, Genres: []string{}}
+	s := &scanner{runes: []rune(query)}
+	kept := make([]string, 0)
+
+	for s.skipSpaces(); !s.done(); s.skipSpaces() {
+		term, err := s.term()
+		if err != nil {
+			return parsed, err
+		}
+
+		switch term.Field {
+		case FieldGenre:
+			if term.Negated {
+				return parsed, &QueryError{term.Start, "genre cannot be negated"}
+			}
+			parsed.Genres = append(parsed.Genres, term.Value)
+		case FieldYear:
+			if err := validateYear(term.Value); err != nil {
+				return parsed, &QueryError{term.Start, err.Error()}
+			}
+			kept = append(kept, term.String())
+		default:
+			kept = append(kept, term.String())
+		}
+
+		parsed.Terms = append(parsed.Terms, term)
+	}
+
+	parsed.Query = strings.Join(kept, " ")
+	return parsed, nil
+}
+
+// withQuery adds the parsed query to the JSON object of the body, under the
+// query key.
+func withQuery(parsed parsedQuery) decorator {
+	return func(body []byte) ([]byte, error) {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(body, &object); err != nil {
+			return nil, fmt.Errorf("json.Unmarshal: %v", err)
+		}
+
+		query, err := json.Marshal(parsed)
+		if err != nil {
+			return nil, fmt.Errorf("json.Marshal: %v", err)
+		}
+		object["query"] = query
+
+		return json.Marshal(object)
+	}
+}
@@ -0,0 +1,211 @@
+package search_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/planetfall/gateway/internal/controller/search"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// queryActual is the decoded interpretation of the query.
+type queryActual struct {
+	Terms []struct {
+		Field   string `json:"field"`
+		Value   string `json:"value"`
+		Phrase  bool   `json:"phrase"`
+		Negated bool   `json:"negated"`
+		Start   int    `json:"start"`
+		End     int    `json:"end"`
+	} `json:"terms"`
+	BackendQuery string   `json:"backend_query"`
+	Genres       []string `json:"genres"`
+}
+
+// getQueryActual decodes the interpretation of the query in the response.
+func getQueryActual(t *testing.T, w *httptest.ResponseRecorder) queryActual {
+	var body struct {
+		Query queryActual `json:"query"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+
+	return body.Query
+}
+
+func TestSearch_withStructuredQuery(t *testing.T) {
+	// given
+	clientGiven := searchReturning(resultsOf("a"), nil)
+	c := getController(t, clientGiven, nil)
+	queryGiven := `artist:"Daft  Punk" genre:house year:2001 -live "one more time"`
+
+	// when
+	w := httptest.NewRecorder()
+	c.Search(getContextPage(t, w, url.Values{
+		"q":     {queryGiven},
+		"genre": {"electro"},
+		"limit": {"5"},
+	}))
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	clientGiven.AssertCalled(t, "Search",
+		`artist:"Daft Punk" year:2001 -live "one more time"`, int32(5),
+		[]string{"electro", "house"})
+
+	queryActual := getQueryActual(t, w)
+	assert.Equal(t, `artist:"Daft Punk" year:2001 -live "one more time"`,
+		queryActual.BackendQuery)
+	assert.Equal(t, []string{"house"}, queryActual.Genres)
+	assert.Len(t, queryActual.Terms, 5)
+
+	artist := queryActual.Terms[0]
+	assert.Equal(t, search.FieldArtist, artist.Field)
+	assert.Equal(t, "Daft Punk", artist.Value)
+	assert.True(t, artist.Phrase)
+	assert.Equal(t, 0, artist.Start)
+	assert.Equal(t, len(`artist:"Daft  Punk"`), artist.End)
+
+	live := queryActual.Terms[3]
+	assert.Equal(t, "live", live.Value)
+	assert.True(t, live.Negated)
+	assert.Equal(t, "-live", queryGiven[live.Start:live.End])
+}
+
+func TestSearch_withUnknownQualifier(t *testing.T) {
+	// given
+	clientGiven := searchReturning(resultsOf("a"), nil)
+	c := getController(t, clientGiven, nil)
+
+	// when
+	w := httptest.NewRecorder()
+	c.Search(getContextPage(t, w, url.Values{"q": {"re:zero ARTIST:x"}}))
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	clientGiven.AssertCalled(t, "Search",
+		"re:zero artist:x", mock.Anything, mock.Anything)
+}
+
+func TestSearch_withUnquotedQualifierValue(t *testing.T) {
+	// given
+	clientGiven := searchReturning(resultsOf("a"), nil)
+	c := getController(t, clientGiven, nil)
+
+	// when
+	w := httptest.NewRecorder()
+	c.Search(getContextPage(t, w, url.Values{
+		"q": {"artist:daft punk genre:deep house year:2001 discovery -live"},
+	}))
+
+	// then
+	// the value runs up to the next qualifier or negated term, a year being
+	// a single word
+	assert.Equal(t, http.StatusOK, w.Code)
+	clientGiven.AssertCalled(t, "Search",
+		`artist:"daft punk" year:2001 discovery -live`, mock.Anything,
+		[]string{"deep house"})
+
+	queryActual := getQueryActual(t, w)
+	assert.Len(t, queryActual.Terms, 5)
+	assert.Equal(t, search.FieldArtist, queryActual.Terms[0].Field)
+	assert.Equal(t, "daft punk", queryActual.Terms[0].Value)
+	assert.False(t, queryActual.Terms[0].Phrase)
+	assert.Equal(t, len("artist:daft punk"), queryActual.Terms[0].End)
+	assert.Equal(t, "deep house", queryActual.Terms[1].Value)
+	assert.Empty(t, queryActual.Terms[3].Field)
+	assert.Equal(t, "discovery", queryActual.Terms[3].Value)
+}
+
+func TestSearch_withLoneDash(t *testing.T) {
+	queriesGiven := map[string]string{
+		"daft punk - one more time": "daft punk - one more time",
+		"AC/DC - Back in Black":     "AC/DC - Back in Black",
+		"artist:AC/DC - Back":       "artist:AC/DC - Back",
+		"daft punk -":               "daft punk -",
+	}
+
+	for queryGiven, backendExpected := range queriesGiven {
+		t.Run(queryGiven, func(t *testing.T) {
+			// given
+			clientGiven := searchReturning(resultsOf("a"), nil)
+			c := getController(t, clientGiven, nil)
+
+			// when
+			w := httptest.NewRecorder()
+			c.Search(getContextPage(t, w, url.Values{"q": {queryGiven}}))
+
+			// then
+			assert.Equal(t, http.StatusOK, w.Code)
+			clientGiven.AssertCalled(t, "Search",
+				backendExpected, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestSearch_withMalformedQuery_shouldFail(t *testing.T) {
+	// given
+	clientGiven := &clientMock{}
+	c := getController(t, clientGiven, nil)
+
+	casesGiven := map[string]string{
+		`daft "one more time`: "unterminated quote at position 5",
+		`daft artist:`:        "missing value at position 12",
+		`daft ""`:             "empty phrase at position 5",
+		`"daft"punk`:          "missing space after quote at position 6",
+		`daft pu"nk`:          "unexpected quote at position 7",
+		`daft -genre:pop`:     "genre cannot be negated at position 5",
+		`daft year:20o1`:      `invalid year "20o1" at position 5`,
+		`daft year:2001-1999`: `invalid year range "2001-1999" at position 5`,
+		`daft artist:"punk`:   "unterminated quote at position 12",
+		`ça "va`:              "unterminated quote at position 3",
+	}
+
+	for queryGiven, detailExpected := range casesGiven {
+		t.Run(queryGiven, func(t *testing.T) {
+			// when
+			w := httptest.NewRecorder()
+			c.Search(getContextPage(t, w, url.Values{"q": {queryGiven}}))
+
+			// then
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+
+			var body map[string]interface{}
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, "malformed query: "+detailExpected, body["detail"])
+		})
+	}
+	clientGiven.AssertNotCalled(t, "Search")
+}
+
+func TestSearch_withCacheAndQualifiedGenre(t *testing.T) {
+	// given
+	clientGiven := &clientMock{}
+	clientGiven.On("Search", mock.Anything, mock.Anything, mock.Anything).
+		Return(resultsOf("a"), nil).Once()
+	c := getController(t, clientGiven, newConnectionMock(), withCache)
+
+	// when
+	wFirst := httptest.NewRecorder()
+	c.Search(getContextPage(t, wFirst, url.Values{
+		"q":     {"daft genre:house"},
+		"limit": {"2"},
+	}))
+	wSecond := httptest.NewRecorder()
+	c.Search(getContextPage(t, wSecond, url.Values{
+		"q":     {"daft"},
+		"genre": {"house"},
+		"limit": {"2"},
+	}))
+
+	// then
+	clientGiven.AssertNumberOfCalls(t, "Search", 1)
+	assert.Equal(t, search.CacheHit, wSecond.Header().Get(search.CacheHeader))
+	assert.Len(t, getQueryActual(t, wFirst).Terms, 2)
+	assert.Len(t, getQueryActual(t, wSecond).Terms, 1)
+	assert.NotEqual(t,
+		wFirst.Header().Get("ETag"), wSecond.Header().Get("ETag"))
+}
@@ -0,0 +1,175 @@
+package search
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/planetfall/gateway/internal/cache"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The Warning header values sent back with a stale response, as defined by
+// the [RFC 7234].
+//
+// [RFC 7234]: https://datatracker.ietf.org/doc/html/rfc7234#section-5.5
+const (
+	WarningStale              = `110 - "Response is Stale"`
+	WarningRevalidationFailed = `111 - "Revalidation Failed"`
+)
+
+// staleCodes are the backend failures answered with a stale response, when
+// one is cached. The open circuit breaker fails with Unavailable.
+var staleCodes = map[codes.Code]bool{
+	codes.Unavailable:       true,
+	codes.DeadlineExceeded:  true,
+	codes.ResourceExhausted: true,
+	codes.Internal:          true,
+	codes.Unknown:           true,
+}
+
+// backendCall calls the backend with the context, and provides the response
+// to send back.
+type backendCall func(ctx context.Context) (interface{}, error)
+
+// decorator completes the body of a response, once taken from the cache or
+// from the backend, with the parts depending on the request only.
+type decorator func(body []byte) ([]byte, error)
+
+// chain provides a decorator applying the decorators in order.
+func chain(decorators ...decorator) decorator {
+	return func(body []byte) ([]byte, error) {
+		for _, decorate := range decorators {
+			var err error
+			if body, err = decorate(body); err != nil {
+				return nil, err
+			}
+		}
+		return body, nil
+	}
+}
+
+// detach provides a context which is not canceled with the request, so a
+// call shared with other requests, or run in background, is not canceled by
+// the client going away. The values are kept, but not the deadline, which
+// may be a short one of the client: the timeout applies instead.
+func detach(ctx context.Context,
+	timeout time.Duration) (context.Context, context.CancelFunc) {
+
+	return context.WithTimeout(context.WithoutCancel(ctx), timeout)
+}
+
+// load calls the backend and caches the response, if the route is cached.
+func (c *SearchController) load(ctx context.Context,
+	route string, key string, call backendCall) (interface{}, error) {
+
+	response, err := call(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.store(route, key, response)
+}
+
+// fetch loads the response of the key. When the calls are coalesced, the
+// identical calls in flight share the call of the first one, which does not
+// depend on its client: it has the route timeout, and each caller still
+// stops waiting when its own context is done.
+func (c *SearchController) fetch(ctx context.Context, timeout time.Duration,
+	route string, key string, call backendCall) (cache.Entry, error) {
+
+	if !c.cacheOpt.Coalesce {
+		entry, err := c.load(ctx, route, key, call)
+		if err != nil {
+			return cache.Entry{}, err
+		}
+		return entry.(cache.Entry), nil
+	}
+
+	shared := func() (interface{}, error) {
+		detached, cancel := detach(ctx, timeout)
+		defer cancel()
+
+		return c.load(detached, route, key, call)
+	}
+
+	select {
+	case res := <-c.flights.DoChan(key, shared):
+		if res.Err != nil {
+			return cache.Entry{}, res.Err
+		}
+		return res.Val.(cache.Entry), nil
+	case <-ctx.Done():
+		return cache.Entry{}, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// revalidate refreshes the response in background, within the route
+// timeout. The refreshes of a key are collapsed into one backend call.
+func (c *SearchController) revalidate(ctx context.Context,
+	timeout time.Duration, logger *log.Logger, route string, key string,
+	call backendCall) {
+
+	detached, cancel := detach(ctx, timeout)
+
+	go func() {
+		defer cancel()
+
+		res := <-c.flights.DoChan(key, func() (interface{}, error) {
+			return c.load(detached, route, key, call)
+		})
+		if res.Err != nil {
+			logger.Printf("revalidation failed: %v", res.Err)
+		}
+	}()
+}
+
+// respond answers the request with the response of the key.
+//
+// The fresh cached response is served if any. Once expired, it is still
+// served during the stale-while-revalidate window, while it is refreshed in
+// background. Otherwise the backend is called: if it fails during the
+// stale-if-error window, the stale response is served instead of the error.
+// The stale responses are flagged by the Warning header. The response is
+// completed by the decorator, if any.
+func (c *SearchController) respond(g *gin.Context, ctx context.Context,
+	logger *log.Logger, route string, key string, call backendCall,
+	decorate decorator) {
+
+	if entry, ok := c.cached(route, key); ok {
+		logger.Printf("served from cache")
+		c.serve(g, route, entry, CacheHit, decorate)
+		return
+	}
+
+	stale, hasStale := c.stale(route, key)
+	if hasStale &&
+		time.Since(stale.Expires) < c.cacheOpt.StaleWhileRevalidate {
+
+		logger.Printf("served stale from cache, revalidating")
+		c.revalidate(ctx, c.RouteTimeout(g), logger, route, key, call)
+		g.Header("Warning", WarningStale)
+		c.serve(g, route, stale, CacheStale, decorate)
+		return
+	}
+
+	entry, err := c.fetch(ctx, c.RouteTimeout(g), route, key, call)
+	if err == nil {
+		c.serve(g, route, entry, CacheMiss, decorate)
+		return
+	}
+
+	if hasStale && staleCodes[status.Code(err)] &&
+		time.Since(stale.Expires) < c.cacheOpt.StaleIfError {
+
+		logger.Printf("served stale from cache: %v", err)
+		g.Header("Warning", WarningRevalidationFailed)
+		c.serve(g, route, stale, CacheStale, decorate)
+		return
+	}
+
+	c.count(route, CacheMiss)
+	c.BackendError(err, g)
+}
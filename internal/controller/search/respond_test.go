@@ -0,0 +1,173 @@
+package search_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/planetfall/gateway/internal/controller"
+	"github.com/planetfall/gateway/internal/controller/search"
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSearch_withCoalescedCalls(t *testing.T) {
+	// given
+	release := make(chan struct{})
+	clientGiven := &clientMock{}
+	clientGiven.On("Search", mock.Anything, mock.Anything, mock.Anything).
+		Run(func(mock.Arguments) { <-release }).
+		Return(resultsOf("a"), nil)
+	c := getController(t, clientGiven, newConnectionMock(),
+		func(opt *search.SearchControllerOptions) {
+			opt.Cache.Coalesce = true
+		})
+	callsGiven := 10
+
+	// when
+	var wg sync.WaitGroup
+	codes := make([]int, callsGiven)
+	for i := 0; i < callsGiven; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			c.Search(getContextSearch(t, w, "query", 1, nil))
+			codes[i] = w.Code
+		}(i)
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	// then
+	clientGiven.AssertNumberOfCalls(t, "Search", 1)
+	for _, code := range codes {
+		assert.Equal(t, http.StatusOK, code)
+	}
+}
+
+func TestSearch_withCoalescedCallsAndShortClientTimeout(t *testing.T) {
+	// given
+	clientGiven := &slowClient{delay: 100 * time.Millisecond}
+	c := getController(t, clientGiven, newConnectionMock(),
+		func(opt *search.SearchControllerOptions) {
+			opt.Cache.Coalesce = true
+		})
+
+	// when
+	wFirst := httptest.NewRecorder()
+	gFirst := getContextSearch(t, wFirst, "query", 1, nil)
+	gFirst.Request.Header.Set(controller.TimeoutHeader, "20ms")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Search(gFirst)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	wSecond := httptest.NewRecorder()
+	c.Search(getContextSearch(t, wSecond, "query", 1, nil))
+	<-done
+
+	// then
+	// the shared call outlives the first caller deadline
+	assert.Equal(t, http.StatusGatewayTimeout, wFirst.Code)
+	assert.Equal(t, http.StatusOK, wSecond.Code)
+	assert.Equal(t, int32(1), clientGiven.maxInFlight.Load())
+}
+
+func TestSearch_withStaleIfError(t *testing.T) {
+	// given
+	clientGiven := &clientMock{}
+	clientGiven.On("Search", mock.Anything, mock.Anything, mock.Anything).
+		Return(resultsOf("a"), nil).Once()
+	clientGiven.On("Search", mock.Anything, mock.Anything, mock.Anything).
+		Return(&pb.Results{}, status.Error(codes.Unavailable, "down"))
+	c := getController(t, clientGiven, newConnectionMock(),
+		func(opt *search.SearchControllerOptions) {
+			opt.Cache.SearchTTL = 20 * time.Millisecond
+			opt.Cache.StaleIfError = time.Hour
+		})
+
+	c.Search(getContextSearch(t, httptest.NewRecorder(), "query", 1, nil))
+	time.Sleep(30 * time.Millisecond)
+
+	// when
+	w := httptest.NewRecorder()
+	c.Search(getContextSearch(t, w, "query", 1, nil))
+
+	// then
+	clientGiven.AssertNumberOfCalls(t, "Search", 2)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, search.CacheStale, w.Header().Get(search.CacheHeader))
+	assert.Equal(t, search.WarningRevalidationFailed, w.Header().Get("Warning"))
+	assert.Equal(t, "max-age=0", w.Header().Get("Cache-Control"))
+	assert.Len(t, getSearchResultsActual(t, w).Tracks, 1)
+}
+
+func TestSearch_withStaleIfErrorAndClientError(t *testing.T) {
+	// given
+	clientGiven := &clientMock{}
+	clientGiven.On("Search", mock.Anything, mock.Anything, mock.Anything).
+		Return(resultsOf("a"), nil).Once()
+	clientGiven.On("Search", mock.Anything, mock.Anything, mock.Anything).
+		Return(&pb.Results{}, status.Error(codes.InvalidArgument, "invalid"))
+	c := getController(t, clientGiven, newConnectionMock(),
+		func(opt *search.SearchControllerOptions) {
+			opt.Cache.SearchTTL = 20 * time.Millisecond
+			opt.Cache.StaleIfError = time.Hour
+		})
+
+	c.Search(getContextSearch(t, httptest.NewRecorder(), "query", 1, nil))
+	time.Sleep(30 * time.Millisecond)
+
+	// when
+	w := httptest.NewRecorder()
+	c.Search(getContextSearch(t, w, "query", 1, nil))
+
+	// then
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, w.Header().Get("Warning"))
+}
+
+func TestSearch_withStaleWhileRevalidate(t *testing.T) {
+	// given
+	clientGiven := &clientMock{}
+	clientGiven.On("Search", mock.Anything, mock.Anything, mock.Anything).
+		Return(resultsOf("a"), nil).Once()
+	clientGiven.On("Search", mock.Anything, mock.Anything, mock.Anything).
+		Return(resultsOf("a", "b"), nil)
+	c := getController(t, clientGiven, newConnectionMock(),
+		func(opt *search.SearchControllerOptions) {
+			opt.Cache.SearchTTL = 50 * time.Millisecond
+			opt.Cache.StaleWhileRevalidate = time.Hour
+		})
+
+	c.Search(getContextSearch(t, httptest.NewRecorder(), "query", 2, nil))
+	time.Sleep(60 * time.Millisecond)
+
+	// when
+	w := httptest.NewRecorder()
+	c.Search(getContextSearch(t, w, "query", 2, nil))
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, search.CacheStale, w.Header().Get(search.CacheHeader))
+	assert.Equal(t, search.WarningStale, w.Header().Get("Warning"))
+	assert.Len(t, getSearchResultsActual(t, w).Tracks, 1)
+
+	// the response is refreshed in background
+	assert.Eventually(t, func() bool {
+		w := httptest.NewRecorder()
+		c.Search(getContextSearch(t, w, "query", 2, nil))
+		return w.Header().Get(search.CacheHeader) == search.CacheHit &&
+			len(getSearchResultsActual(t, w).Tracks) == 2
+	}, time.Second, 5*time.Millisecond)
+	clientGiven.AssertNumberOfCalls(t, "Search", 2)
+}
@@ -5,9 +5,11 @@ package search
 import (
 	"fmt"
 
+	"github.com/planetfall/gateway/internal/cache"
 	"github.com/planetfall/gateway/internal/connection/grpc"
 	"github.com/planetfall/gateway/internal/controller"
 	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"golang.org/x/sync/singleflight"
 )
 
 // SearchController is used to interact with the music researcher service.
@@ -15,12 +17,39 @@ type SearchController struct {
 	// Reference to the base controller type
 	controller.Controller
 
-	// The connection to setup the client and authenticate the request context
-	conn grpc.Connection
+	// The variant of the [github.com/planetfall/musicresearcher] service
+	// serving the requests by default
+	stable variant
 
-	// The generate protobuf client for the
-	// [github.com/planetfall/musicresearcher] service
-	client pb.MusicResearcherClient
+	// The variant serving a share of the requests, nil if no canary is
+	// configured
+	canary *variant
+
+	// The canary parameters
+	canaryOpt CanaryOptions
+
+	// The variant the search requests are mirrored to, nil if no shadow is
+	// configured
+	shadow *shadow
+
+	// The cached responses, nil if no route is cached
+	responses cache.Cache
+
+	// The cache parameters
+	cacheOpt CacheOptions
+
+	// The identical backend calls in flight
+	flights singleflight.Group
+
+	// The search pagination parameters
+	pagination PaginationOptions
+
+	// The genre catalog the genre filters are validated against, nil if the
+	// genre filters are not validated
+	catalog *catalog
+
+	// The batch search parameters
+	batchOpt BatchOptions
 }
 
 // SearchControllerOptions holds the parameters for the ResearcherController
@@ -32,6 +61,42 @@ type SearchControllerOptions struct {
 	// Insecure for [grpc] connection builder parameters
 	Insecure bool
 
+	// Interceptors for [grpc] connection builder parameters
+	Interceptors grpc.InterceptorOptions
+
+	// Auth for [grpc] connection builder parameters
+	Auth grpc.AuthOptions
+
+	// TLS for [grpc] connection builder parameters
+	TLS grpc.TLSOptions
+
+	// Endpoints for [grpc] connection builder parameters
+	Endpoints []grpc.Endpoint
+
+	// Balancing for [grpc] connection builder parameters
+	Balancing grpc.BalancingOptions
+
+	// Keepalive for [grpc] connection builder parameters
+	Keepalive grpc.KeepaliveOptions
+
+	// The canary variant parameters (optional)
+	Canary CanaryOptions
+
+	// The shadow variant parameters (optional)
+	Shadow ShadowOptions
+
+	// The response cache parameters (optional)
+	Cache CacheOptions
+
+	// The search pagination parameters (optional)
+	Pagination PaginationOptions
+
+	// The genre catalog parameters (optional)
+	Catalog CatalogOptions
+
+	// The batch search parameters (optional)
+	Batch BatchOptions
+
 	// Protobuf custom client (optional)
 	Client Client
 
@@ -48,8 +113,14 @@ func getConn(opt SearchControllerOptions) (grpc.Connection, error) {
 	}
 
 	return grpc.NewConnection(grpc.ConnectionOptions{
-		Target:   opt.ControllerOptions.Target,
-		Insecure: opt.Insecure,
+		Target:       opt.ControllerOptions.Target,
+		Insecure:     opt.Insecure,
+		Interceptors: opt.Interceptors,
+		Auth:         opt.Auth,
+		TLS:          opt.TLS,
+		Endpoints:    opt.Endpoints,
+		Balancing:    opt.Balancing,
+		Keepalive:    opt.Keepalive,
 	})
 }
 
@@ -73,6 +144,11 @@ func NewSearchController(
 	// initialize the base type
 	ctrl := controller.NewController(opt.ControllerOptions)
 
+	pagination, err := opt.Pagination.withDefaults()
+	if err != nil {
+		return nil, fmt.Errorf("invalid pagination: %v", err)
+	}
+
 	// setup the connection
 	conn, err := getConn(opt)
 	if err != nil {
@@ -82,17 +158,76 @@ func NewSearchController(
 	// setup the client
 	client := getClient(opt, conn)
 
+	// setup the canary, if any
+	canary, err := newCanary(opt)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("search.newCanary: %v", err)
+	}
+
+	// setup the shadow, if any
+	shadow, err := newShadow(opt, opt.ControllerOptions.Logger)
+	if err != nil {
+		conn.Close()
+		if canary != nil {
+			canary.conn.Close()
+		}
+		return nil, fmt.Errorf("search.newShadow: %v", err)
+	}
+
 	return &SearchController{
 		Controller: ctrl,
-		client:     client,
-		conn:       conn,
+		stable: variant{
+			name:   VariantStable,
+			conn:   conn,
+			client: client,
+		},
+		canary:     canary,
+		canaryOpt:  opt.Canary,
+		shadow:     shadow,
+		responses:  getCache(opt.Cache),
+		cacheOpt:   opt.Cache,
+		pagination: pagination,
+		catalog:    newCatalog(opt.Catalog, client, ctrl.Logger),
+		batchOpt:   opt.Batch.withDefaults(),
 	}, nil
 }
 
-// Close terminates the inner GRPC connection
+// Close terminates the inner GRPC connections. It waits for the mirrored
+// calls in flight, and stops refreshing the genre catalog.
 func (c *SearchController) Close() error {
-	if err := c.conn.Close(); err != nil {
+	c.catalog.close()
+
+	if err := c.stable.conn.Close(); err != nil {
 		return fmt.Errorf("connection.Close: %v", err)
 	}
+
+	if c.canary != nil {
+		if err := c.canary.conn.Close(); err != nil {
+			return fmt.Errorf("connection.Close: %v", err)
+		}
+	}
+
+	if c.shadow != nil {
+		if err := c.shadow.Close(); err != nil {
+			return fmt.Errorf("shadow.Close: %v", err)
+		}
+	}
+
 	return nil
 }
+
+// CheckHealth reports the connectivity state of the GRPC connection. The
+// controller is only down if the stable variant is: the canary state is
+// reported in the reason.
+func (c *SearchController) CheckHealth() controller.Health {
+	health := controller.ConnectionHealth(c.stable.conn)
+	if c.canary == nil {
+		return health
+	}
+
+	canary := controller.ConnectionHealth(c.canary.conn)
+	health.Reason = fmt.Sprintf("%s: %s, %s %s: %s",
+		VariantStable, health.Reason, VariantCanary, canary.Status, canary.Reason)
+	return health
+}
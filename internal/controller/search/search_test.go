@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"testing"
 
+	connection "github.com/planetfall/gateway/internal/connection/grpc"
 	"github.com/planetfall/gateway/internal/controller"
 	"github.com/planetfall/gateway/internal/controller/search"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 )
 
 func TestNewSearchController(t *testing.T) {
@@ -89,3 +91,43 @@ func TestClose_shouldFail(t *testing.T) {
 	assert.NotNil(t, errActual)
 	assert.Contains(t, errActual.Error(), errMessageGiven)
 }
+
+func TestCheckHealth(t *testing.T) {
+	states := map[connectivity.State]string{
+		connectivity.Idle:             controller.HealthUp,
+		connectivity.Connecting:       controller.HealthUp,
+		connectivity.Ready:            controller.HealthUp,
+		connectivity.TransientFailure: controller.HealthDown,
+		connectivity.Shutdown:         controller.HealthDown,
+	}
+
+	for stateGiven, statusExpected := range states {
+		// given
+		connGiven := &connectionMock{}
+		connGiven.On("State").Return(stateGiven)
+		connGiven.On("BreakerState").Return(connection.BreakerClosed)
+		c := getController(t, &clientMock{}, connGiven)
+
+		// when
+		healthActual := c.CheckHealth()
+
+		// then
+		assert.Equal(t, statusExpected, healthActual.Status, stateGiven)
+		assert.Contains(t, healthActual.Reason, stateGiven.String())
+	}
+}
+
+func TestCheckHealth_withBreakerOpen(t *testing.T) {
+	// given
+	connGiven := &connectionMock{}
+	connGiven.On("State").Return(connectivity.Ready)
+	connGiven.On("BreakerState").Return(connection.BreakerOpen)
+	c := getController(t, &clientMock{}, connGiven)
+
+	// when
+	healthActual := c.CheckHealth()
+
+	// then
+	assert.Equal(t, controller.HealthDown, healthActual.Status)
+	assert.Contains(t, healthActual.Reason, "circuit breaker is open")
+}
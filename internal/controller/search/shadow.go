@@ -0,0 +1,382 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/planetfall/gateway/internal/connection/grpc"
+	"github.com/planetfall/gateway/internal/metrics"
+	"github.com/planetfall/gateway/internal/requestid"
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// The default time allowed to the shadow to answer
+	DefaultShadowTimeout = 5 * time.Second
+
+	// The default count of track IDs compared with the shadow
+	DefaultShadowTopN = 10
+
+	// The default maximum count of mirrored calls in flight
+	DefaultShadowMaxInFlight = 8
+)
+
+// The results of a shadow comparison, used as metric label
+const (
+	ShadowMatch    = "match"
+	ShadowMismatch = "mismatch"
+	ShadowError    = "error"
+	ShadowDropped  = "dropped"
+)
+
+// ShadowOptions holds the parameters of the shadow variant. A sample of the
+// backend searches is mirrored to the shadow target, once answered by the
+// primary backend. The shadow response is never sent back: it is compared to
+// the primary one, and the diff summary is written as a JSON line.
+//
+// Only the searches reaching the primary backend are sampled: the requests
+// served from the cache, and the ones sharing a coalesced call, are not
+// mirrored. The sample is then a share of the backend searches, not of the
+// search requests.
+type ShadowOptions struct {
+	// The target of the shadow. No request is mirrored if empty.
+	Target string
+
+	// The percentage of the backend searches mirrored, from 0 to 100
+	Sample float64
+
+	// The time allowed to the shadow to answer, DefaultShadowTimeout if zero
+	Timeout time.Duration
+
+	// The count of track IDs compared, DefaultShadowTopN if zero
+	TopN int
+
+	// The maximum count of mirrored calls in flight. A sampled request is
+	// dropped when it is reached. DefaultShadowMaxInFlight if zero.
+	MaxInFlight int
+
+	// The JSONL file the diff summaries are appended to. They are logged if
+	// empty.
+	Output string
+
+	// The audience of the shadow identity tokens. Built from the shadow
+	// target if empty.
+	Audience string
+
+	// Protobuf custom client (optional)
+	Client Client
+
+	// GRPC custom connection (optional)
+	Conn grpc.Connection
+
+	// Custom diff summaries writer (optional)
+	Writer io.Writer
+}
+
+func (opt ShadowOptions) enabled() bool {
+	return opt.Target != "" || opt.Conn != nil
+}
+
+func (opt ShadowOptions) withDefaults() ShadowOptions {
+	if opt.Timeout <= 0 {
+		opt.Timeout = DefaultShadowTimeout
+	}
+	if opt.TopN <= 0 {
+		opt.TopN = DefaultShadowTopN
+	}
+	if opt.MaxInFlight <= 0 {
+		opt.MaxInFlight = DefaultShadowMaxInFlight
+	}
+	return opt
+}
+
+// callResult summarizes the answer of a variant to a search.
+type callResult struct {
+	Code      string   `json:"code"`
+	Tracks    int      `json:"tracks"`
+	TopIDs    []string `json:"top_ids"`
+	LatencyMS float64  `json:"latency_ms"`
+}
+
+// newCallResult summarizes a search answer, with the topN first track IDs.
+func newCallResult(results *pb.Results, err error,
+	latency time.Duration, topN int) callResult {
+
+	res := callResult{
+		Code:      status.Code(err).String(),
+		TopIDs:    make([]string, 0),
+		LatencyMS: float64(latency.Microseconds()) / 1000,
+	}
+
+	if err != nil || results == nil {
+		return res
+	}
+
+	res.Tracks = len(results.Tracks)
+	for i, track := range results.Tracks {
+		if i >= topN {
+			break
+		}
+		res.TopIDs = append(res.TopIDs, track.ID)
+	}
+
+	return res
+}
+
+// shadowDiff is the summary written for each mirrored request.
+type shadowDiff struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	Query     string    `json:"query"`
+	Genres    []string  `json:"genres,omitempty"`
+	Limit     int32     `json:"limit"`
+
+	// The variant which served the request
+	Variant string     `json:"variant"`
+	Primary callResult `json:"primary"`
+	Shadow  callResult `json:"shadow"`
+
+	// The top IDs are the same, in the same order
+	TopMatch bool `json:"top_match"`
+
+	// The primary top IDs missing from the shadow ones
+	Missing []string `json:"missing,omitempty"`
+
+	// The shadow top IDs missing from the primary ones
+	Extra []string `json:"extra,omitempty"`
+}
+
+// result provides the comparison result of the diff.
+func (d shadowDiff) result() string {
+	switch {
+	case d.Shadow.Code != d.Primary.Code:
+		return ShadowError
+	case d.TopMatch && d.Shadow.Tracks == d.Primary.Tracks:
+		return ShadowMatch
+	default:
+		return ShadowMismatch
+	}
+}
+
+// difference provides the IDs of a which are not in b.
+func difference(a []string, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, id := range b {
+		in[id] = true
+	}
+
+	diff := make([]string, 0)
+	for _, id := range a {
+		if !in[id] {
+			diff = append(diff, id)
+		}
+	}
+
+	return diff
+}
+
+// newShadowDiff compares the primary and the shadow answers.
+func newShadowDiff(p *pb.Parameters, requestID string, variant string,
+	primary callResult, shadow callResult) shadowDiff {
+
+	match := len(primary.TopIDs) == len(shadow.TopIDs)
+	for i := 0; match && i < len(primary.TopIDs); i++ {
+		match = primary.TopIDs[i] == shadow.TopIDs[i]
+	}
+
+	return shadowDiff{
+		Time:      time.Now().UTC(),
+		RequestID: requestID,
+		Query:     p.Query,
+		Genres:    p.GenreFilters,
+		Limit:     p.Limit,
+		Variant:   variant,
+		Primary:   primary,
+		Shadow:    shadow,
+		TopMatch:  match,
+		Missing:   difference(primary.TopIDs, shadow.TopIDs),
+		Extra:     difference(shadow.TopIDs, primary.TopIDs),
+	}
+}
+
+// shadow mirrors the sampled backend searches. The mirrored calls run in
+// their own goroutine, and are bounded: the client path never waits for
+// them.
+type shadow struct {
+	variant
+
+	opt    ShadowOptions
+	logger *log.Logger
+
+	// the controller name, used as metric label
+	controller string
+
+	// the diff summaries output, written by one call at a time
+	mu     sync.Mutex
+	writer io.Writer
+	file   *os.File
+
+	// holds a token per mirrored call in flight
+	inFlight chan struct{}
+	wg       sync.WaitGroup
+}
+
+// getShadowConn provides the shadow grpc.Connection from the option if
+// provided. Else, it builds a new one with the controller parameters.
+func getShadowConn(opt SearchControllerOptions) (grpc.Connection, error) {
+
+	if opt.Shadow.Conn != nil {
+		return opt.Shadow.Conn, nil
+	}
+
+	return newVariantConn(opt,
+		VariantShadow, opt.Shadow.Target, opt.Shadow.Audience)
+}
+
+// newShadow builds the shadow variant, nil if no shadow is configured.
+func newShadow(opt SearchControllerOptions,
+	logger *log.Logger) (*shadow, error) {
+
+	if !opt.Shadow.enabled() {
+		return nil, nil
+	}
+
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	shadowOpt := opt.Shadow.withDefaults()
+	if shadowOpt.Sample < 0 || shadowOpt.Sample > 100 {
+		return nil, fmt.Errorf("shadow sample %v is not between 0 and 100",
+			shadowOpt.Sample)
+	}
+
+	s := &shadow{
+		opt:        shadowOpt,
+		logger:     variantLogger(logger, VariantShadow),
+		controller: opt.ControllerOptions.Name,
+		writer:     shadowOpt.Writer,
+		inFlight:   make(chan struct{}, shadowOpt.MaxInFlight),
+	}
+
+	if s.writer == nil && shadowOpt.Output != "" {
+		file, err := os.OpenFile(shadowOpt.Output,
+			os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("os.OpenFile: %v", err)
+		}
+		s.writer = file
+		s.file = file
+	}
+
+	conn, err := getShadowConn(opt)
+	if err != nil {
+		if s.file != nil {
+			s.file.Close()
+		}
+		return nil, fmt.Errorf("connection.NewConnection: %v", err)
+	}
+
+	client := shadowOpt.Client
+	if client == nil {
+		client = pb.NewMusicResearcherClient(conn.Client())
+	}
+
+	s.variant = variant{
+		name:   VariantShadow,
+		conn:   conn,
+		client: client,
+	}
+
+	return s, nil
+}
+
+// sampled tells if a backend search is mirrored.
+func (s *shadow) sampled() bool {
+	return rand.Float64()*100 < s.opt.Sample
+}
+
+// mirror sends the search to the shadow, if it is sampled, and
+// records the diff with the primary answer. It does not wait for the shadow
+// answer. The request ID of the context is forwarded to the shadow.
+func (s *shadow) mirror(ctx context.Context, p *pb.Parameters,
+	variant string, primary callResult) {
+
+	if !s.sampled() {
+		return
+	}
+
+	select {
+	case s.inFlight <- struct{}{}:
+	default:
+		metrics.ShadowRequests.WithLabelValues(s.controller, ShadowDropped).Inc()
+		return
+	}
+
+	requestID, _ := requestid.FromContext(ctx)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() { <-s.inFlight }()
+
+		ctx, cancel := context.WithTimeout(
+			requestid.NewContext(context.Background(), requestID),
+			s.opt.Timeout)
+		defer cancel()
+
+		start := time.Now()
+		results, err := s.client.Search(ctx, p)
+		shadow := newCallResult(results, err, time.Since(start), s.opt.TopN)
+
+		diff := newShadowDiff(p, requestID, variant, primary, shadow)
+		metrics.ShadowRequests.WithLabelValues(s.controller, diff.result()).Inc()
+		s.record(diff)
+	}()
+}
+
+// record writes the diff as a JSON line, or logs it if no output is set.
+func (s *shadow) record(diff shadowDiff) {
+	line, err := json.Marshal(diff)
+	if err != nil {
+		s.logger.Printf("json.Marshal: %v", err)
+		return
+	}
+
+	if s.writer == nil {
+		s.logger.Printf("%s", line)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.writer.Write(append(line, '\n')); err != nil {
+		s.logger.Printf("writer.Write: %v", err)
+	}
+}
+
+// Close waits for the mirrored calls in flight, then closes the shadow
+// connection and output.
+func (s *shadow) Close() error {
+	s.wg.Wait()
+
+	if err := s.conn.Close(); err != nil {
+		return fmt.Errorf("connection.Close: %v", err)
+	}
+
+	if s.file != nil {
+		if err := s.file.Close(); err != nil {
+			return fmt.Errorf("file.Close: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package search_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/planetfall/gateway/internal/controller"
+	"github.com/planetfall/gateway/internal/controller/search"
+	pb "github.com/planetfall/genproto/pkg/musicresearcher/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// shadowDiff is the part of the diff summary checked by the tests
+type shadowDiff struct {
+	Query    string `json:"query"`
+	Variant  string `json:"variant"`
+	TopMatch bool   `json:"top_match"`
+	Primary  struct {
+		Code   string   `json:"code"`
+		Tracks int      `json:"tracks"`
+		TopIDs []string `json:"top_ids"`
+	} `json:"primary"`
+	Shadow struct {
+		Code   string   `json:"code"`
+		Tracks int      `json:"tracks"`
+		TopIDs []string `json:"top_ids"`
+	} `json:"shadow"`
+	Missing []string `json:"missing"`
+	Extra   []string `json:"extra"`
+}
+
+// resultsOf builds search results with the given track IDs.
+func resultsOf(ids ...string) *pb.Results {
+	results := &pb.Results{}
+	for _, id := range ids {
+		results.Tracks = append(results.Tracks, &pb.Track{ID: id})
+	}
+	return results
+}
+
+// searchReturning mocks a client answering every search.
+func searchReturning(results *pb.Results, err error) *clientMock {
+	clientGiven := &clientMock{}
+	clientGiven.On("Search", mock.Anything, mock.Anything, mock.Anything).
+		Return(results, err)
+	return clientGiven
+}
+
+// withShadow mirrors the sample of the searches to the shadow client, the
+// diff summaries are written to the buffer.
+func withShadow(sampleGiven float64, shadowGiven *clientMock,
+	outputGiven *bytes.Buffer) func(opt *search.SearchControllerOptions) {
+
+	return func(opt *search.SearchControllerOptions) {
+		opt.Shadow = search.ShadowOptions{
+			Sample: sampleGiven,
+			TopN:   3,
+			Client: shadowGiven,
+			Conn:   opt.Conn,
+			Writer: outputGiven,
+		}
+	}
+}
+
+// readDiffs parses the JSON lines of the output.
+func readDiffs(t *testing.T, outputGiven *bytes.Buffer) []shadowDiff {
+	diffs := make([]shadowDiff, 0)
+	for _, line := range strings.Split(
+		strings.TrimSpace(outputGiven.String()), "\n") {
+
+		if line == "" {
+			continue
+		}
+
+		var diff shadowDiff
+		assert.Nil(t, json.Unmarshal([]byte(line), &diff))
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
+
+func TestNewSearchController_withInvalidShadowSample_shouldFail(t *testing.T) {
+	// given
+	optGiven := search.SearchControllerOptions{
+		ControllerOptions: controller.ControllerOptions{
+			Name:   "name",
+			Target: "target",
+		},
+		Insecure: true,
+		Shadow: search.ShadowOptions{
+			Target: "shadow",
+			Sample: -1,
+		},
+	}
+
+	// when
+	c, err := search.NewSearchController(optGiven)
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "shadow sample")
+	assert.Nil(t, c)
+}
+
+func TestShadow(t *testing.T) {
+	// given
+	outputGiven := &bytes.Buffer{}
+	c := getController(t,
+		searchReturning(resultsOf("a", "b", "c", "d"), nil),
+		newConnectionMock(),
+		withShadow(100, searchReturning(resultsOf("a", "c", "e"), nil),
+			outputGiven))
+
+	// when
+	w := httptest.NewRecorder()
+	c.Search(getContextSearch(t, w, "query", 4, nil))
+	assert.Nil(t, c.Close())
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, getSearchResultsActual(t, w).Tracks, 4)
+
+	diffs := readDiffs(t, outputGiven)
+	assert.Len(t, diffs, 1)
+	diffActual := diffs[0]
+	assert.Equal(t, "query", diffActual.Query)
+	assert.Equal(t, search.VariantStable, diffActual.Variant)
+	assert.False(t, diffActual.TopMatch)
+	assert.Equal(t, 4, diffActual.Primary.Tracks)
+	assert.Equal(t, []string{"a", "b", "c"}, diffActual.Primary.TopIDs)
+	assert.Equal(t, 3, diffActual.Shadow.Tracks)
+	assert.Equal(t, []string{"a", "c", "e"}, diffActual.Shadow.TopIDs)
+	assert.Equal(t, []string{"b"}, diffActual.Missing)
+	assert.Equal(t, []string{"e"}, diffActual.Extra)
+}
+
+func TestShadow_withShadowError(t *testing.T) {
+	// given
+	outputGiven := &bytes.Buffer{}
+	c := getController(t, searchReturning(resultsOf("a"), nil),
+		newConnectionMock(),
+		withShadow(100,
+			searchReturning(resultsOf(), fmt.Errorf("test shadow error")),
+			outputGiven))
+
+	// when
+	w := httptest.NewRecorder()
+	c.Search(getContextSearch(t, w, "query", 1, nil))
+	assert.Nil(t, c.Close())
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, getSearchResultsActual(t, w).Tracks, 1)
+
+	diffs := readDiffs(t, outputGiven)
+	assert.Len(t, diffs, 1)
+	assert.Equal(t, "OK", diffs[0].Primary.Code)
+	assert.Equal(t, "Unknown", diffs[0].Shadow.Code)
+	assert.Equal(t, []string{"a"}, diffs[0].Missing)
+}
+
+func TestShadow_withNoSample(t *testing.T) {
+	// given
+	outputGiven := &bytes.Buffer{}
+	shadowGiven := &clientMock{}
+	c := getController(t, searchReturning(resultsOf("a"), nil),
+		newConnectionMock(), withShadow(0, shadowGiven, outputGiven))
+
+	// when
+	w := httptest.NewRecorder()
+	c.Search(getContextSearch(t, w, "query", 1, nil))
+	assert.Nil(t, c.Close())
+
+	// then
+	assert.Equal(t, http.StatusOK, w.Code)
+	shadowGiven.AssertNotCalled(t, "Search",
+		mock.Anything, mock.Anything, mock.Anything)
+	assert.Empty(t, readDiffs(t, outputGiven))
+}
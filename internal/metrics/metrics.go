@@ -0,0 +1,175 @@
+// Package metrics holds the Prometheus metrics of the gateway.
+//
+// The metrics are registered on the package Registry, alongside the Go
+// runtime and process collectors. They are exposed by the Handler.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes all the gateway metrics
+const namespace = "gateway"
+
+// Registry holds all the gateway metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequestDuration observes the handled requests, by controller key,
+	// route, method and status code.
+	HTTPRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Duration of the HTTP requests handled by the controllers.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"controller", "route", "method", "code"},
+	)
+
+	// GRPCClientDuration observes the backend gRPC calls, by method and
+	// status code.
+	GRPCClientDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "grpc_client",
+			Name:      "call_duration_seconds",
+			Help:      "Duration of the gRPC calls to the backends.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"method", "code"},
+	)
+
+	// CanaryRequests counts the backend calls of the controllers with a
+	// canary, by controller key, variant and status code.
+	CanaryRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "canary",
+			Name:      "requests_total",
+			Help:      "Count of the backend calls, by variant.",
+		},
+		[]string{"controller", "variant", "code"},
+	)
+
+	// ShadowRequests counts the search requests mirrored to a shadow
+	// backend, by controller key and comparison result.
+	ShadowRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "shadow",
+			Name:      "requests_total",
+			Help:      "Count of the mirrored requests, by comparison result.",
+		},
+		[]string{"controller", "result"},
+	)
+
+	// CacheRequests counts the lookups of the response cache, by controller
+	// key, route and result.
+	CacheRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "cache",
+			Name:      "requests_total",
+			Help:      "Count of the response cache lookups, by result.",
+		},
+		[]string{"controller", "route", "result"},
+	)
+
+	// TasksCreated counts the Cloud Tasks creations, by result.
+	TasksCreated = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "cloudtasks",
+			Name:      "tasks_created_total",
+			Help:      "Count of the Cloud Tasks creations.",
+		},
+		[]string{"result"},
+	)
+
+	// MessagesReceived counts the Pub/Sub messages received.
+	MessagesReceived = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "pubsub",
+			Name:      "messages_received_total",
+			Help:      "Count of the Pub/Sub messages received.",
+		},
+	)
+
+	// MessagesParsed counts the Pub/Sub messages parsed as job status.
+	MessagesParsed = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "pubsub",
+			Name:      "messages_parsed_total",
+			Help:      "Count of the Pub/Sub messages parsed as job status.",
+		},
+	)
+
+	// MessagesUndeliverable counts the job status which could not be sent to
+	// their websocket.
+	MessagesUndeliverable = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "pubsub",
+			Name:      "messages_undeliverable_total",
+			Help:      "Count of the job status not delivered to their websocket.",
+		},
+	)
+
+	// OpenWebsockets is the count of websockets registered in the store.
+	OpenWebsockets = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "websocket",
+			Name:      "open_connections",
+			Help:      "Count of the open websockets.",
+		},
+	)
+
+	// TrackedJobs is the count of job keys held by the store. A key is held
+	// until its websocket is unregistered.
+	TrackedJobs = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "websocket",
+			Name:      "tracked_jobs",
+			Help:      "Count of the job keys held until their websocket is unregistered.",
+		},
+	)
+)
+
+// The TasksCreated result labels
+const (
+	ResultSuccess = "success"
+	ResultError   = "error"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequestDuration,
+		GRPCClientDuration,
+		CanaryRequests,
+		ShadowRequests,
+		CacheRequests,
+		TasksCreated,
+		MessagesReceived,
+		MessagesParsed,
+		MessagesUndeliverable,
+		OpenWebsockets,
+		TrackedJobs,
+	)
+}
+
+// Handler serves the metrics of the Registry, in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
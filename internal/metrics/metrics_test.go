@@ -0,0 +1,77 @@
+package metrics_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/planetfall/gateway/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// scrape serves the metrics endpoint and provides the body.
+func scrape(t *testing.T) string {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	metrics.Handler().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	return w.Body.String()
+}
+
+func TestMiddleware(t *testing.T) {
+	// given
+	w := httptest.NewRecorder()
+	_, engine := gin.CreateTestContext(w)
+	group := engine.Group("/controller-test")
+	group.Use(metrics.Middleware("controller-test"))
+	group.GET("/items/:id", func(g *gin.Context) {
+		g.Status(http.StatusNotFound)
+	})
+
+	// when
+	req := httptest.NewRequest(http.MethodGet, "/controller-test/items/42", nil)
+	engine.ServeHTTP(w, req)
+
+	// then
+	assert.Contains(t, scrape(t),
+		`gateway_http_request_duration_seconds_count{code="404",`+
+			`controller="controller-test",method="GET",`+
+			`route="/controller-test/items/:id"} 1`)
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	// given
+	interceptor := metrics.UnaryClientInterceptor()
+	errGiven := status.Error(codes.NotFound, "test not found")
+	invokerGiven := func(ctx context.Context, method string,
+		req, reply interface{}, cc *grpc.ClientConn,
+		opts ...grpc.CallOption) error {
+
+		return errGiven
+	}
+
+	// when
+	err := interceptor(context.Background(), "/test.Service/Method",
+		nil, nil, nil, invokerGiven)
+
+	// then
+	assert.Equal(t, errGiven, err)
+	assert.Contains(t, scrape(t),
+		`gateway_grpc_client_call_duration_seconds_count{code="NotFound",`+
+			`method="/test.Service/Method"} 1`)
+}
+
+func TestHandler(t *testing.T) {
+	// when
+	body := scrape(t)
+
+	// then
+	assert.Contains(t, body, "go_goroutines")
+	assert.Contains(t, body, "gateway_websocket_open_connections")
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Middleware observes the duration of the requests handled by a controller.
+// It is registered on the controller router group, the key is used as the
+// controller label.
+func Middleware(controllerKey string) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		start := time.Now()
+
+		g.Next()
+
+		HTTPRequestDuration.WithLabelValues(
+			controllerKey,
+			g.FullPath(),
+			g.Request.Method,
+			strconv.Itoa(g.Writer.Status()),
+		).Observe(time.Since(start).Seconds())
+	}
+}
+
+// UnaryClientInterceptor observes the duration of the unary gRPC calls.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption) error {
+
+		start := time.Now()
+
+		err := invoker(ctx, method, req, reply, cc, opts...)
+
+		GRPCClientDuration.WithLabelValues(
+			method,
+			status.Code(err).String(),
+		).Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
@@ -0,0 +1,66 @@
+// Package requestid identifies the requests going through the gateway.
+// The ID is accepted from the client or generated, then carried by the
+// request context, so it can be forwarded to the backend services and jobs.
+// One ID can be followed from the browser to the backend.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Header is the HTTP header holding the request ID, in the requests and the
+// responses. It is also used on the Cloud Tasks requests.
+const Header = "X-Request-ID"
+
+// MetadataKey is the gRPC metadata key holding the request ID.
+const MetadataKey = "x-request-id"
+
+// validID restricts the IDs accepted from the clients, as they end up in the
+// logs and the backend requests.
+var validID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type contextKey struct{}
+
+// NewContext returns a copy of the context carrying the request ID.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext provides the request ID carried by the context, if any.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(contextKey{}).(string)
+	return id, ok && id != ""
+}
+
+// New generates a new request ID.
+func New() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// Middleware accepts the request ID sent by the client in the Header, or
+// generates a new one if it is missing or invalid. The ID is set on the
+// request context, and sent back in the response Header.
+func Middleware() gin.HandlerFunc {
+	return func(g *gin.Context) {
+		id := g.GetHeader(Header)
+		if !validID.MatchString(id) {
+			id = New()
+		}
+
+		ctx := NewContext(g.Request.Context(), id)
+		g.Request = g.Request.WithContext(ctx)
+		g.Header(Header, id)
+
+		g.Next()
+	}
+}
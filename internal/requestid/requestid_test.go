@@ -0,0 +1,89 @@
+package requestid_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/planetfall/gateway/internal/requestid"
+	"github.com/stretchr/testify/assert"
+)
+
+func serveMiddleware(t *testing.T, headerGiven string) (
+	string, *httptest.ResponseRecorder) {
+
+	var idActual string
+
+	w := httptest.NewRecorder()
+	_, engine := gin.CreateTestContext(w)
+	engine.Use(requestid.Middleware())
+	engine.GET("/route", func(g *gin.Context) {
+		id, ok := requestid.FromContext(g.Request.Context())
+		assert.True(t, ok)
+		idActual = id
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/route", nil)
+	if headerGiven != "" {
+		req.Header.Set(requestid.Header, headerGiven)
+	}
+	engine.ServeHTTP(w, req)
+
+	return idActual, w
+}
+
+func TestMiddleware(t *testing.T) {
+	// when
+	idActual, w := serveMiddleware(t, "")
+
+	// then
+	assert.Len(t, idActual, 32)
+	assert.Equal(t, idActual, w.Header().Get(requestid.Header))
+}
+
+func TestMiddleware_withClientID(t *testing.T) {
+	// given
+	idGiven := "client-request-id.42"
+
+	// when
+	idActual, w := serveMiddleware(t, idGiven)
+
+	// then
+	assert.Equal(t, idGiven, idActual)
+	assert.Equal(t, idGiven, w.Header().Get(requestid.Header))
+}
+
+func TestMiddleware_withInvalidClientID(t *testing.T) {
+	// given
+	idGiven := "invalid id\nwith a new line"
+
+	// when
+	idActual, w := serveMiddleware(t, idGiven)
+
+	// then
+	assert.NotEqual(t, idGiven, idActual)
+	assert.Len(t, idActual, 32)
+	assert.Equal(t, idActual, w.Header().Get(requestid.Header))
+}
+
+func TestFromContext_withNoID(t *testing.T) {
+	// when
+	_, ok := requestid.FromContext(context.Background())
+
+	// then
+	assert.False(t, ok)
+}
+
+func TestNewContext(t *testing.T) {
+	// given
+	ctx := requestid.NewContext(context.Background(), "id")
+
+	// when
+	idActual, ok := requestid.FromContext(ctx)
+
+	// then
+	assert.True(t, ok)
+	assert.Equal(t, "id", idActual)
+}
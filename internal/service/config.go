@@ -1,23 +1,227 @@
 package service
 
 import (
+	"fmt"
 	"log"
+	"path"
 	"reflect"
-)
+	"strconv"
+	"strings"
+	"time"
 
-// Keys used to retrieve controller configuration and set the routes
-const (
-	MusicResearcher = "music-researcher"
-	Downloader      = "downloader"
+	"github.com/gin-gonic/gin"
+	"github.com/planetfall/gateway/internal/connection/grpc"
+	"google.golang.org/grpc/codes"
 )
 
-// controllerConfig holds the basic configuration needed for a GRPC controller
+// Tracing is the key used to retrieve the tracing configuration
+const Tracing = "tracing"
+
+// tracingConfig holds the tracing configuration
+type tracingConfig struct {
+	ServiceName string  `mapstructure:"service-name"`
+	Exporter    string  `mapstructure:"exporter" validate:"omitempty,oneof=none otlp stdout file"`
+	Endpoint    string  `mapstructure:"endpoint" validate:"required_if=Exporter otlp"`
+	Insecure    bool    `mapstructure:"insecure"`
+	File        string  `mapstructure:"file" validate:"required_if=Exporter file"`
+	SampleRatio float64 `mapstructure:"sample-ratio" validate:"gte=0,lte=1"`
+}
+
+// controllerConfig holds the basic settings needed for a GRPC controller
 type controllerConfig struct {
 	Target string `mapstructure:"target" validate:"required"`
+
+	// request context timeouts, the route timeouts are keyed by the route
+	// relative to the controller, such as "search"
+	Timeout    time.Duration            `mapstructure:"timeout" validate:"gte=0"`
+	MaxTimeout time.Duration            `mapstructure:"max-timeout" validate:"gte=0"`
+	Timeouts   map[string]time.Duration `mapstructure:"timeouts" validate:"dive,gt=0"`
+
+	// the gRPC client interceptors, in order, and the timeout of each call
+	// attempt
+	Interceptors   []string      `mapstructure:"interceptors" validate:"omitempty,dive,oneof=request-id logging metrics breaker retry timeout"`
+	AttemptTimeout time.Duration `mapstructure:"attempt-timeout" validate:"gte=0"`
+
+	Retry   retryConfig   `mapstructure:"retry"`
+	Breaker breakerConfig `mapstructure:"breaker"`
+	Auth    authConfig    `mapstructure:"auth"`
+
+	// the transport security, the service insecure setting is used if the
+	// insecure toggle is unset
+	Insecure *bool     `mapstructure:"insecure"`
+	TLS      tlsConfig `mapstructure:"tls"`
+
+	// the endpoints the calls are spread over, the target is then only a
+	// name, and the balancing of the calls
+	Endpoints []endpointConfig `mapstructure:"endpoints" validate:"dive"`
+	Balancing balancingConfig  `mapstructure:"balancing"`
+	Keepalive keepaliveConfig  `mapstructure:"keepalive"`
+}
+
+// endpointConfig is an address serving the backend of a GRPC controller
+type endpointConfig struct {
+	Address string `mapstructure:"address" validate:"required,hostname_port"`
+	Weight  uint32 `mapstructure:"weight"`
+}
+
+// balancingConfig holds the balancing of the calls of a GRPC controller
+type balancingConfig struct {
+	Policy             string `mapstructure:"policy" validate:"omitempty,oneof=pick-first round-robin weighted"`
+	HealthCheck        bool   `mapstructure:"health-check"`
+	HealthCheckService string `mapstructure:"health-check-service"`
+}
+
+// keepaliveConfig holds the keepalive of the connection of a GRPC controller
+type keepaliveConfig struct {
+	Time                time.Duration `mapstructure:"time" validate:"gte=0"`
+	Timeout             time.Duration `mapstructure:"timeout" validate:"gte=0"`
+	PermitWithoutStream bool          `mapstructure:"permit-without-stream"`
+}
+
+// endpoints provides the endpoints of a gRPC controller
+func (cfg controllerConfig) endpoints() []grpc.Endpoint {
+	endpoints := make([]grpc.Endpoint, 0, len(cfg.Endpoints))
+	for _, e := range cfg.Endpoints {
+		endpoints = append(endpoints, grpc.Endpoint{
+			Address: e.Address,
+			Weight:  e.Weight,
+		})
+	}
+
+	return endpoints
+}
+
+// balancingOptions provides the balancing parameters of a gRPC controller
+func (cfg controllerConfig) balancingOptions() grpc.BalancingOptions {
+	return grpc.BalancingOptions{
+		Policy:             cfg.Balancing.Policy,
+		HealthCheck:        cfg.Balancing.HealthCheck,
+		HealthCheckService: cfg.Balancing.HealthCheckService,
+	}
+}
+
+// keepaliveOptions provides the keepalive parameters of a gRPC controller
+func (cfg controllerConfig) keepaliveOptions() grpc.KeepaliveOptions {
+	return grpc.KeepaliveOptions{
+		Time:                cfg.Keepalive.Time,
+		Timeout:             cfg.Keepalive.Timeout,
+		PermitWithoutStream: cfg.Keepalive.PermitWithoutStream,
+	}
+}
+
+// tlsConfig holds the TLS settings of a GRPC controller
+type tlsConfig struct {
+	CAFile     string `mapstructure:"ca-file"`
+	CertFile   string `mapstructure:"cert-file" validate:"required_with=KeyFile"`
+	KeyFile    string `mapstructure:"key-file" validate:"required_with=CertFile"`
+	ServerName string `mapstructure:"server-name"`
+}
+
+// isInsecure tells if the controller connection is insecure, falling back to
+// the service setting.
+func (cfg controllerConfig) isInsecure(insecure bool) bool {
+	if cfg.Insecure == nil {
+		return insecure
+	}
+
+	return *cfg.Insecure
+}
+
+// tlsOptions provides the TLS parameters of a gRPC controller
+func (cfg controllerConfig) tlsOptions() grpc.TLSOptions {
+	return grpc.TLSOptions{
+		CAFile:     cfg.TLS.CAFile,
+		CertFile:   cfg.TLS.CertFile,
+		KeyFile:    cfg.TLS.KeyFile,
+		ServerName: cfg.TLS.ServerName,
+	}
+}
+
+// authConfig holds the authentication of a GRPC controller. The static
+// token is read from the file if set, else from the environment variable.
+type authConfig struct {
+	Mode         string        `mapstructure:"mode" validate:"omitempty,oneof=google static none"`
+	Audience     string        `mapstructure:"audience"`
+	TokenFile    string        `mapstructure:"token-file"`
+	TokenEnv     string        `mapstructure:"token-env"`
+	EarlyRefresh time.Duration `mapstructure:"early-refresh" validate:"gte=0"`
+}
+
+// authOptions provides the authentication parameters of a gRPC controller
+func (cfg controllerConfig) authOptions() grpc.AuthOptions {
+	return grpc.AuthOptions{
+		Mode:         cfg.Auth.Mode,
+		Audience:     cfg.Auth.Audience,
+		TokenFile:    cfg.Auth.TokenFile,
+		TokenEnv:     cfg.Auth.TokenEnv,
+		EarlyRefresh: cfg.Auth.EarlyRefresh,
+	}
 }
 
-// downloadControllerConfig holds specific configuration for the download
-// controller
+// retryConfig holds the retry policy of a GRPC controller. The codes are
+// gRPC code names, such as "unavailable" or "deadline-exceeded".
+type retryConfig struct {
+	MaxAttempts    int           `mapstructure:"max-attempts" validate:"gte=0"`
+	InitialBackoff time.Duration `mapstructure:"initial-backoff" validate:"gte=0"`
+	MaxBackoff     time.Duration `mapstructure:"max-backoff" validate:"gte=0"`
+	Multiplier     float64       `mapstructure:"multiplier" validate:"omitempty,gte=1"`
+	Jitter         float64       `mapstructure:"jitter" validate:"gte=0,lte=1"`
+	Codes          []string      `mapstructure:"codes"`
+}
+
+// breakerConfig holds the circuit breaker settings of a GRPC controller
+type breakerConfig struct {
+	FailureThreshold int           `mapstructure:"failure-threshold" validate:"gte=0"`
+	OpenTimeout      time.Duration `mapstructure:"open-timeout" validate:"gte=0"`
+}
+
+// parseCodes parses gRPC code names, case insensitive and using either
+// dashes or underscores.
+func parseCodes(names []string) ([]codes.Code, error) {
+	parsed := make([]codes.Code, 0, len(names))
+	for _, name := range names {
+		name = strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+
+		var code codes.Code
+		if err := code.UnmarshalJSON([]byte(strconv.Quote(name))); err != nil {
+			return nil, fmt.Errorf("invalid code %q", name)
+		}
+		parsed = append(parsed, code)
+	}
+
+	return parsed, nil
+}
+
+// interceptorOptions provides the interceptor chain parameters of a gRPC
+// controller. The calls are logged with the controller logger.
+func (cfg controllerConfig) interceptorOptions(
+	logger *log.Logger) (grpc.InterceptorOptions, error) {
+
+	retryCodes, err := parseCodes(cfg.Retry.Codes)
+	if err != nil {
+		return grpc.InterceptorOptions{}, fmt.Errorf("retry: %v", err)
+	}
+
+	return grpc.InterceptorOptions{
+		Chain:   cfg.Interceptors,
+		Logger:  logger,
+		Timeout: cfg.AttemptTimeout,
+		Retry: grpc.RetryOptions{
+			MaxAttempts:    cfg.Retry.MaxAttempts,
+			InitialBackoff: cfg.Retry.InitialBackoff,
+			MaxBackoff:     cfg.Retry.MaxBackoff,
+			Multiplier:     cfg.Retry.Multiplier,
+			Jitter:         cfg.Retry.Jitter,
+			Codes:          retryCodes,
+		},
+		Breaker: grpc.BreakerOptions{
+			FailureThreshold: cfg.Breaker.FailureThreshold,
+			OpenTimeout:      cfg.Breaker.OpenTimeout,
+		},
+	}, nil
+}
+
+// downloadControllerConfig holds the settings of the download controller
 type downloadControllerConfig struct {
 	Target string `mapstructure:"target" validate:"required"`
 
@@ -25,15 +229,185 @@ type downloadControllerConfig struct {
 	QueueID        string   `mapstructure:"queue" validate:"required"`
 	SubscriptionID string   `mapstructure:"subscription" validate:"required"`
 	Origins        []string `mapstructure:"origins" validate:"required"`
+
+	// outbound queue of each websocket
+	QueueSize    int           `mapstructure:"queue-size" validate:"gte=0"`
+	WriteTimeout time.Duration `mapstructure:"write-timeout" validate:"gte=0"`
+	SlowConsumer string        `mapstructure:"slow-consumer" validate:"omitempty,oneof=drop-oldest close"`
+
+	// websocket heartbeat and limits
+	PingInterval    time.Duration `mapstructure:"ping-interval" validate:"gte=0"`
+	PongWait        time.Duration `mapstructure:"pong-wait" validate:"gte=0"`
+	ReadTimeout     time.Duration `mapstructure:"read-timeout" validate:"gte=0"`
+	MaxMessageSize  int64         `mapstructure:"max-message-size" validate:"gte=0"`
+	ReadBufferSize  int           `mapstructure:"read-buffer-size" validate:"gte=0"`
+	WriteBufferSize int           `mapstructure:"write-buffer-size" validate:"gte=0"`
 }
 
-func logConfig(logger *log.Logger, cfg interface{}) {
-	v := reflect.ValueOf(cfg)
-	t := v.Type()
+// searchControllerConfig holds the settings of the search controller
+type searchControllerConfig struct {
+	controllerConfig `mapstructure:",squash"`
 
-	logger.Println("--------------")
+	// the canary receiving a share of the traffic, none if no target is set
+	Canary canaryConfig `mapstructure:"canary"`
+
+	// the shadow the search requests are mirrored to, none if no target is
+	// set
+	Shadow shadowConfig `mapstructure:"shadow"`
+
+	// the response cache, a route is not cached if its TTL is not set
+	Cache cacheConfig `mapstructure:"cache"`
+
+	// the search pagination, the cursors are signed by a random secret if
+	// none is set
+	Pagination paginationConfig `mapstructure:"pagination"`
+
+	// the genre catalog, the genre filters are not validated if no refresh
+	// interval is set
+	Catalog catalogConfig `mapstructure:"catalog"`
+
+	// the batch search
+	Batch batchConfig `mapstructure:"batch"`
+}
+
+// cacheConfig holds the response cache of a search controller
+type cacheConfig struct {
+	GenresTTL  time.Duration `mapstructure:"genres-ttl" validate:"gte=0"`
+	SearchTTL  time.Duration `mapstructure:"search-ttl" validate:"gte=0"`
+	MaxEntries int           `mapstructure:"max-entries" validate:"gte=0"`
+	MaxBytes   int           `mapstructure:"max-bytes" validate:"gte=0"`
+
+	// the expired responses served while refreshed, or when the backend
+	// fails, and the collapsing of the identical calls in flight
+	StaleWhileRevalidate time.Duration `mapstructure:"stale-while-revalidate" validate:"gte=0"`
+	StaleIfError         time.Duration `mapstructure:"stale-if-error" validate:"gte=0"`
+	Coalesce             bool          `mapstructure:"coalesce"`
+}
+
+// paginationConfig holds the search pagination of a search controller
+type paginationConfig struct {
+	DefaultLimit int    `mapstructure:"default-limit" validate:"gte=0"`
+	MaxLimit     int    `mapstructure:"max-limit" validate:"gte=0"`
+	MaxFetch     int    `mapstructure:"max-fetch" validate:"gte=0"`
+	CursorSecret string `mapstructure:"cursor-secret" secret:"true"`
+}
+
+// catalogConfig holds the genre catalog of a search controller
+type catalogConfig struct {
+	RefreshInterval time.Duration `mapstructure:"refresh-interval" validate:"gte=0"`
+	Timeout         time.Duration `mapstructure:"timeout" validate:"gte=0"`
+	MaxSuggestions  int           `mapstructure:"max-suggestions" validate:"gte=0"`
+	MaxDistance     int           `mapstructure:"max-distance" validate:"gte=0"`
+}
+
+// batchConfig holds the batch search of a search controller
+type batchConfig struct {
+	MaxItems    int           `mapstructure:"max-items" validate:"gte=0"`
+	Concurrency int           `mapstructure:"concurrency" validate:"gte=0"`
+	ItemTimeout time.Duration `mapstructure:"item-timeout" validate:"gte=0"`
+}
+
+// canaryConfig holds the canary variant of a search controller
+type canaryConfig struct {
+	Target       string  `mapstructure:"target"`
+	Weight       float64 `mapstructure:"weight" validate:"gte=0,lte=100"`
+	StickyHeader string  `mapstructure:"sticky-header"`
+	Audience     string  `mapstructure:"audience"`
+}
+
+// shadowConfig holds the shadow variant of a search controller
+type shadowConfig struct {
+	Target      string        `mapstructure:"target"`
+	Sample      float64       `mapstructure:"sample" validate:"gte=0,lte=100"`
+	Timeout     time.Duration `mapstructure:"timeout" validate:"gte=0"`
+	TopN        int           `mapstructure:"top-n" validate:"gte=0"`
+	MaxInFlight int           `mapstructure:"max-in-flight" validate:"gte=0"`
+	Output      string        `mapstructure:"output"`
+	Audience    string        `mapstructure:"audience"`
+}
+
+// proxyControllerConfig holds the settings of the proxy controller
+type proxyControllerConfig struct {
+	controllerConfig `mapstructure:",squash"`
+
+	// the FileDescriptorSet file, the backend reflection is used if empty
+	DescriptorSet string `mapstructure:"descriptor-set"`
+
+	Routes []proxyRouteConfig `mapstructure:"routes" validate:"required,dive"`
+
+	// the maximum size of a request body in bytes
+	MaxBodyBytes int64 `mapstructure:"max-body-bytes" validate:"gte=0"`
+}
+
+// proxyRouteConfig exposes a gRPC method as a route of the proxy controller
+type proxyRouteConfig struct {
+	Method string `mapstructure:"method" validate:"omitempty,oneof=GET POST PUT PATCH DELETE get post put patch delete"`
+	Path   string `mapstructure:"path" validate:"required,startswith=/"`
+	RPC    string `mapstructure:"rpc" validate:"required"`
+	Body   string `mapstructure:"body"`
+}
+
+// routeTimeouts keys the configured route timeouts by their full path, as
+// seen by the controller handlers.
+func routeTimeouts(group *gin.RouterGroup,
+	timeouts map[string]time.Duration) map[string]time.Duration {
+
+	fullTimeouts := make(map[string]time.Duration, len(timeouts))
+	for route, timeout := range timeouts {
+		fullTimeouts[path.Join(group.BasePath(), route)] = timeout
+	}
+
+	return fullTimeouts
+}
+
+// secretMask replaces the value of the secret fields in the logs
+const secretMask = "********"
+
+// mask masks in place the string fields tagged with `secret:"true"`, in the
+// nested structs too. The value must be addressable. The empty secrets are
+// kept empty, so an unset secret can be told apart.
+func mask(v reflect.Value) {
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if v.Type().Field(i).Tag.Get("secret") != "true" {
+			mask(field)
+			continue
+		}
+		if field.Kind() == reflect.String && field.CanSet() && field.Len() > 0 {
+			field.SetString(secretMask)
+		}
+	}
+}
+
+// logFields logs the fields of the struct. The fields of the embedded
+// structs are logged as the other ones.
+func logFields(logger *log.Logger, v reflect.Value) {
+	t := v.Type()
 	for i := 0; i < v.NumField(); i++ {
-		logger.Printf("%s:\t %v", t.Field(i).Name, v.Field(i).Interface())
+		field := v.Field(i)
+		if t.Field(i).Anonymous && field.Kind() == reflect.Struct {
+			logFields(logger, field)
+			continue
+		}
+		if field.Kind() == reflect.Pointer && !field.IsNil() {
+			field = field.Elem()
+		}
+		logger.Printf("%s:\t %v", t.Field(i).Name, field.Interface())
 	}
+}
+
+// logConfig logs the fields of the configuration, the secret ones being
+// masked.
+func logConfig(logger *log.Logger, cfg interface{}) {
+	v := reflect.New(reflect.TypeOf(cfg)).Elem()
+	v.Set(reflect.ValueOf(cfg))
+	mask(v)
+
+	logger.Println("--------------")
+	logFields(logger, v)
 	logger.Println("--------------")
 }
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"bytes"
+	"log"
+	"testing"
+
+	"github.com/planetfall/gateway/internal/controller/search"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogConfig_withSecret(t *testing.T) {
+	// given
+	var buf bytes.Buffer
+	loggerGiven := log.New(&buf, "", 0)
+	cfgGiven := searchControllerConfig{
+		controllerConfig: controllerConfig{Target: "target:443"},
+		Pagination: paginationConfig{
+			MaxLimit:     10,
+			CursorSecret: "cursor-secret-value",
+		},
+	}
+
+	// when
+	logConfig(loggerGiven, cfgGiven)
+
+	// then
+	assert.NotContains(t, buf.String(), "cursor-secret-value")
+	assert.Contains(t, buf.String(), secretMask)
+	assert.Contains(t, buf.String(), "target:443")
+	assert.Equal(t, "cursor-secret-value", cfgGiven.Pagination.CursorSecret)
+}
+
+func TestSearchStickyHeaders(t *testing.T) {
+	// given
+	instancesGiven := []controllerInstanceConfig{
+		{Type: SearchType, Settings: map[string]interface{}{
+			"canary": map[string]interface{}{"sticky-header": "X-User-ID"},
+		}},
+		{Type: SearchType, Settings: map[string]interface{}{}},
+		{Type: ProxyType, Settings: map[string]interface{}{
+			"canary": map[string]interface{}{"sticky-header": "X-Other"},
+		}},
+	}
+
+	// when
+	headers := searchStickyHeaders(instancesGiven)
+
+	// then
+	assert.Equal(t,
+		[]string{search.DefaultStickyHeader, "X-User-ID"}, headers)
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/planetfall/gateway/internal/controller"
+	"github.com/planetfall/gateway/internal/controller/download"
+	"github.com/planetfall/gateway/internal/controller/download/websocket"
+)
+
+// DownloadType is the type of the download job controllers
+const DownloadType = "download"
+
+func init() {
+	registerControllerType(DownloadType, newDownloadController)
+}
+
+// newDownloadController creates a new DownloadController
+func newDownloadController(opt svcControllerOptions) (svcController, error) {
+
+	var cfg downloadControllerConfig
+	if err := decodeSettings(opt.settings, &cfg); err != nil {
+		return nil, err
+	}
+
+	logConfig(opt.logger, cfg)
+
+	ctrlOpt := download.DownloadControllerOptions{
+		ControllerOptions: controller.ControllerOptions{
+			Name:        opt.name,
+			Target:      cfg.Target,
+			ReportError: opt.reportErrorCallback,
+			Logger:      opt.logger,
+		},
+		ProjectID:       opt.projectID,
+		LocationID:      cfg.LocationID,
+		QueueID:         cfg.QueueID,
+		SubscriptionID:  cfg.SubscriptionID,
+		Origins:         cfg.Origins,
+		ReadBufferSize:  cfg.ReadBufferSize,
+		WriteBufferSize: cfg.WriteBufferSize,
+		ConnOptions: websocket.ConnOptions{
+			QueueSize:      cfg.QueueSize,
+			WriteTimeout:   cfg.WriteTimeout,
+			SlowConsumer:   websocket.SlowConsumerPolicy(cfg.SlowConsumer),
+			PingInterval:   cfg.PingInterval,
+			PongWait:       cfg.PongWait,
+			ReadTimeout:    cfg.ReadTimeout,
+			MaxMessageSize: cfg.MaxMessageSize,
+		},
+	}
+	ctrl, err := download.NewDownloadController(ctrlOpt)
+	if err != nil {
+		return nil, fmt.Errorf("download.NewDownloadController: %v", err)
+	}
+
+	opt.group.GET("/url", ctrl.Download)
+
+	var svcCtrl svcController = ctrl
+	return svcCtrl, nil
+}
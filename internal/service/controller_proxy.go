@@ -0,0 +1,72 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/planetfall/gateway/internal/controller"
+	"github.com/planetfall/gateway/internal/controller/proxy"
+)
+
+// ProxyType is the type of the generic gRPC-to-REST controllers
+const ProxyType = "proxy"
+
+func init() {
+	registerControllerType(ProxyType, newProxyController)
+}
+
+// newProxyController creates a new ProxyController
+func newProxyController(opt svcControllerOptions) (svcController, error) {
+
+	var cfg proxyControllerConfig
+	if err := decodeSettings(opt.settings, &cfg); err != nil {
+		return nil, err
+	}
+
+	logConfig(opt.logger, cfg)
+
+	interceptors, err := cfg.interceptorOptions(opt.logger)
+	if err != nil {
+		return nil, fmt.Errorf("invalid settings: %v", err)
+	}
+
+	routes := make([]proxy.Route, 0, len(cfg.Routes))
+	for _, r := range cfg.Routes {
+		routes = append(routes, proxy.Route{
+			Method: r.Method,
+			Path:   r.Path,
+			RPC:    r.RPC,
+			Body:   r.Body,
+		})
+	}
+
+	ctrlOpt := proxy.ProxyControllerOptions{
+		ControllerOptions: controller.ControllerOptions{
+			Name:          opt.name,
+			Target:        cfg.Target,
+			ReportError:   opt.reportErrorCallback,
+			Logger:        opt.logger,
+			Timeout:       cfg.Timeout,
+			MaxTimeout:    cfg.MaxTimeout,
+			RouteTimeouts: routeTimeouts(opt.group, cfg.Timeouts),
+		},
+		Insecure:      cfg.isInsecure(opt.insecure),
+		Interceptors:  interceptors,
+		Auth:          cfg.authOptions(),
+		TLS:           cfg.tlsOptions(),
+		Endpoints:     cfg.endpoints(),
+		Balancing:     cfg.balancingOptions(),
+		Keepalive:     cfg.keepaliveOptions(),
+		DescriptorSet: cfg.DescriptorSet,
+		Routes:        routes,
+		MaxBodyBytes:  cfg.MaxBodyBytes,
+	}
+	ctrl, err := proxy.NewProxyController(ctrlOpt)
+	if err != nil {
+		return nil, fmt.Errorf("proxy.NewProxyController: %v", err)
+	}
+
+	ctrl.Handle(opt.group)
+
+	var svcCtrl svcController = ctrl
+	return svcCtrl, nil
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/planetfall/gateway/internal/controller"
+	"github.com/planetfall/gateway/internal/controller/search"
+)
+
+// SearchType is the type of the music researcher controllers
+const SearchType = "search"
+
+func init() {
+	registerControllerType(SearchType, newSearchController)
+}
+
+// newSearchController creates a new SearchController
+func newSearchController(opt svcControllerOptions) (svcController, error) {
+
+	var cfg searchControllerConfig
+	if err := decodeSettings(opt.settings, &cfg); err != nil {
+		return nil, err
+	}
+
+	logConfig(opt.logger, cfg)
+
+	interceptors, err := cfg.interceptorOptions(opt.logger)
+	if err != nil {
+		return nil, fmt.Errorf("invalid settings: %v", err)
+	}
+
+	ctrlOpt := search.SearchControllerOptions{
+		ControllerOptions: controller.ControllerOptions{
+			Name:          opt.name,
+			Target:        cfg.Target,
+			ReportError:   opt.reportErrorCallback,
+			Logger:        opt.logger,
+			Timeout:       cfg.Timeout,
+			MaxTimeout:    cfg.MaxTimeout,
+			RouteTimeouts: routeTimeouts(opt.group, cfg.Timeouts),
+		},
+		Insecure:     cfg.isInsecure(opt.insecure),
+		Interceptors: interceptors,
+		Auth:         cfg.authOptions(),
+		TLS:          cfg.tlsOptions(),
+		Endpoints:    cfg.endpoints(),
+		Balancing:    cfg.balancingOptions(),
+		Keepalive:    cfg.keepaliveOptions(),
+		Canary: search.CanaryOptions{
+			Target:       cfg.Canary.Target,
+			Weight:       cfg.Canary.Weight,
+			StickyHeader: cfg.Canary.StickyHeader,
+			Audience:     cfg.Canary.Audience,
+		},
+		Shadow: search.ShadowOptions{
+			Target:      cfg.Shadow.Target,
+			Sample:      cfg.Shadow.Sample,
+			Timeout:     cfg.Shadow.Timeout,
+			TopN:        cfg.Shadow.TopN,
+			MaxInFlight: cfg.Shadow.MaxInFlight,
+			Output:      cfg.Shadow.Output,
+			Audience:    cfg.Shadow.Audience,
+		},
+		Cache: search.CacheOptions{
+			GenresTTL:  cfg.Cache.GenresTTL,
+			SearchTTL:  cfg.Cache.SearchTTL,
+			MaxEntries: cfg.Cache.MaxEntries,
+			MaxBytes:   cfg.Cache.MaxBytes,
+
+			StaleWhileRevalidate: cfg.Cache.StaleWhileRevalidate,
+			StaleIfError:         cfg.Cache.StaleIfError,
+			Coalesce:             cfg.Cache.Coalesce,
+		},
+		Pagination: search.PaginationOptions{
+			DefaultLimit: cfg.Pagination.DefaultLimit,
+			MaxLimit:     cfg.Pagination.MaxLimit,
+			MaxFetch:     cfg.Pagination.MaxFetch,
+			Secret:       []byte(cfg.Pagination.CursorSecret),
+		},
+		Catalog: search.CatalogOptions{
+			RefreshInterval: cfg.Catalog.RefreshInterval,
+			Timeout:         cfg.Catalog.Timeout,
+			MaxSuggestions:  cfg.Catalog.MaxSuggestions,
+			MaxDistance:     cfg.Catalog.MaxDistance,
+		},
+		Batch: search.BatchOptions{
+			MaxItems:    cfg.Batch.MaxItems,
+			Concurrency: cfg.Batch.Concurrency,
+			ItemTimeout: cfg.Batch.ItemTimeout,
+		},
+	}
+	ctrl, err := search.NewSearchController(ctrlOpt)
+	if err != nil {
+		return nil, fmt.Errorf("search.NewSearchController: %v", err)
+	}
+
+	opt.group.GET("/search", ctrl.Search)
+	opt.group.POST("/search/batch", ctrl.SearchBatch)
+	opt.group.GET("/genres", ctrl.GetGenreList)
+
+	var svcCtrl svcController = ctrl
+	return svcCtrl, nil
+}
+
+// searchStickyHeaders provides the canary sticky headers of the search
+// instances, the default one included, so the browsers are allowed to send
+// them. Invalid settings are skipped, the builder reports them.
+func searchStickyHeaders(instances []controllerInstanceConfig) []string {
+	headers := []string{search.DefaultStickyHeader}
+	for _, instance := range instances {
+		if instance.Type != SearchType {
+			continue
+		}
+
+		var cfg struct {
+			Canary struct {
+				StickyHeader string `mapstructure:"sticky-header"`
+			} `mapstructure:"canary"`
+		}
+		err := mapstructure.Decode(instance.Settings, &cfg)
+		if err != nil || cfg.Canary.StickyHeader == "" {
+			continue
+		}
+
+		headers = append(headers, cfg.Canary.StickyHeader)
+	}
+
+	return headers
+}
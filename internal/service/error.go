@@ -1,9 +1,28 @@
 package service
 
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/planetfall/gateway/internal/controller"
+)
+
 // reportErrorCallback is the callback used by the service controllers
-// when an error is encountered in the handlers
+// when an error is encountered in the handlers.
+// The error code and the correlation ID sent back to the client are added to
+// the report, alongside the failed request.
 func (s *Service) reportErrorCallback(err error) {
 
 	message := "received error from controller"
-	s.srv.Raise(message, err, nil)
+	var req *http.Request
+
+	var reportedErr *controller.ReportedError
+	if errors.As(err, &reportedErr) {
+		message = fmt.Sprintf("%s [code=%s correlation_id=%s]", message,
+			reportedErr.Code, reportedErr.CorrelationID)
+		req = reportedErr.Request
+	}
+
+	s.srv.Raise(message, err, req)
 }
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/planetfall/gateway/internal/controller"
+)
+
+// The health routes
+const (
+	livenessRoute  = "/healthz"
+	readinessRoute = "/readyz"
+)
+
+// healthChecker is implemented by the controllers which can report their
+// health. It is optional: a controller without it is considered up.
+type healthChecker interface {
+	CheckHealth() controller.Health
+}
+
+// controllerHealth is the health of one controller, in the readiness
+// response.
+type controllerHealth struct {
+	Name string `json:"name"`
+	controller.Health
+}
+
+// readiness is the readiness response body.
+type readiness struct {
+	Status      string             `json:"status"`
+	Controllers []controllerHealth `json:"controllers"`
+}
+
+// liveness answers as long as the server is able to serve requests.
+func (s *Service) liveness(g *gin.Context) {
+	g.JSON(http.StatusOK, controller.Up(""))
+}
+
+// readiness aggregates the health of the controllers. The service is ready
+// only if all of them are up, else it answers with a
+// http.StatusServiceUnavailable status.
+func (s *Service) readiness(g *gin.Context) {
+	res := readiness{
+		Status:      controller.HealthUp,
+		Controllers: make([]controllerHealth, 0, len(s.ctrlList)),
+	}
+
+	for _, ctrl := range s.ctrlList {
+		health := controller.Up("no health check")
+		if checker, ok := ctrl.(healthChecker); ok {
+			health = checker.CheckHealth()
+		}
+
+		if !health.IsUp() {
+			res.Status = controller.HealthDown
+		}
+		res.Controllers = append(res.Controllers, controllerHealth{
+			Name:   ctrl.Name(),
+			Health: health,
+		})
+	}
+
+	sort.Slice(res.Controllers, func(i, j int) bool {
+		return res.Controllers[i].Name < res.Controllers[j].Name
+	})
+
+	status := http.StatusOK
+	if res.Status != controller.HealthUp {
+		status = http.StatusServiceUnavailable
+	}
+	g.JSON(status, res)
+}
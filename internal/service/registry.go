@@ -0,0 +1,165 @@
+package service
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// Controllers is the key used to retrieve the controller instances
+// configuration
+const Controllers = "controllers"
+
+// controllerBuilder builds a controller of a given type, from its instance
+// options.
+type controllerBuilder func(svcControllerOptions) (svcController, error)
+
+// controllerTypes holds the builder of each registered controller type.
+var controllerTypes = make(map[string]controllerBuilder)
+
+// registerControllerType makes a controller type available to the
+// configuration. It is meant to be called from the init function of the file
+// holding the builder. It panics if the type is registered twice.
+func registerControllerType(typ string, builder controllerBuilder) {
+	if _, exists := controllerTypes[typ]; exists {
+		panic(fmt.Sprintf("controller type %s registered twice", typ))
+	}
+
+	controllerTypes[typ] = builder
+}
+
+// registeredTypes lists the registered controller types, sorted.
+func registeredTypes() []string {
+	types := make([]string, 0, len(controllerTypes))
+	for typ := range controllerTypes {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+
+	return types
+}
+
+// controllerInstanceConfig declares a controller instance. Several instances
+// of the same type can run side by side, with different names and routes.
+type controllerInstanceConfig struct {
+	// The unique instance name, used in the logs and the metrics
+	Name string `mapstructure:"name" validate:"required"`
+
+	// The registered controller type
+	Type string `mapstructure:"type" validate:"required"`
+
+	// The route prefix, "/" followed by the name if unset
+	Route string `mapstructure:"route" validate:"omitempty,startswith=/"`
+
+	// The instance is skipped if set to false
+	Enabled *bool `mapstructure:"enabled"`
+
+	// The type specific settings, decoded by the type builder
+	Settings map[string]interface{} `mapstructure:"settings"`
+
+	// The position in the list
+	index int
+}
+
+// entry names the configuration entry, for the error messages.
+func (cfg controllerInstanceConfig) entry() string {
+	return fmt.Sprintf("%s[%d] (%s)", Controllers, cfg.index, cfg.Name)
+}
+
+// enabled tells if the instance is enabled, which is the default.
+func (cfg controllerInstanceConfig) enabled() bool {
+	return cfg.Enabled == nil || *cfg.Enabled
+}
+
+// loadControllerInstances reads and validates the controller instances
+// list. The instances keep the configuration order, which is the route
+// registration order. The disabled instances are left out.
+//
+// The errors point at the offending entry, such as "controllers[1] (name)".
+func loadControllerInstances() ([]controllerInstanceConfig, error) {
+	var instances []controllerInstanceConfig
+	if err := viper.UnmarshalKey(Controllers, &instances); err != nil {
+		return nil, fmt.Errorf("viper.UnmarshalKey: %v", err)
+	}
+
+	v := validator.New()
+	names := make(map[string]int)
+	routes := make(map[string]int)
+	enabled := make([]controllerInstanceConfig, 0, len(instances))
+
+	for i, instance := range instances {
+		instance.index = i
+		entry := instance.entry()
+
+		if err := v.Struct(instance); err != nil {
+			return nil, fmt.Errorf("%s: invalid configuration: %v", entry, err)
+		}
+
+		if _, exists := controllerTypes[instance.Type]; !exists {
+			return nil, fmt.Errorf("%s: unknown type %q, expected one of %s",
+				entry, instance.Type, strings.Join(registeredTypes(), ", "))
+		}
+
+		if first, exists := names[instance.Name]; exists {
+			return nil, fmt.Errorf("%s: name already used by %s[%d]",
+				entry, Controllers, first)
+		}
+		names[instance.Name] = i
+
+		if instance.Route == "" {
+			instance.Route = "/" + instance.Name
+		}
+		instance.Route = path.Clean(instance.Route)
+		if instance.Route == "/" {
+			return nil, fmt.Errorf("%s: route must not be the root", entry)
+		}
+
+		if !instance.enabled() {
+			continue
+		}
+
+		if first, exists := routes[instance.Route]; exists {
+			return nil, fmt.Errorf("%s: route %s already used by %s[%d]",
+				entry, instance.Route, Controllers, first)
+		}
+		routes[instance.Route] = i
+
+		enabled = append(enabled, instance)
+	}
+
+	return enabled, nil
+}
+
+// decodeSettings decodes the type specific settings of an instance into the
+// type configuration, and validates it. The durations are parsed from their
+// string form, and the unknown settings are rejected.
+func decodeSettings(settings map[string]interface{}, cfg interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+		ErrorUnused:      true,
+		WeaklyTypedInput: true,
+		Result:           cfg,
+	})
+	if err != nil {
+		return fmt.Errorf("mapstructure.NewDecoder: %v", err)
+	}
+
+	if err := decoder.Decode(settings); err != nil {
+		return fmt.Errorf("invalid settings: %v", err)
+	}
+
+	v := validator.New()
+	if err := v.Struct(cfg); err != nil {
+		return fmt.Errorf("invalid settings: %v", err)
+	}
+
+	return nil
+}
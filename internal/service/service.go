@@ -14,8 +14,14 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
 	"github.com/planetfall/framework/pkg/server"
 	_ "github.com/planetfall/gateway/docs"
+	"github.com/planetfall/gateway/internal/controller/search"
+	"github.com/planetfall/gateway/internal/metrics"
+	"github.com/planetfall/gateway/internal/requestid"
+	"github.com/planetfall/gateway/internal/tracing"
+	"github.com/spf13/viper"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
@@ -30,11 +36,16 @@ type Service struct {
 	g   *gin.Engine
 
 	ctrlList []svcController
+
+	tracing tracing.Tracing
 }
 
 // swaggerUIRoute is the path to get the swagger UI.
 const swaggerUIRoute = "/swagger-ui/*any"
 
+// metricsRoute is the path to get the Prometheus metrics.
+const metricsRoute = "/metrics"
+
 // ServiceOptions holds the service builder parameters
 type ServiceOptions struct {
 	// Srv builer parameter
@@ -63,36 +74,64 @@ type ServiceOptions struct {
 // @produce		json
 // @schemes		https
 func NewService(opt ServiceOptions) (*Service, error) {
+	// the instances are loaded before the cors middleware, which allows
+	// their sticky headers
+	instances, err := loadControllerInstances()
+	if err != nil {
+		return nil, fmt.Errorf("loadControllerInstances: %v", err)
+	}
+
+	// tracing is set up before the controllers, they use the installed
+	// provider
+	tr, err := newTracing(opt.Srv.Logger)
+	if err != nil {
+		return nil, fmt.Errorf("newTracing: %v", err)
+	}
+
 	g := gin.Default()
 
 	// cors middleware
 	gConfig := cors.DefaultConfig()
 	gConfig.AllowAllOrigins = true
+	gConfig.AddAllowHeaders(requestid.Header, "traceparent", "tracestate",
+		search.CanaryHeader)
+	gConfig.AddAllowHeaders(searchStickyHeaders(instances)...)
+	gConfig.AddExposeHeaders(requestid.Header, "Retry-After", "ETag",
+		search.VariantHeader, search.CacheHeader)
 	g.Use(cors.New(gConfig))
 
+	// request ID middleware, the ID is forwarded to the backends
+	g.Use(requestid.Middleware())
+
+	// tracing middleware, tags the spans with the request ID
+	g.Use(tracing.Middleware())
+
 	// initialize the service
 	svc := &Service{
 		srv:      opt.Srv,
 		g:        g,
 		ctrlList: make([]svcController, 0),
+		tracing:  tr,
 	}
 
-	// build controllers
-	for key, builder := range controllerBuilders {
+	// build controllers, in the configuration order
+	for _, instance := range instances {
 
-		svc.srv.Logger.Printf("setup controller %s", key)
+		svc.srv.Logger.Printf("setup controller %s of type %s on %s",
+			instance.Name, instance.Type, instance.Route)
 
-		keyUpper := strings.ToUpper(key)
+		nameUpper := strings.ToUpper(instance.Name)
 		loggerPrefix := fmt.Sprintf(
-			"%s[%s] ", opt.Srv.Logger.Prefix(), keyUpper)
+			"%s[%s] ", opt.Srv.Logger.Prefix(), nameUpper)
 		logger := log.New(
 			os.Stdout, loggerPrefix, log.Ldate|log.Ltime)
 
-		route := fmt.Sprintf("/%s", key)
-		group := g.Group(route)
+		group := g.Group(instance.Route)
+		group.Use(metrics.Middleware(instance.Name))
 
 		opt := svcControllerOptions{
-			cfgKey:              key,
+			name:                instance.Name,
+			settings:            instance.Settings,
 			group:               group,
 			reportErrorCallback: svc.reportErrorCallback,
 			logger:              logger,
@@ -100,10 +139,13 @@ func NewService(opt ServiceOptions) (*Service, error) {
 			projectID:           opt.ProjectID,
 		}
 
+		builder := controllerTypes[instance.Type]
 		ctrl, err := builder(opt)
 		if err != nil {
-			return nil, fmt.Errorf(
-				"builder for controller %s failed: %v", key, err)
+			// release the controllers already built and the tracing
+			svc.close()
+			return nil, fmt.Errorf("%s: builder failed: %v",
+				instance.entry(), err)
 		}
 
 		svc.ctrlList = append(svc.ctrlList, ctrl)
@@ -112,6 +154,13 @@ func NewService(opt ServiceOptions) (*Service, error) {
 	// setup the swagger route
 	svc.g.GET(swaggerUIRoute, ginSwagger.WrapHandler(swaggerFiles.Handler))
 
+	// setup the metrics route
+	svc.g.GET(metricsRoute, gin.WrapH(metrics.Handler()))
+
+	// setup the health routes
+	svc.g.GET(livenessRoute, svc.liveness)
+	svc.g.GET(readinessRoute, svc.readiness)
+
 	return svc, nil
 }
 
@@ -153,12 +202,15 @@ func (s *Service) Start(port string) error {
 }
 
 // close frees all resources from the service.
-// It closes all the active controllers stored in ctrlList.
+// It closes all the active controllers stored in ctrlList, then flushes the
+// pending spans.
 //
 // If one controller fails the close, a warning message is printed. The flow
 // is not interrupted, and the service tries to close the other controllers
 // anyway.
 func (s *Service) close() {
+	defer s.shutdownTracing()
+
 	for _, ctrl := range s.ctrlList {
 		err := ctrl.Close()
 		if err != nil {
@@ -171,3 +223,37 @@ func (s *Service) close() {
 		}
 	}
 }
+
+// newTracing sets up the tracing from the configuration.
+func newTracing(logger *log.Logger) (tracing.Tracing, error) {
+	var cfg tracingConfig
+	if err := viper.UnmarshalKey(Tracing, &cfg); err != nil {
+		return nil, fmt.Errorf("viper.UnmarshalKey: %v", err)
+	}
+
+	v := validator.New()
+	if err := v.Struct(cfg); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %v", err)
+	}
+
+	logConfig(logger, cfg)
+
+	return tracing.NewTracing(tracing.TracingOptions{
+		ServiceName: cfg.ServiceName,
+		Exporter:    cfg.Exporter,
+		Endpoint:    cfg.Endpoint,
+		Insecure:    cfg.Insecure,
+		File:        cfg.File,
+		SampleRatio: cfg.SampleRatio,
+	})
+}
+
+// shutdownTracing flushes the pending spans.
+func (s *Service) shutdownTracing() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.tracing.Shutdown(ctx); err != nil {
+		s.srv.Logger.Printf("failed to shutdown tracing: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package tracing
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/planetfall/gateway/internal/requestid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer of the gateway HTTP server.
+const instrumentationName = "github.com/planetfall/gateway/internal/tracing"
+
+// RequestIDKey is the span attribute holding the request ID.
+const RequestIDKey = attribute.Key("request.id")
+
+// Middleware starts a server span for each request, continuing the W3C trace
+// context sent by the client if any. The span is named after the matched
+// route, and set on the request context so the handlers can pass it on.
+//
+// It must be registered after the request ID middleware, in order to tag the
+// span with the request ID.
+func Middleware() gin.HandlerFunc {
+	tracer := otel.Tracer(instrumentationName)
+
+	return func(g *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(
+			g.Request.Context(), propagation.HeaderCarrier(g.Request.Header))
+
+		route := g.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		attrs := []attribute.KeyValue{
+			semconv.HTTPMethod(g.Request.Method),
+			semconv.HTTPRoute(route),
+		}
+		if id, ok := requestid.FromContext(ctx); ok {
+			attrs = append(attrs, RequestIDKey.String(id))
+		}
+
+		ctx, span := tracer.Start(ctx, g.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attrs...))
+		defer span.End()
+
+		g.Request = g.Request.WithContext(ctx)
+		g.Next()
+
+		status := g.Writer.Status()
+		span.SetAttributes(semconv.HTTPStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package tracing_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/planetfall/gateway/internal/requestid"
+	"github.com/planetfall/gateway/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// serveMiddleware serves the request through an engine with the middleware,
+// and records the ended spans.
+func serveMiddleware(req *http.Request, status int) (
+	[]sdktrace.ReadOnlySpan, trace.SpanContext) {
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(
+		sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var handlerSpan trace.SpanContext
+
+	w := httptest.NewRecorder()
+	_, engine := gin.CreateTestContext(w)
+	engine.Use(requestid.Middleware(), tracing.Middleware())
+	engine.GET("/controller/:id", func(g *gin.Context) {
+		handlerSpan = trace.SpanContextFromContext(g.Request.Context())
+		g.Status(status)
+	})
+	engine.ServeHTTP(w, req)
+
+	return recorder.Ended(), handlerSpan
+}
+
+func TestMiddleware(t *testing.T) {
+	// given
+	req := httptest.NewRequest(http.MethodGet, "/controller/42", nil)
+	req.Header.Set(requestid.Header, "request-id")
+
+	// when
+	spans, handlerSpan := serveMiddleware(req, http.StatusOK)
+
+	// then
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "GET /controller/:id", spans[0].Name())
+	assert.Equal(t, trace.SpanKindServer, spans[0].SpanKind())
+	assert.Equal(t, handlerSpan.SpanID(), spans[0].SpanContext().SpanID())
+	assert.Contains(t, spans[0].Attributes(),
+		tracing.RequestIDKey.String("request-id"))
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+}
+
+func TestMiddleware_withTraceParent(t *testing.T) {
+	// given
+	traceIDGiven := "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/controller/42", nil)
+	req.Header.Set("traceparent",
+		"00-"+traceIDGiven+"-00f067aa0ba902b7-01")
+
+	// when
+	spans, _ := serveMiddleware(req, http.StatusOK)
+
+	// then
+	assert.Len(t, spans, 1)
+	assert.Equal(t, traceIDGiven, spans[0].SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+}
+
+func TestMiddleware_withServerError(t *testing.T) {
+	// given
+	req := httptest.NewRequest(http.MethodGet, "/controller/42", nil)
+
+	// when
+	spans, _ := serveMiddleware(req, http.StatusBadGateway)
+
+	// then
+	assert.Len(t, spans, 1)
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+}
@@ -0,0 +1,180 @@
+// Package tracing sets up the OpenTelemetry tracing of the gateway.
+//
+// The spans are exported to an OTLP collector, or written as JSON to the
+// standard output or to a file for local testing. The W3C trace context is
+// propagated, so the traces started by the clients are continued, and passed
+// on to the backends.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+// The span exporters
+const (
+	// ExporterNone does not record any span, the trace context is still
+	// propagated.
+	ExporterNone = "none"
+
+	// ExporterOTLP sends the spans to an OTLP collector, using gRPC
+	ExporterOTLP = "otlp"
+
+	// ExporterStdout writes the spans to the standard output
+	ExporterStdout = "stdout"
+
+	// ExporterFile writes the spans to a file
+	ExporterFile = "file"
+)
+
+// The default service name, used as resource attribute
+const DefaultServiceName = "gateway"
+
+// Tracing holds the tracer provider installed globally.
+type Tracing interface {
+	// Shutdown flushes the pending spans, and releases the exporter.
+	Shutdown(ctx context.Context) error
+}
+
+type tracingImpl struct {
+	provider *sdktrace.TracerProvider
+	output   io.Closer
+}
+
+// TracingOptions holds the parameters for the Tracing builder.
+type TracingOptions struct {
+	// The name of the service, as seen in the traces
+	ServiceName string
+
+	// The span exporter, ExporterNone if empty
+	Exporter string
+
+	// The OTLP collector endpoint, such as "localhost:4317"
+	Endpoint string
+
+	// Disables the TLS to the OTLP collector
+	Insecure bool
+
+	// The file the spans are appended to, with the file exporter
+	File string
+
+	// The ratio of the new traces which are sampled, all of them if unset.
+	// The traces started by the clients follow their sampling decision.
+	SampleRatio float64
+}
+
+// NewTracing installs the W3C trace context propagator, and a tracer provider
+// using the configured exporter. Both are set globally, so the instrumented
+// libraries use them.
+func NewTracing(opt TracingOptions) (Tracing, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	t := &tracingImpl{}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch opt.Exporter {
+	case "", ExporterNone:
+		return t, nil
+	case ExporterOTLP:
+		exporter, err = newOTLPExporter(opt)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterFile:
+		exporter, err = t.newFileExporter(opt)
+	default:
+		return nil, fmt.Errorf("unknown exporter %q", opt.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tracing.NewTracing: %v", err)
+	}
+
+	serviceName := opt.ServiceName
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+	res, err := resource.Merge(resource.Default(),
+		resource.NewSchemaless(semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("resource.Merge: %v", err)
+	}
+
+	ratio := opt.SampleRatio
+	if ratio <= 0 {
+		ratio = 1
+	}
+
+	t.provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(
+			sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(t.provider)
+
+	return t, nil
+}
+
+func newOTLPExporter(opt TracingOptions) (sdktrace.SpanExporter, error) {
+	clientOpts := []otlptracegrpc.Option{
+		otlptracegrpc.WithEndpoint(opt.Endpoint),
+	}
+	if opt.Insecure {
+		clientOpts = append(clientOpts, otlptracegrpc.WithInsecure())
+	}
+
+	// the exporter connects lazily, it does not fail if the collector is down
+	exporter, err := otlptracegrpc.New(context.Background(), clientOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("otlptracegrpc.New: %v", err)
+	}
+
+	return exporter, nil
+}
+
+func (t *tracingImpl) newFileExporter(
+	opt TracingOptions) (sdktrace.SpanExporter, error) {
+
+	f, err := os.OpenFile(opt.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("os.OpenFile: %v", err)
+	}
+	t.output = f
+
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+	if err != nil {
+		return nil, fmt.Errorf("stdouttrace.New: %v", err)
+	}
+
+	return exporter, nil
+}
+
+// Shutdown flushes the pending spans, and closes the exporter output.
+func (t *tracingImpl) Shutdown(ctx context.Context) error {
+	if t.provider == nil {
+		return nil
+	}
+
+	if err := t.provider.Shutdown(ctx); err != nil {
+		return fmt.Errorf("provider.Shutdown: %v", err)
+	}
+
+	if t.output != nil {
+		if err := t.output.Close(); err != nil {
+			return fmt.Errorf("output.Close: %v", err)
+		}
+	}
+
+	return nil
+}
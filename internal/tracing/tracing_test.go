@@ -0,0 +1,55 @@
+package tracing_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/planetfall/gateway/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+)
+
+func TestNewTracing_withFileExporter(t *testing.T) {
+	// given
+	fileGiven := filepath.Join(t.TempDir(), "spans.jsonl")
+	tr, err := tracing.NewTracing(tracing.TracingOptions{
+		ServiceName: "gateway-test",
+		Exporter:    tracing.ExporterFile,
+		File:        fileGiven,
+	})
+	assert.Nil(t, err)
+
+	// when
+	_, span := otel.Tracer("test").Start(context.Background(), "test-span")
+	span.End()
+	err = tr.Shutdown(context.Background())
+
+	// then
+	assert.Nil(t, err)
+	content, err := os.ReadFile(fileGiven)
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "test-span")
+	assert.Contains(t, string(content), "gateway-test")
+}
+
+func TestNewTracing_withNoExporter(t *testing.T) {
+	// when
+	tr, err := tracing.NewTracing(tracing.TracingOptions{})
+
+	// then
+	assert.Nil(t, err)
+	assert.Nil(t, tr.Shutdown(context.Background()))
+}
+
+func TestNewTracing_withUnknownExporter_shouldFail(t *testing.T) {
+	// when
+	_, err := tracing.NewTracing(tracing.TracingOptions{
+		Exporter: "unknown",
+	})
+
+	// then
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "unknown exporter")
+}